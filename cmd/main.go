@@ -2,36 +2,366 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens"
+	"github.com/gmaschi/b2w-sw-planets/internal/config"
+	healthcontroller "github.com/gmaschi/b2w-sw-planets/internal/controllers/health"
 	planetsfactory "github.com/gmaschi/b2w-sw-planets/internal/factories/planets-factory"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
+	"github.com/gmaschi/b2w-sw-planets/internal/logging"
+	authmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/auth"
+	tenantmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/tenant"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	boltstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/bolt/planets-db"
+	loggingstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/logging/planets-db"
+	memorystore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/memory/planets-db"
+	metricsstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/metrics/planets-db"
 	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	sqlstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/sql/planets-db"
+	tracingstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/tracing/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/swapi"
+	"github.com/gmaschi/b2w-sw-planets/internal/tracing"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.uber.org/zap"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
-const (
-	mongoURI      = "mongodb://localhost:27017"
-	serverAddress = "0.0.0.0:8080"
-)
-
+// usage: main [flags] [migrate]
+//
+// The migrate command applies the pending mongodb migrations and exits.
+// Run with -h to list the flags and their environment variables.
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	clientOptions := options.Client().ApplyURI(mongoURI)
-	client, err := mongo.Connect(ctx, clientOptions)
+	cfg, cmd, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalln("could not load config:", err)
+	}
+
+	logger, err := logging.New(cfg.Log.Level)
 	if err != nil {
-		log.Fatalln("could not connect to database:", err)
+		log.Fatalln("could not create logger:", err)
+	}
+	defer logger.Sync()
+
+	if cmd.PrintConfig || cfg.Log.Level == "debug" {
+		out, err := cfg.YAML()
+		if err != nil {
+			logger.Fatal("could not print config", zap.Error(err))
+		}
+		if cmd.PrintConfig {
+			fmt.Print(string(out))
+			return
+		}
+		logger.Debug("config", zap.String("config", string(out)))
+	}
+
+	tenancy := planetsdb.Tenancy(cfg.Tenancy.Mode)
+
+	if cmd.Name == "migrate" {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.ConnectTimeout)
+		defer cancel()
+		client, err := connectMongo(ctx, cfg.Mongo)
+		if err != nil {
+			logger.Fatal("could not connect to database", zap.Error(err))
+		}
+		defer client.Disconnect(context.Background())
+		if err := migrateMongo(ctx, logger, client, cfg.Mongo.Database, cfg.Mongo.Collection, tenancy); err != nil {
+			logger.Fatal("could not migrate database", zap.Error(err))
+		}
+		return
+	}
+	if cmd.Name != "" {
+		logger.Fatal("unknown command", zap.String("command", cmd.Name))
 	}
 
-	store := planetsdb.NewStore(client)
-	server, err := planetsfactory.New(&store)
+	gin.SetMode(cfg.Server.GinMode)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName:  cfg.Tracing.ServiceName,
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		File:         cfg.Tracing.File,
+	})
 	if err != nil {
-		log.Fatalln("could not create server:", err)
+		logger.Fatal("could not set up tracing", zap.Error(err))
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGracePeriod)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("could not flush traces", zap.Error(err))
+		}
+	}()
+	tracingEnabled := cfg.Tracing.Exporter != tracing.NoExporter
 
-	err = server.Start(serverAddress)
+	swapiOptions := []swapi.Option{
+		swapi.WithBaseURL(cfg.SWAPI.BaseURL),
+		swapi.WithTimeout(cfg.SWAPI.Timeout),
+		swapi.WithPingTTL(cfg.Health.SWAPITTL),
+	}
+	var (
+		registry       *prometheus.Registry
+		swapiTransport http.RoundTripper
+	)
+	if cfg.Metrics.Enabled {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		swapiTransport = swapi.NewMetricsTransport(registry, nil)
+	}
+	if tracingEnabled {
+		swapiTransport = otelhttp.NewTransport(swapiTransport, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "swapi " + r.Method
+		}))
+	}
+	if swapiTransport != nil {
+		swapiOptions = append(swapiOptions, swapi.WithTransport(swapiTransport))
+	}
+	movies := swapi.New(swapiOptions...)
+
+	backend, err := newStore(cfg, logger, movies)
 	if err != nil {
-		log.Fatalln("could not start server:", err)
+		logger.Fatal("could not create store", zap.Error(err))
+	}
+	if registry != nil {
+		backend.store = metricsstore.NewStore(backend.store, registry)
+	}
+	backend.store = loggingstore.NewStore(backend.store, logger)
+	if tracingEnabled {
+		backend.store = tracingstore.NewStore(backend.store, cfg.Store.Backend)
+	}
+	defer func() {
+		if err := backend.close(); err != nil {
+			logger.Error("could not close store", zap.Error(err))
+		}
+	}()
+
+	healthChecks := []healthcontroller.Check{
+		{Name: "swapi", Critical: cfg.Health.SWAPICritical, Probe: movies.Ping},
+	}
+	if backend.ping != nil {
+		healthChecks = append(healthChecks, healthcontroller.Check{Name: cfg.Store.Backend, Critical: true, Probe: backend.ping})
+	}
+
+	factoryOptions := []planetsfactory.Option{
+		planetsfactory.WithLogger(logger, config.SplitList(cfg.Log.RedactHeaders)...),
+		planetsfactory.WithHealthChecks(cfg.Health.Timeout, healthChecks...),
+		planetsfactory.WithTrustedProxies(config.SplitList(cfg.Server.TrustedProxies)...),
+		planetsfactory.WithTimeouts(planetsfactory.Timeouts{
+			ReadHeader: cfg.Server.ReadHeaderTimeout,
+			Read:       cfg.Server.ReadTimeout,
+			Write:      cfg.Server.WriteTimeout,
+			Idle:       cfg.Server.IdleTimeout,
+			Stream:     cfg.Server.StreamTimeout,
+		}),
+		planetsfactory.WithBodyLimits(planetsfactory.BodyLimits{
+			Import: int64(cfg.Server.MaxImportBytes),
+			Batch:  int64(cfg.Server.MaxBatchBytes),
+		}),
+	}
+	if tracingEnabled {
+		factoryOptions = append(factoryOptions, planetsfactory.WithTracing(cfg.Tracing.ServiceName))
+	}
+	if registry != nil {
+		factoryOptions = append(factoryOptions, planetsfactory.WithMetrics(registry, cfg.Metrics.Path))
+	}
+	if cfg.Auth.APIKeys {
+		var authOptions []authmiddleware.Option
+		if cfg.Auth.BootstrapKey != "" {
+			authOptions = append(authOptions, authmiddleware.WithBootstrapKey(cfg.Auth.BootstrapKey))
+		}
+		factoryOptions = append(factoryOptions, planetsfactory.WithAPIKeys(backend.keys, authOptions...))
+	}
+	if cfg.RateLimit.Enabled {
+		var limits ratelimit.Store = ratelimit.NewMemoryStore()
+		if cfg.RateLimit.Backend == config.MongoDBBackend {
+			limits = backend.limits
+		}
+		factoryOptions = append(factoryOptions, planetsfactory.WithRateLimit(limits,
+			ratelimit.Limit{Requests: cfg.RateLimit.Read, Period: cfg.RateLimit.Period},
+			ratelimit.Limit{Requests: cfg.RateLimit.Write, Period: cfg.RateLimit.Period},
+		))
+		if cfg.RateLimit.IP > 0 {
+			factoryOptions = append(factoryOptions, planetsfactory.WithIPRateLimit(limits,
+				ratelimit.Limit{Requests: cfg.RateLimit.IP, Period: cfg.RateLimit.Period},
+			))
+		}
+	}
+	if cfg.Idempotency.Enabled {
+		var keys idempotency.Store = idempotency.NewMemoryStore()
+		if cfg.Idempotency.Backend == config.MongoDBBackend {
+			keys = backend.idempotency
+		}
+		factoryOptions = append(factoryOptions, planetsfactory.WithIdempotency(keys, cfg.Idempotency.TTL))
+	}
+	if cfg.Auth.JWKS != "" {
+		keySet := tokens.NewKeySet(cfg.Auth.JWKS, tokens.WithRefresh(cfg.Auth.JWKSRefresh))
+		if err := keySet.Load(context.Background()); err != nil {
+			logger.Fatal("could not load jwks", zap.Error(err))
+		}
+		verifier := tokens.New(keySet, cfg.Auth.Issuer, cfg.Auth.Audience,
+			tokens.WithRolesClaim(cfg.Auth.RolesClaim),
+			tokens.WithTenantClaim(cfg.Auth.TenantClaim),
+		)
+		factoryOptions = append(factoryOptions, planetsfactory.WithTokens(verifier))
+	}
+	if tenancy != planetsdb.NoTenancy {
+		// the credentials pick the tenant when there are any, the header is only trusted without them
+		resolveTenant := tenantmiddleware.New(tenantmiddleware.FromHeader(cfg.Tenancy.Header))
+		if cfg.Auth.APIKeys || cfg.Auth.JWKS != "" {
+			resolveTenant = tenantmiddleware.Bound(tenantmiddleware.FromContextKey(authmiddleware.TenantKey), cfg.Tenancy.Header)
+		}
+		factoryOptions = append(factoryOptions, planetsfactory.WithPlanetsMiddleware(resolveTenant))
+	}
+
+	server, err := planetsfactory.New(backend.store, factoryOptions...)
+	if err != nil {
+		logger.Fatal("could not create server", zap.Error(err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Start(cfg.Server.Address)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			logger.Error("could not start server", zap.Error(err))
+		}
+		return
+	case <-ctx.Done():
+		stop()
+	}
+
+	logger.Info("shutting down, waiting for in-flight requests", zap.Duration("grace_period", cfg.Server.ShutdownGracePeriod))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGracePeriod)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("could not shut down server gracefully", zap.Error(err))
+	}
+}
+
+// backend is a planets store together with the handles to probe and release its connections.
+// limits and idempotency are the rate limit and idempotency stores shared by the replicas, nil
+// when the backend has none.
+type backend struct {
+	store       planetsdb.Store
+	keys        apikeys.Store
+	limits      ratelimit.Store
+	idempotency idempotency.Store
+	close       func() error
+	ping        func(ctx context.Context) error
+}
+
+// newStore creates the planets store for the configured backend
+func newStore(cfg config.Config, logger *zap.Logger, movies planetsdb.MoviesFinder) (backend, error) {
+	switch cfg.Store.Backend {
+	case config.MemoryBackend:
+		return backend{
+			store: memorystore.NewStore(movies),
+			keys:  memorystore.NewKeyStore(),
+			close: func() error { return nil },
+		}, nil
+	case config.BoltBackend:
+		store, err := boltstore.Open(cfg.Bolt.Path, movies)
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{store: store, keys: store.KeyStore(), close: store.Close}, nil
+	case config.SQLBackend:
+		dialect := sqlstore.Dialect(cfg.SQL.Dialect)
+		db, err := sql.Open(string(dialect), cfg.SQL.DSN)
+		if err != nil {
+			return backend{}, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		store := sqlstore.NewStore(db, dialect, movies)
+		if err := store.Migrate(ctx); err != nil {
+			db.Close()
+			return backend{}, err
+		}
+		return backend{store: store, keys: store.KeyStore(), close: db.Close, ping: db.PingContext}, nil
+	case config.MongoDBBackend:
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.ConnectTimeout)
+		defer cancel()
+		client, err := connectMongo(ctx, cfg.Mongo)
+		if err != nil {
+			return backend{}, err
+		}
+		disconnect := func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Mongo.ConnectTimeout)
+			defer cancel()
+			return client.Disconnect(ctx)
+		}
+		tenancy := planetsdb.Tenancy(cfg.Tenancy.Mode)
+		if cfg.Mongo.Migrate {
+			if err := migrateMongo(ctx, logger, client, cfg.Mongo.Database, cfg.Mongo.Collection, tenancy); err != nil {
+				disconnect()
+				return backend{}, err
+			}
+		}
+		storeOptions := []planetsdb.Option{
+			planetsdb.WithMoviesFinder(movies),
+			planetsdb.WithDatabase(cfg.Mongo.Database),
+			planetsdb.WithCollection(cfg.Mongo.Collection),
+			planetsdb.WithTenancy(tenancy),
+		}
+		if cfg.Mongo.Migrate && tenancy == planetsdb.DatabasePerTenant {
+			// the databases of new tenants are created by their first request
+			migrate := migrateDatabase(logger, migrationsConfig(cfg.Mongo.Collection, tenancy))
+			storeOptions = append(storeOptions, planetsdb.WithTenantSetup(migrate))
+		}
+		store := planetsdb.NewStore(client, storeOptions...)
+		ping := func(ctx context.Context) error {
+			return client.Ping(ctx, readpref.Primary())
+		}
+		return backend{
+			store:       &store,
+			keys:        store.KeyStore(),
+			limits:      store.RateLimitStore(),
+			idempotency: store.IdempotencyStore(),
+			close:       disconnect,
+			ping:        ping,
+		}, nil
+	default:
+		return backend{}, fmt.Errorf("unknown store backend %q", cfg.Store.Backend)
+	}
+}
+
+// connectMongo connects to mongodb and pings the primary, so an unreachable server fails at startup
+func connectMongo(ctx context.Context, cfg config.Mongo) (*mongo.Client, error) {
+	clientOptions := options.Client().ApplyURI(cfg.URI)
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
 	}
+	return client, nil
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/migrations"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// migrateMongo applies the pending migrations to the planets database and, when every
+// tenant has a database of their own, to each existing tenant database. The planets database
+// still holds the API keys, rate limits and idempotency keys of every tenant.
+func migrateMongo(ctx context.Context, logger *zap.Logger, client *mongo.Client, database, collection string, tenancy planetsdb.Tenancy) error {
+	databases := []string{database}
+	if tenancy == planetsdb.DatabasePerTenant {
+		tenantDatabases, err := migrations.TenantDatabases(ctx, client, database)
+		if err != nil {
+			return err
+		}
+		databases = append(databases, tenantDatabases...)
+	}
+
+	migrate := migrateDatabase(logger, migrationsConfig(collection, tenancy))
+	for _, name := range databases {
+		if err := migrate(ctx, client.Database(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateDatabase returns a function applying the pending migrations to a database, for the
+// databases of the tenants that did not exist when the server started
+func migrateDatabase(logger *zap.Logger, cfg migrations.Config) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		applied, err := migrations.New(db, cfg).Run(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info("applied migrations", zap.String("database", db.Name()), zap.Ints("versions", applied))
+		return nil
+	}
+}
+
+func migrationsConfig(collection string, tenancy planetsdb.Tenancy) migrations.Config {
+	return migrations.Config{
+		Collection:   collection,
+		TenantScoped: tenancy == planetsdb.TenantFilter,
+	}
+}
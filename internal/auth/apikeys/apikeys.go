@@ -0,0 +1,131 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Scopes
+const (
+	ScopeRead   = "planets:read"
+	ScopeWrite  = "planets:write"
+	ScopeDelete = "planets:delete"
+	// ScopeAdmin grants the management of the API keys
+	ScopeAdmin = "keys:admin"
+)
+
+const (
+	// keyPrefix marks the API keys, so they are easy to spot in leaked text
+	keyPrefix = "swp_"
+	// displayLength is how much of a key is kept in clear to tell keys apart
+	displayLength = len(keyPrefix) + 6
+)
+
+type (
+	// Key is a stored API key. Only the SHA-256 hash of the key is kept.
+	Key struct {
+		ID     string   `bson:"_id" json:"id"`
+		Name   string   `bson:"name" json:"name"`
+		Prefix string   `bson:"prefix" json:"prefix"`
+		Hash   string   `bson:"hash" json:"hash"`
+		Scopes []string `bson:"scopes" json:"scopes"`
+		// Tenant is the tenant whose planets the key reaches, empty when tenancy is disabled
+		Tenant    string     `bson:"tenant,omitempty" json:"tenant,omitempty"`
+		CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+		RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	}
+
+	// Store keeps the API keys. Lookups of missing keys fail with errorsmodel.APIKeyDoesNotExist.
+	Store interface {
+		CreateKey(ctx context.Context, key Key) error
+		KeyByHash(ctx context.Context, hash string) (Key, error)
+		ListKeys(ctx context.Context) ([]Key, error)
+		RevokeKey(ctx context.Context, id string, at time.Time) error
+	}
+)
+
+// ValidScope reports whether scope is known
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// New generates an API key with scopes, returning the key in clear, which is never stored, and
+// its stored form
+func New(name string, scopes []string, now time.Time) (string, Key, error) {
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return "", Key{}, fmt.Errorf("%s: %s", errorsmodel.InvalidScope, scope)
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", Key{}, err
+	}
+	plaintext := keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	key := Key{
+		ID:        primitive.NewObjectID().Hex(),
+		Name:      name,
+		Prefix:    plaintext[:displayLength],
+		Hash:      Hash(plaintext),
+		Scopes:    scopes,
+		CreatedAt: now.UTC(),
+	}
+	return plaintext, key, nil
+}
+
+// Hash returns the stored form of a key in clear. The keys carry 256 random bits, so a fast
+// hash is enough to keep a leaked datastore from revealing them.
+func Hash(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// impliedScopes are granted along with a scope. The keys deleted planets with ScopeWrite
+// before ScopeDelete was split from it for the token roles, and they still do.
+var impliedScopes = map[string][]string{
+	ScopeWrite: {ScopeDelete},
+}
+
+// GrantedScopes returns the scopes of the key along with the scopes they imply
+func (k Key) GrantedScopes() []string {
+	granted := make([]string, 0, len(k.Scopes))
+	seen := make(map[string]bool, len(k.Scopes))
+	for _, scope := range k.Scopes {
+		for _, s := range append([]string{scope}, impliedScopes[scope]...) {
+			if !seen[s] {
+				seen[s] = true
+				granted = append(granted, s)
+			}
+		}
+	}
+	return granted
+}
+
+// HasScope reports whether the key was granted scope, directly or implied by another scope
+func (k Key) HasScope(scope string) bool {
+	for _, granted := range k.GrantedScopes() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoked reports whether the key was revoked
+func (k Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
@@ -0,0 +1,278 @@
+package tokens
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minReload bounds how often an unknown key ID triggers a reload of the key set, and how
+	// long a failed reload is not retried
+	minReload = time.Minute
+	// maxJWKSSize bounds the JWKS document read from a file or URL
+	maxJWKSSize = 1 << 20
+)
+
+type (
+	// KeySet holds the public keys of a JWKS document read from a file or an http(s) URL.
+	// The keys are reloaded once refresh elapses, and sooner when a token names an unknown key,
+	// so rotated keys are picked up without a restart. Concurrent reloads share a single fetch,
+	// and a failed one is not retried before minReload.
+	KeySet struct {
+		source  string
+		client  *http.Client
+		refresh time.Duration
+		reloads singleflight.Group
+
+		mu       sync.Mutex
+		keys     map[string]crypto.PublicKey
+		loadedAt time.Time
+		failedAt time.Time
+	}
+
+	// KeySetOption configures a KeySet
+	KeySetOption func(*KeySet)
+
+	jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+)
+
+// WithRefresh sets how long the loaded keys are used before the key set is read again
+func WithRefresh(refresh time.Duration) KeySetOption {
+	return func(ks *KeySet) {
+		ks.refresh = refresh
+	}
+}
+
+// WithHTTPClient sets the client that fetches a JWKS URL
+func WithHTTPClient(client *http.Client) KeySetOption {
+	return func(ks *KeySet) {
+		ks.client = client
+	}
+}
+
+// NewKeySet creates the key set of the JWKS at source, a file path or an http(s) URL
+func NewKeySet(source string, opts ...KeySetOption) *KeySet {
+	ks := &KeySet{
+		source:  source,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		refresh: time.Hour,
+	}
+	for _, opt := range opts {
+		opt(ks)
+	}
+	return ks
+}
+
+// Load reads the key set, failing when it holds no usable signing key
+func (ks *KeySet) Load(ctx context.Context) error {
+	return ks.reload(ctx)
+}
+
+// Key returns the public key with the key ID kid. An empty kid matches the only key of a set
+// holding a single key.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	key, found := ks.lookup(kid)
+	stale := ks.stale(found)
+	ks.mu.Unlock()
+
+	if stale {
+		// the fetch is shared by the concurrent requests, so it is bounded by the timeout of the
+		// client rather than canceled along with the request that started it. The loaded keys
+		// are kept when it fails.
+		err := ks.reload(context.Background())
+		ks.mu.Lock()
+		loaded := ks.keys != nil
+		key, found = ks.lookup(kid)
+		ks.mu.Unlock()
+		if err != nil && !loaded {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// stale reports whether the keys must be reloaded, found telling whether the key looked up was
+// loaded. It must be called with mu held.
+func (ks *KeySet) stale(found bool) bool {
+	if ks.failedAt.After(ks.loadedAt) && time.Since(ks.failedAt) < minReload {
+		return false
+	}
+	age := time.Since(ks.loadedAt)
+	return ks.keys == nil || age > ks.refresh || (!found && age > minReload)
+}
+
+// reload fetches the keys and replaces the loaded ones, sharing the fetch with the concurrent
+// reloads. A failure keeps the loaded keys and is recorded to back off.
+func (ks *KeySet) reload(ctx context.Context) error {
+	_, err, _ := ks.reloads.Do(ks.source, func() (interface{}, error) {
+		keys, err := ks.fetch(ctx)
+
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		if err != nil {
+			ks.failedAt = time.Now()
+			return nil, err
+		}
+		ks.keys = keys
+		ks.loadedAt = time.Now()
+		return nil, nil
+	})
+	return err
+}
+
+// lookup finds the key with the key ID kid. It must be called with mu held.
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// fetch reads the signing keys of the source
+func (ks *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := ks.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load jwks: %s", err.Error())
+	}
+
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("load jwks: %s", err.Error())
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("load jwks: key %q: %s", k.Kid, err.Error())
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("load jwks: no signing keys")
+	}
+	return keys, nil
+}
+
+func (ks *KeySet) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(ks.source, "http://") && !strings.HasPrefix(ks.source, "https://") {
+		return os.ReadFile(ks.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxJWKSSize))
+}
+
+// publicKey decodes an RSA, EC or Ed25519 key, returning nil for the other key types
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,142 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"strings"
+	"time"
+)
+
+// Roles
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+const (
+	// DefaultRolesClaim is the claim the roles are read from unless WithRolesClaim says otherwise
+	DefaultRolesClaim = "roles"
+	// DefaultTenantClaim is the claim the tenant is read from unless WithTenantClaim says otherwise
+	DefaultTenantClaim = "tenant"
+)
+
+// signingMethods are the asymmetric algorithms a token may be signed with
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type (
+	// Identity is the caller a token was issued to
+	Identity struct {
+		Subject string
+		Roles   []string
+		// Tenant is the tenant the token was issued for, empty when it has no tenant claim
+		Tenant string
+	}
+
+	// Verifier validates the signature, issuer, audience and expiry of bearer tokens
+	Verifier struct {
+		keys        *KeySet
+		issuer      string
+		audience    string
+		rolesClaim  []string
+		tenantClaim []string
+		parser      *jwt.Parser
+	}
+
+	// Option configures a Verifier
+	Option func(*Verifier)
+)
+
+// WithRolesClaim reads the roles from claim, a dot separated path such as realm_access.roles
+// for nested claims. The claim holds an array of roles or a space separated string.
+func WithRolesClaim(claim string) Option {
+	return func(v *Verifier) {
+		v.rolesClaim = strings.Split(claim, ".")
+	}
+}
+
+// WithTenantClaim reads the tenant from claim, a dot separated path for nested claims. The claim
+// holds a string.
+func WithTenantClaim(claim string) Option {
+	return func(v *Verifier) {
+		v.tenantClaim = strings.Split(claim, ".")
+	}
+}
+
+// New creates a Verifier accepting the tokens signed by a key of keys, issued by issuer for audience
+func New(keys *KeySet, issuer, audience string, opts ...Option) *Verifier {
+	v := &Verifier{
+		keys:        keys,
+		issuer:      issuer,
+		audience:    audience,
+		rolesClaim:  []string{DefaultRolesClaim},
+		tenantClaim: []string{DefaultTenantClaim},
+		parser:      jwt.NewParser(jwt.WithValidMethods(signingMethods)),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify validates token and returns the identity it was issued to. Tokens must carry an
+// expiry and a subject.
+func (v *Verifier) Verify(ctx context.Context, token string) (Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return Identity{}, fmt.Errorf("verify token: %s", err.Error())
+	}
+
+	switch {
+	case !claims.VerifyExpiresAt(time.Now().Unix(), true):
+		return Identity{}, errors.New("verify token: missing expiry")
+	case !claims.VerifyIssuer(v.issuer, true):
+		return Identity{}, errors.New("verify token: unexpected issuer")
+	case !claims.VerifyAudience(v.audience, true):
+		return Identity{}, errors.New("verify token: unexpected audience")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return Identity{}, errors.New("verify token: missing subject")
+	}
+	tenant, _ := claim(claims, v.tenantClaim).(string)
+	return Identity{Subject: subject, Roles: v.roles(claims), Tenant: tenant}, nil
+}
+
+// claim returns the value of the claim at path, nil when it is missing
+func claim(claims jwt.MapClaims, path []string) interface{} {
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// roles reads the roles claim, ignoring values of any other shape
+func (v *Verifier) roles(claims jwt.MapClaims) []string {
+	switch value := claim(claims, v.rolesClaim).(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		roles := make([]string, 0, len(value))
+		for _, role := range value {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	default:
+		return nil
+	}
+}
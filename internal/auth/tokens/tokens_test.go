@@ -0,0 +1,245 @@
+package tokens_test
+
+import (
+	"context"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens/tokenstest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	signer := tokenstest.NewSigner(t)
+	keys := tokens.NewKeySet(tokenstest.WriteJWKS(t, signer))
+	verifier := tokens.New(keys, tokenstest.Issuer, tokenstest.Audience)
+
+	testCases := []struct {
+		name     string
+		token    func(t *testing.T) string
+		expected tokens.Identity
+		wantErr  bool
+	}{
+		{
+			name: "Valid",
+			token: func(t *testing.T) string {
+				return signer.Token(t, tokenstest.Claims("luke", tokens.RoleReader, tokens.RoleEditor))
+			},
+			expected: tokens.Identity{Subject: "luke", Roles: []string{tokens.RoleReader, tokens.RoleEditor}},
+		},
+		{
+			name: "SpaceSeparatedRoles",
+			token: func(t *testing.T) string {
+				claims := tokenstest.Claims("leia")
+				claims["roles"] = "reader admin"
+				return signer.Token(t, claims)
+			},
+			expected: tokens.Identity{Subject: "leia", Roles: []string{tokens.RoleReader, tokens.RoleAdmin}},
+		},
+		{
+			name: "AudienceList",
+			token: func(t *testing.T) string {
+				claims := tokenstest.Claims("han")
+				claims["aud"] = []string{"other", tokenstest.Audience}
+				return signer.Token(t, claims)
+			},
+			expected: tokens.Identity{Subject: "han"},
+		},
+		{
+			name: "Expired",
+			token: func(t *testing.T) string {
+				claims := tokenstest.Claims("luke", tokens.RoleAdmin)
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return signer.Token(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "MissingExpiry",
+			token: func(t *testing.T) string {
+				claims := tokenstest.Claims("luke", tokens.RoleAdmin)
+				delete(claims, "exp")
+				return signer.Token(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "WrongIssuer",
+			token: func(t *testing.T) string {
+				claims := tokenstest.Claims("luke", tokens.RoleAdmin)
+				claims["iss"] = "https://evil.example.com"
+				return signer.Token(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "WrongAudience",
+			token: func(t *testing.T) string {
+				claims := tokenstest.Claims("luke", tokens.RoleAdmin)
+				claims["aud"] = "other"
+				return signer.Token(t, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "MissingSubject",
+			token: func(t *testing.T) string {
+				return signer.Token(t, tokenstest.Claims("", tokens.RoleAdmin))
+			},
+			wantErr: true,
+		},
+		{
+			name: "UnknownSigner",
+			token: func(t *testing.T) string {
+				return tokenstest.NewSigner(t).Token(t, tokenstest.Claims("luke", tokens.RoleAdmin))
+			},
+			wantErr: true,
+		},
+		{
+			name: "SymmetricAlgorithm",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenstest.Claims("luke", tokens.RoleAdmin))
+				token.Header["kid"] = signer.KeyID
+				signed, err := token.SignedString([]byte("secret"))
+				require.NoError(t, err)
+				return signed
+			},
+			wantErr: true,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := verifier.Verify(context.Background(), tc.token(t))
+			if tc.wantErr {
+				require.Error(t, err)
+				require.Empty(t, identity)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, identity)
+		})
+	}
+}
+
+func TestNestedRolesClaim(t *testing.T) {
+	signer := tokenstest.NewSigner(t)
+	keys := tokens.NewKeySet(tokenstest.WriteJWKS(t, signer))
+	verifier := tokens.New(keys, tokenstest.Issuer, tokenstest.Audience, tokens.WithRolesClaim("realm_access.roles"))
+
+	claims := tokenstest.Claims("luke")
+	claims["realm_access"] = map[string]interface{}{"roles": []string{tokens.RoleEditor}}
+	identity, err := verifier.Verify(context.Background(), signer.Token(t, claims))
+	require.NoError(t, err)
+	require.Equal(t, []string{tokens.RoleEditor}, identity.Roles)
+}
+
+func TestKeySetRotation(t *testing.T) {
+	current, next := tokenstest.NewSigner(t), tokenstest.NewSigner(t)
+	var (
+		jwks     atomic.Value
+		requests int32
+	)
+	jwks.Store(tokenstest.JWKS(t, current))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(jwks.Load().([]byte))
+	}))
+	defer server.Close()
+
+	keys := tokens.NewKeySet(server.URL, tokens.WithRefresh(50*time.Millisecond))
+	require.NoError(t, keys.Load(context.Background()))
+	verifier := tokens.New(keys, tokenstest.Issuer, tokenstest.Audience)
+
+	_, err := verifier.Verify(context.Background(), current.Token(t, tokenstest.Claims("luke")))
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), next.Token(t, tokenstest.Claims("luke")))
+	require.Error(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+
+	jwks.Store(tokenstest.JWKS(t, current, next))
+	time.Sleep(100 * time.Millisecond)
+	_, err = verifier.Verify(context.Background(), next.Token(t, tokenstest.Claims("luke")))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, atomic.LoadInt32(&requests))
+}
+
+func TestKeySetLoadFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`))
+	}))
+	defer server.Close()
+
+	require.Error(t, tokens.NewKeySet(server.URL).Load(context.Background()))
+	require.Error(t, tokens.NewKeySet("missing.json").Load(context.Background()))
+}
+
+func TestTenantClaim(t *testing.T) {
+	signer := tokenstest.NewSigner(t)
+	keys := tokens.NewKeySet(tokenstest.WriteJWKS(t, signer))
+
+	claims := tokenstest.Claims("luke", tokens.RoleReader)
+	claims["tenant"] = "rebels"
+	claims["org"] = map[string]interface{}{"id": "alliance"}
+	token := signer.Token(t, claims)
+
+	identity, err := tokens.New(keys, tokenstest.Issuer, tokenstest.Audience).Verify(context.Background(), token)
+	require.NoError(t, err)
+	require.Equal(t, "rebels", identity.Tenant)
+
+	nested := tokens.New(keys, tokenstest.Issuer, tokenstest.Audience, tokens.WithTenantClaim("org.id"))
+	identity, err = nested.Verify(context.Background(), token)
+	require.NoError(t, err)
+	require.Equal(t, "alliance", identity.Tenant)
+}
+
+func TestKeySetOutage(t *testing.T) {
+	signer := tokenstest.NewSigner(t)
+	var (
+		down     int32
+		requests int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(tokenstest.JWKS(t, signer))
+	}))
+	defer server.Close()
+
+	keys := tokens.NewKeySet(server.URL, tokens.WithRefresh(10*time.Millisecond))
+	require.NoError(t, keys.Load(context.Background()))
+	verifier := tokens.New(keys, tokenstest.Issuer, tokenstest.Audience)
+	token := signer.Token(t, tokenstest.Claims("luke"))
+
+	atomic.StoreInt32(&down, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	// the stale keys keep verifying tokens while a single reload fails, and it is not retried
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = verifier.Verify(context.Background(), token)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	_, err := verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,82 @@
+// Package tokenstest issues signed tokens and serves their JWKS for the tests of the
+// bearer token authentication.
+package tokenstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	Issuer   = "https://sso.example.com"
+	Audience = "sw-planets"
+)
+
+// Signer signs ES256 tokens with a key of its own
+type Signer struct {
+	KeyID string
+	key   *ecdsa.PrivateKey
+}
+
+// NewSigner creates a signer with a random P-256 key
+func NewSigner(t *testing.T) *Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &Signer{KeyID: random.String(8), key: key}
+}
+
+// JWKS returns a JWKS document holding the public keys of signers
+func JWKS(t *testing.T, signers ...*Signer) []byte {
+	keys := make([]map[string]string, 0, len(signers))
+	for _, s := range signers {
+		keys = append(keys, map[string]string{
+			"kty": "EC",
+			"kid": s.KeyID,
+			"use": "sig",
+			"alg": "ES256",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(s.key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(s.key.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+	return data
+}
+
+// WriteJWKS writes the JWKS of signers to a temporary file and returns its path
+func WriteJWKS(t *testing.T, signers ...*Signer) string {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, JWKS(t, signers...), 0o600))
+	return path
+}
+
+// Claims returns valid claims for Issuer and Audience, issued to subject with roles
+func Claims(subject string, roles ...string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   Issuer,
+		"aud":   Audience,
+		"sub":   subject,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": roles,
+	}
+}
+
+// Token signs claims
+func (s *Signer) Token(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = s.KeyID
+	signed, err := token.SignedString(s.key)
+	require.NoError(t, err)
+	return signed
+}
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens"
+	planetsfactory "github.com/gmaschi/b2w-sw-planets/internal/factories/planets-factory"
+	tenantmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/tenant"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	sqlstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/sql/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/tracing"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// minBootstrapKeyLength keeps the bootstrap key as hard to guess as a generated one
+const minBootstrapKeyLength = 32
+
+// Store backends
+const (
+	MongoDBBackend = "mongodb"
+	SQLBackend     = "sql"
+	BoltBackend    = "bolt"
+	MemoryBackend  = "memory"
+)
+
+// Every leaf field is read from the config file by its yaml/toml key, from the
+// SW_PLANETS_<env> environment variable and from the -<flag> command line flag.
+// Fields tagged with redact are hidden by Redacted: "all" hides the whole value,
+// "password" only the password of a connection string.
+type (
+	Config struct {
+		Server      Server      `yaml:"server" toml:"server"`
+		Store       Store       `yaml:"store" toml:"store"`
+		Mongo       Mongo       `yaml:"mongo" toml:"mongo"`
+		SQL         SQL         `yaml:"sql" toml:"sql"`
+		Bolt        Bolt        `yaml:"bolt" toml:"bolt"`
+		Tenancy     Tenancy     `yaml:"tenancy" toml:"tenancy"`
+		Auth        Auth        `yaml:"auth" toml:"auth"`
+		RateLimit   RateLimit   `yaml:"rate_limit" toml:"rate_limit"`
+		Idempotency Idempotency `yaml:"idempotency" toml:"idempotency"`
+		SWAPI       SWAPI       `yaml:"swapi" toml:"swapi"`
+		Health      Health      `yaml:"health" toml:"health"`
+		Metrics     Metrics     `yaml:"metrics" toml:"metrics"`
+		Tracing     Tracing     `yaml:"tracing" toml:"tracing"`
+		Log         Log         `yaml:"log" toml:"log"`
+	}
+
+	Server struct {
+		Address string `yaml:"address" toml:"address" env:"SERVER_ADDRESS" flag:"address" usage:"address the API listens on"`
+		GinMode string `yaml:"gin_mode" toml:"gin_mode" env:"GIN_MODE" flag:"gin-mode" usage:"gin mode: debug, release or test"`
+
+		ReadHeaderTimeout   time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" flag:"read-header-timeout" usage:"time allowed to read request headers"`
+		ReadTimeout         time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT" flag:"read-timeout" usage:"time allowed to read a whole request"`
+		WriteTimeout        time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" flag:"write-timeout" usage:"time allowed to write a response"`
+		StreamTimeout       time.Duration `yaml:"stream_timeout" toml:"stream_timeout" env:"SERVER_STREAM_TIMEOUT" flag:"stream-timeout" usage:"time allowed to read a planets import or write a planets export or list, replacing the read and write timeouts, 0 for no timeout"`
+		IdleTimeout         time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" flag:"idle-timeout" usage:"time a keep-alive connection may stay idle"`
+		ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period" toml:"shutdown_grace_period" env:"SERVER_SHUTDOWN_GRACE_PERIOD" flag:"shutdown-grace-period" usage:"time in-flight requests get to finish on SIGINT/SIGTERM"`
+
+		MaxImportBytes int `yaml:"max_import_bytes" toml:"max_import_bytes" env:"SERVER_MAX_IMPORT_BYTES" flag:"max-import-bytes" usage:"largest body of a planets import, 0 for no limit"`
+		MaxBatchBytes  int `yaml:"max_batch_bytes" toml:"max_batch_bytes" env:"SERVER_MAX_BATCH_BYTES" flag:"max-batch-bytes" usage:"largest body of a planets batch, 0 for no limit"`
+
+		TrustedProxies string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma separated IPs or CIDRs of the proxies whose X-Forwarded-For is trusted for the client IP"`
+	}
+
+	Store struct {
+		Backend string `yaml:"backend" toml:"backend" env:"STORE" flag:"store" usage:"planets store backend: mongodb, sql, bolt or memory"`
+	}
+
+	Mongo struct {
+		URI            string        `yaml:"uri" toml:"uri" env:"MONGO_URI" flag:"mongo-uri" usage:"mongodb connection string" redact:"password"`
+		Database       string        `yaml:"database" toml:"database" env:"MONGO_DATABASE" flag:"mongo-database" usage:"mongodb database name"`
+		Collection     string        `yaml:"collection" toml:"collection" env:"MONGO_COLLECTION" flag:"mongo-collection" usage:"mongodb planets collection name"`
+		ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"MONGO_CONNECT_TIMEOUT" flag:"mongo-connect-timeout" usage:"timeout to connect to mongodb and run startup migrations"`
+		Migrate        bool          `yaml:"migrate" toml:"migrate" env:"MONGO_MIGRATE" flag:"migrate" usage:"apply pending mongodb migrations before serving"`
+	}
+
+	SQL struct {
+		Dialect string `yaml:"dialect" toml:"dialect" env:"SQL_DIALECT" flag:"sql-dialect" usage:"sql store dialect: sqlite3 or postgres"`
+		DSN     string `yaml:"dsn" toml:"dsn" env:"SQL_DSN" flag:"sql-dsn" usage:"sql store data source name" redact:"password"`
+	}
+
+	Bolt struct {
+		Path string `yaml:"path" toml:"path" env:"BOLT_PATH" flag:"bolt-path" usage:"bolt store file path"`
+	}
+
+	Tenancy struct {
+		Mode   string `yaml:"mode" toml:"mode" env:"TENANCY" flag:"tenancy" usage:"tenant isolation for the mongodb store: none, database or filter"`
+		Header string `yaml:"header" toml:"header" env:"TENANT_HEADER" flag:"tenant-header" usage:"request header naming the tenant"`
+	}
+
+	Auth struct {
+		APIKeys      bool   `yaml:"api_keys" toml:"api_keys" env:"AUTH_API_KEYS" flag:"auth-api-keys" usage:"require an API key on the planets routes and serve the admin API key routes"`
+		BootstrapKey string `yaml:"bootstrap_key" toml:"bootstrap_key" env:"AUTH_BOOTSTRAP_KEY" flag:"auth-bootstrap-key" usage:"API key with every scope, to create the first keys" redact:"all"`
+
+		JWKS        string        `yaml:"jwks" toml:"jwks" env:"AUTH_JWKS" flag:"auth-jwks" usage:"JWKS file or http(s) URL validating bearer tokens on the planets routes, empty to disable them"`
+		JWKSRefresh time.Duration `yaml:"jwks_refresh" toml:"jwks_refresh" env:"AUTH_JWKS_REFRESH" flag:"auth-jwks-refresh" usage:"how long the JWKS keys are used before reloading them"`
+		Issuer      string        `yaml:"issuer" toml:"issuer" env:"AUTH_ISSUER" flag:"auth-issuer" usage:"required iss claim of the bearer tokens"`
+		Audience    string        `yaml:"audience" toml:"audience" env:"AUTH_AUDIENCE" flag:"auth-audience" usage:"required aud claim of the bearer tokens"`
+		RolesClaim  string        `yaml:"roles_claim" toml:"roles_claim" env:"AUTH_ROLES_CLAIM" flag:"auth-roles-claim" usage:"claim holding the reader, editor and admin roles, dot separated when nested"`
+		TenantClaim string        `yaml:"tenant_claim" toml:"tenant_claim" env:"AUTH_TENANT_CLAIM" flag:"auth-tenant-claim" usage:"claim holding the tenant of the bearer tokens, dot separated when nested"`
+	}
+
+	RateLimit struct {
+		Enabled bool          `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT" flag:"rate-limit" usage:"limit the planets requests of each API key, token subject or client IP"`
+		Backend string        `yaml:"backend" toml:"backend" env:"RATE_LIMIT_BACKEND" flag:"rate-limit-backend" usage:"where the rate limits are kept: memory (per replica) or mongodb (shared by the replicas)"`
+		Period  time.Duration `yaml:"period" toml:"period" env:"RATE_LIMIT_PERIOD" flag:"rate-limit-period" usage:"period the read and write limits are refilled over"`
+		Read    int           `yaml:"read" toml:"read" env:"RATE_LIMIT_READ" flag:"rate-limit-read" usage:"GET requests allowed per period"`
+		Write   int           `yaml:"write" toml:"write" env:"RATE_LIMIT_WRITE" flag:"rate-limit-write" usage:"POST and DELETE requests allowed per period, each planet of a batch or import counting as one"`
+		IP      int           `yaml:"ip" toml:"ip" env:"RATE_LIMIT_IP" flag:"rate-limit-ip" usage:"requests allowed per period from each client IP before the authentication, 0 for no limit"`
+	}
+
+	Idempotency struct {
+		Enabled bool          `yaml:"enabled" toml:"enabled" env:"IDEMPOTENCY" flag:"idempotency" usage:"replay the response of POST /v1/planets to the retries with the same Idempotency-Key"`
+		Backend string        `yaml:"backend" toml:"backend" env:"IDEMPOTENCY_BACKEND" flag:"idempotency-backend" usage:"where the idempotency keys are kept: memory (per replica) or mongodb (shared by the replicas)"`
+		TTL     time.Duration `yaml:"ttl" toml:"ttl" env:"IDEMPOTENCY_TTL" flag:"idempotency-ttl" usage:"how long a response is replayed for its idempotency key"`
+	}
+
+	SWAPI struct {
+		BaseURL string        `yaml:"base_url" toml:"base_url" env:"SWAPI_BASE_URL" flag:"swapi-base-url" usage:"SWAPI planets endpoint"`
+		Timeout time.Duration `yaml:"timeout" toml:"timeout" env:"SWAPI_TIMEOUT" flag:"swapi-timeout" usage:"timeout of each SWAPI request"`
+	}
+
+	Health struct {
+		Timeout       time.Duration `yaml:"timeout" toml:"timeout" env:"HEALTH_TIMEOUT" flag:"health-timeout" usage:"timeout of each readiness check"`
+		SWAPICritical bool          `yaml:"swapi_critical" toml:"swapi_critical" env:"HEALTH_SWAPI_CRITICAL" flag:"health-swapi-critical" usage:"report not ready while SWAPI is unreachable"`
+		SWAPITTL      time.Duration `yaml:"swapi_ttl" toml:"swapi_ttl" env:"HEALTH_SWAPI_TTL" flag:"health-swapi-ttl" usage:"how long the readiness checks reuse the last SWAPI check, 0 to check on every probe"`
+	}
+
+	Metrics struct {
+		Enabled bool   `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED" flag:"metrics" usage:"expose prometheus metrics"`
+		Path    string `yaml:"path" toml:"path" env:"METRICS_PATH" flag:"metrics-path" usage:"route serving the prometheus metrics"`
+	}
+
+	Tracing struct {
+		Exporter     string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" usage:"span exporter: none, stdout, file or otlp"`
+		ServiceName  string `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME" flag:"tracing-service-name" usage:"service name of the spans"`
+		OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" flag:"tracing-otlp-endpoint" usage:"host:port of the OTLP/HTTP collector"`
+		OTLPInsecure bool   `yaml:"otlp_insecure" toml:"otlp_insecure" env:"TRACING_OTLP_INSECURE" flag:"tracing-otlp-insecure" usage:"send spans to the collector over plain HTTP"`
+		File         string `yaml:"file" toml:"file" env:"TRACING_FILE" flag:"tracing-file" usage:"file receiving the spans with the file exporter"`
+	}
+
+	Log struct {
+		Level         string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"log level: debug, info, warn or error"`
+		RedactHeaders string `yaml:"redact_headers" toml:"redact_headers" env:"LOG_REDACT_HEADERS" flag:"log-redact-headers" usage:"comma separated request headers hidden from the logs, besides Authorization, Cookie and API keys"`
+	}
+)
+
+// Default returns the configuration used when nothing overrides it
+func Default() Config {
+	return Config{
+		Server: Server{
+			Address: "0.0.0.0:8080",
+			GinMode: gin.DebugMode,
+
+			ReadHeaderTimeout:   5 * time.Second,
+			ReadTimeout:         15 * time.Second,
+			WriteTimeout:        30 * time.Second,
+			StreamTimeout:       10 * time.Minute,
+			IdleTimeout:         time.Minute,
+			ShutdownGracePeriod: 20 * time.Second,
+
+			MaxImportBytes: 64 << 20,
+			MaxBatchBytes:  planetsfactory.DefaultBatchBodyLimit,
+		},
+		Store: Store{
+			Backend: MongoDBBackend,
+		},
+		Mongo: Mongo{
+			URI:            "mongodb://localhost:27017",
+			Database:       planetsdb.DefaultDatabaseName,
+			Collection:     planetsdb.DefaultPlanetsCollectionName,
+			ConnectTimeout: time.Minute,
+		},
+		SQL: SQL{
+			Dialect: string(sqlstore.SQLite),
+			DSN:     "planets.db",
+		},
+		Bolt: Bolt{
+			Path: "planets.bolt",
+		},
+		Tenancy: Tenancy{
+			Mode:   string(planetsdb.NoTenancy),
+			Header: tenantmiddleware.DefaultHeader,
+		},
+		Auth: Auth{
+			JWKSRefresh: time.Hour,
+			RolesClaim:  tokens.DefaultRolesClaim,
+			TenantClaim: tokens.DefaultTenantClaim,
+		},
+		RateLimit: RateLimit{
+			Backend: MemoryBackend,
+			Period:  time.Minute,
+			Read:    600,
+			Write:   60,
+			IP:      1200,
+		},
+		Idempotency: Idempotency{
+			Enabled: true,
+			Backend: MemoryBackend,
+			TTL:     24 * time.Hour,
+		},
+		SWAPI: SWAPI{
+			BaseURL: "https://swapi.dev/api/planets/",
+			Timeout: 10 * time.Second,
+		},
+		Health: Health{
+			Timeout:       2 * time.Second,
+			SWAPICritical: true,
+			SWAPITTL:      30 * time.Second,
+		},
+		Metrics: Metrics{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Tracing: Tracing{
+			Exporter:     tracing.NoExporter,
+			ServiceName:  "sw-planets",
+			OTLPEndpoint: "localhost:4318",
+			File:         "traces.json",
+		},
+		Log: Log{
+			Level: "info",
+		},
+	}
+}
+
+// Validate reports the first invalid setting
+func (c Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Server.Address); err != nil {
+		return fmt.Errorf("server address %q: %s", c.Server.Address, err.Error())
+	}
+	for _, timeout := range []time.Duration{c.Server.ReadHeaderTimeout, c.Server.ReadTimeout, c.Server.WriteTimeout, c.Server.StreamTimeout, c.Server.IdleTimeout} {
+		if timeout < 0 {
+			return fmt.Errorf("server timeouts must not be negative")
+		}
+	}
+	if c.Server.MaxImportBytes < 0 || c.Server.MaxBatchBytes < 0 {
+		return fmt.Errorf("server max import and batch bytes must not be negative")
+	}
+	if c.Server.ShutdownGracePeriod <= 0 {
+		return fmt.Errorf("server shutdown grace period must be positive")
+	}
+	for _, proxy := range SplitList(c.Server.TrustedProxies) {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+		}
+	}
+	switch c.Server.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		return fmt.Errorf("unsupported gin mode %q", c.Server.GinMode)
+	}
+
+	switch c.Store.Backend {
+	case MongoDBBackend:
+		uri, err := url.Parse(c.Mongo.URI)
+		if err != nil || (uri.Scheme != "mongodb" && uri.Scheme != "mongodb+srv") {
+			return fmt.Errorf("invalid mongodb uri")
+		}
+		if c.Mongo.Database == "" || c.Mongo.Collection == "" {
+			return fmt.Errorf("mongodb database and collection are required")
+		}
+		if c.Mongo.ConnectTimeout <= 0 {
+			return fmt.Errorf("mongodb connect timeout must be positive")
+		}
+	case SQLBackend:
+		if _, err := sqlstore.ParseDialect(c.SQL.Dialect); err != nil {
+			return err
+		}
+		if c.SQL.DSN == "" {
+			return fmt.Errorf("sql dsn is required")
+		}
+	case BoltBackend:
+		if c.Bolt.Path == "" {
+			return fmt.Errorf("bolt path is required")
+		}
+	case MemoryBackend:
+	default:
+		return fmt.Errorf("unknown store backend %q", c.Store.Backend)
+	}
+
+	tenancy, err := planetsdb.ParseTenancy(c.Tenancy.Mode)
+	if err != nil {
+		return err
+	}
+	if tenancy != planetsdb.NoTenancy {
+		if c.Store.Backend != MongoDBBackend {
+			return fmt.Errorf("tenant isolation is only supported by the mongodb store")
+		}
+		if c.Tenancy.Header == "" {
+			return fmt.Errorf("tenant header is required")
+		}
+	}
+
+	if c.Auth.BootstrapKey != "" && len(c.Auth.BootstrapKey) < minBootstrapKeyLength {
+		return fmt.Errorf("auth bootstrap key must have at least %d characters", minBootstrapKeyLength)
+	}
+	if c.Auth.JWKS != "" {
+		if c.Auth.Issuer == "" || c.Auth.Audience == "" {
+			return fmt.Errorf("auth issuer and audience are required with a jwks")
+		}
+		if c.Auth.JWKSRefresh <= 0 {
+			return fmt.Errorf("auth jwks refresh must be positive")
+		}
+		if c.Auth.RolesClaim == "" {
+			return fmt.Errorf("auth roles claim must not be empty")
+		}
+	}
+
+	if c.RateLimit.Enabled {
+		switch c.RateLimit.Backend {
+		case MemoryBackend:
+		case MongoDBBackend:
+			if c.Store.Backend != MongoDBBackend {
+				return fmt.Errorf("the mongodb rate limit backend requires the mongodb store")
+			}
+		default:
+			return fmt.Errorf("unknown rate limit backend %q", c.RateLimit.Backend)
+		}
+		if c.RateLimit.Period <= 0 || c.RateLimit.Read <= 0 || c.RateLimit.Write <= 0 {
+			return fmt.Errorf("rate limit period, read and write must be positive")
+		}
+		if c.RateLimit.IP < 0 {
+			return fmt.Errorf("rate limit ip must not be negative")
+		}
+	}
+
+	if c.Idempotency.Enabled {
+		switch c.Idempotency.Backend {
+		case MemoryBackend:
+		case MongoDBBackend:
+			if c.Store.Backend != MongoDBBackend {
+				return fmt.Errorf("the mongodb idempotency backend requires the mongodb store")
+			}
+		default:
+			return fmt.Errorf("unknown idempotency backend %q", c.Idempotency.Backend)
+		}
+		if c.Idempotency.TTL <= 0 {
+			return fmt.Errorf("idempotency ttl must be positive")
+		}
+	}
+
+	swapiURL, err := url.Parse(c.SWAPI.BaseURL)
+	if err != nil || (swapiURL.Scheme != "http" && swapiURL.Scheme != "https") || swapiURL.Host == "" {
+		return fmt.Errorf("invalid swapi base url %q", c.SWAPI.BaseURL)
+	}
+	if c.SWAPI.Timeout <= 0 {
+		return fmt.Errorf("swapi timeout must be positive")
+	}
+
+	if c.Health.Timeout <= 0 {
+		return fmt.Errorf("health timeout must be positive")
+	}
+	if c.Health.SWAPITTL < 0 {
+		return fmt.Errorf("health swapi ttl must not be negative")
+	}
+
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		return fmt.Errorf("metrics path %q must start with /", c.Metrics.Path)
+	}
+
+	if _, err := tracing.ParseExporter(c.Tracing.Exporter); err != nil {
+		return err
+	}
+	if c.Tracing.Exporter != tracing.NoExporter && c.Tracing.ServiceName == "" {
+		return fmt.Errorf("tracing service name is required")
+	}
+	if c.Tracing.Exporter == tracing.OTLPExporter {
+		if _, _, err := net.SplitHostPort(c.Tracing.OTLPEndpoint); err != nil {
+			return fmt.Errorf("tracing otlp endpoint %q: %s", c.Tracing.OTLPEndpoint, err.Error())
+		}
+	}
+	if c.Tracing.Exporter == tracing.FileExporter && c.Tracing.File == "" {
+		return fmt.Errorf("tracing file is required")
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unsupported log level %q", c.Log.Level)
+	}
+	return nil
+}
+
+// SplitList splits a comma separated setting, dropping the empty items
+func SplitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
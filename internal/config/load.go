@@ -0,0 +1,185 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variable of every setting
+const EnvPrefix = "SW_PLANETS_"
+
+type (
+	// Command is what the binary was asked to do besides serving with the configuration
+	Command struct {
+		// Name is the first positional argument, empty to serve the API
+		Name string
+		// PrintConfig asks to print the redacted configuration and exit
+		PrintConfig bool
+	}
+
+	// field is a configurable leaf of Config
+	field struct {
+		value  reflect.Value
+		env    string
+		flag   string
+		usage  string
+		redact string
+	}
+
+	// flagValue records the raw value of a flag, so flags are applied after the file and the environment
+	flagValue struct {
+		raw    map[string]string
+		name   string
+		isBool bool
+	}
+)
+
+func (fv *flagValue) String() string {
+	return ""
+}
+
+func (fv *flagValue) Set(value string) error {
+	fv.raw[fv.name] = value
+	return nil
+}
+
+func (fv *flagValue) IsBoolFlag() bool {
+	return fv.isBool
+}
+
+// Load builds the configuration from the defaults, then the config file, then the environment
+// and then the command line flags, and validates the result. lookupEnv is usually os.LookupEnv.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, Command, error) {
+	cfg := Default()
+	fields := leafFields(reflect.ValueOf(&cfg).Elem())
+
+	fs := flag.NewFlagSet("b2w-sw-planets", flag.ContinueOnError)
+	configPath := fs.String("config", "", "YAML or TOML config file (env "+EnvPrefix+"CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+	rawFlags := make(map[string]string)
+	for _, f := range fields {
+		fv := &flagValue{raw: rawFlags, name: f.flag, isBool: f.value.Kind() == reflect.Bool}
+		fs.Var(fv, f.flag, fmt.Sprintf("%s (env %s%s, default %v)", f.usage, EnvPrefix, f.env, f.value.Interface()))
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, Command{}, err
+	}
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, Command{}, fmt.Errorf("config file %s: %s", path, err.Error())
+		}
+	}
+
+	for _, f := range fields {
+		value, ok := lookupEnv(EnvPrefix + f.env)
+		if !ok {
+			continue
+		}
+		if err := setValue(f.value, value); err != nil {
+			return Config{}, Command{}, fmt.Errorf("env %s%s: %s", EnvPrefix, f.env, err.Error())
+		}
+	}
+
+	for _, f := range fields {
+		value, ok := rawFlags[f.flag]
+		if !ok {
+			continue
+		}
+		if err := setValue(f.value, value); err != nil {
+			return Config{}, Command{}, fmt.Errorf("flag -%s: %s", f.flag, err.Error())
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, Command{}, fmt.Errorf("invalid config: %s", err.Error())
+	}
+
+	return cfg, Command{Name: fs.Arg(0), PrintConfig: *printConfig}, nil
+}
+
+// loadFile decodes a YAML or TOML file over cfg, rejecting unknown keys
+func loadFile(path string, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return yaml.UnmarshalStrict(data, cfg)
+	case ".toml":
+		md, err := toml.DecodeFile(path, cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown key %s", undecoded[0])
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported config file extension %q", filepath.Ext(path))
+	}
+}
+
+// leafFields lists the settings of a config struct in declaration order
+func leafFields(v reflect.Value) []field {
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		if structField.Type.Kind() == reflect.Struct {
+			fields = append(fields, leafFields(v.Field(i))...)
+			continue
+		}
+		fields = append(fields, field{
+			value:  v.Field(i),
+			env:    structField.Tag.Get("env"),
+			flag:   structField.Tag.Get("flag"),
+			usage:  structField.Tag.Get("usage"),
+			redact: structField.Tag.Get("redact"),
+		})
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into the setting v
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"gopkg.in/yaml.v2"
+	"net/url"
+	"reflect"
+	"regexp"
+)
+
+const redacted = "REDACTED"
+
+var passwordParam = regexp.MustCompile(`(?i)(password=)[^\s&;]*`)
+
+// Redacted returns a copy of the configuration with its secrets hidden
+func (c Config) Redacted() Config {
+	for _, f := range leafFields(reflect.ValueOf(&c).Elem()) {
+		if f.value.Kind() != reflect.String || f.value.String() == "" {
+			continue
+		}
+		switch f.redact {
+		case "all":
+			f.value.SetString(redacted)
+		case "password":
+			f.value.SetString(redactPassword(f.value.String()))
+		}
+	}
+	return c
+}
+
+// YAML renders the redacted configuration in the config file format
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c.Redacted())
+}
+
+// redactPassword hides the password of a URL or of a key=value connection string
+func redactPassword(connection string) string {
+	if u, err := url.Parse(connection); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			return u.String()
+		}
+		return connection
+	}
+	return passwordParam.ReplaceAllString(connection, "${1}"+redacted)
+}
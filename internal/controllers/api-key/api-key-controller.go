@@ -0,0 +1,168 @@
+package apikeycontroller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	authmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/auth"
+	apikeymodel "github.com/gmaschi/b2w-sw-planets/internal/models/api-key"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	"github.com/gmaschi/b2w-sw-planets/internal/tenancy"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Controller struct {
+	keys apikeys.Store
+	now  func() time.Time
+}
+
+// New creates a pointer to a Controller
+func New(keys apikeys.Store) *Controller {
+	return &Controller{
+		keys: keys,
+		now:  time.Now,
+	}
+}
+
+// Create handles the request to issue a new API key. The key is only returned in clear here.
+// Callers bound to a tenant issue keys for their own tenant only.
+func (c *Controller) Create(ctx *gin.Context) {
+	var req apikeymodel.CreateRequest
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		negotiate.Render(ctx, http.StatusBadRequest, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+
+	if req.Tenant != "" && !tenancy.ValidID(req.Tenant) {
+		negotiate.Render(ctx, http.StatusBadRequest, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.InvalidTenantID)))
+		return
+	}
+	tenant := boundTenant(ctx)
+	if tenant != "" && req.Tenant != "" && req.Tenant != tenant {
+		negotiate.Render(ctx, http.StatusForbidden, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.TenantMismatch)))
+		return
+	}
+	if tenant == "" {
+		tenant = req.Tenant
+	}
+	plaintext, key, err := apikeys.New(req.Name, req.Scopes, c.now())
+	if err != nil {
+		negotiate.Render(ctx, http.StatusBadRequest, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+	key.Tenant = tenant
+	if err := c.keys.CreateKey(ctx.Request.Context(), key); err != nil {
+		negotiate.Render(ctx, http.StatusInternalServerError, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+
+	negotiate.Render(ctx, http.StatusCreated, apikeymodel.CreateResponse{
+		KeyResponse: keyResponse(key),
+		Key:         plaintext,
+	})
+}
+
+// List handles the request to list the API keys, revoked ones included. Callers bound to a
+// tenant only see the keys of their tenant.
+func (c *Controller) List(ctx *gin.Context) {
+	keys, err := c.tenantKeys(ctx)
+	if err != nil {
+		negotiate.Render(ctx, http.StatusInternalServerError, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+
+	res := make([]apikeymodel.KeyResponse, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, keyResponse(key))
+	}
+	negotiate.Render(ctx, http.StatusOK, res)
+}
+
+// Revoke handles the request to revoke an API key based on the ID. Callers bound to a tenant
+// only revoke the keys of their tenant, the others are reported missing.
+func (c *Controller) Revoke(ctx *gin.Context) {
+	var req apikeymodel.RevokeRequest
+
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		negotiate.Render(ctx, http.StatusBadRequest, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+
+	err := c.ownKey(ctx, req.ID)
+	if err == nil {
+		err = c.keys.RevokeKey(ctx.Request.Context(), req.ID, c.now())
+	}
+	if err != nil {
+		if strings.HasSuffix(err.Error(), errorsmodel.APIKeyDoesNotExist) {
+			negotiate.Render(ctx, http.StatusNotFound, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+			return
+		}
+		negotiate.Render(ctx, http.StatusInternalServerError, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+
+	negotiate.Render(ctx, http.StatusOK, fmt.Sprintf("api key with id %s revoked", req.ID))
+}
+
+// boundTenant returns the tenant the credentials of the request are bound to, empty for none
+func boundTenant(ctx *gin.Context) string {
+	principal, _ := authmiddleware.PrincipalFromContext(ctx)
+	return principal.Tenant
+}
+
+// tenantKeys lists the API keys the caller manages: all of them for unbound callers, the keys
+// of their tenant otherwise
+func (c *Controller) tenantKeys(ctx *gin.Context) ([]apikeys.Key, error) {
+	keys, err := c.keys.ListKeys(ctx.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	tenant := boundTenant(ctx)
+	if tenant == "" {
+		return keys, nil
+	}
+	owned := make([]apikeys.Key, 0, len(keys))
+	for _, key := range keys {
+		if key.Tenant == tenant {
+			owned = append(owned, key)
+		}
+	}
+	return owned, nil
+}
+
+// ownKey checks the caller manages the API key with the given ID
+func (c *Controller) ownKey(ctx *gin.Context, id string) error {
+	if boundTenant(ctx) == "" {
+		return nil
+	}
+
+	keys, err := c.tenantKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("revoke API key: %s", errorsmodel.APIKeyDoesNotExist)
+}
+
+func keyResponse(key apikeys.Key) apikeymodel.KeyResponse {
+	return apikeymodel.KeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		Tenant:    key.Tenant,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
@@ -0,0 +1,235 @@
+package apikeycontroller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	planetsfactory "github.com/gmaschi/b2w-sw-planets/internal/factories/planets-factory"
+	authmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/auth"
+	tenantmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/tenant"
+	apikeymodel "github.com/gmaschi/b2w-sw-planets/internal/models/api-key"
+	memorystore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/memory/planets-db"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const bootstrapKey = "bootstrap-bootstrap-bootstrap-bootstrap"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// TestKeyLifecycle creates, uses, lists and revokes an API key through the admin routes
+func TestKeyLifecycle(t *testing.T) {
+	server, err := planetsfactory.New(memorystore.NewStore(nil),
+		planetsfactory.WithAPIKeys(memorystore.NewKeyStore(), authmiddleware.WithBootstrapKey(bootstrapKey)),
+	)
+	require.NoError(t, err)
+
+	recorder := serve(t, server, http.MethodPost, "/v1/admin/api-keys", bootstrapKey, map[string]interface{}{
+		"name":   "reader",
+		"scopes": []string{apikeys.ScopeRead},
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var created apikeymodel.CreateResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.Equal(t, "reader", created.Name)
+	require.Equal(t, []string{apikeys.ScopeRead}, created.Scopes)
+	require.Equal(t, created.Prefix, created.Key[:len(created.Prefix)])
+	require.NotContains(t, recorder.Body.String(), apikeys.Hash(created.Key))
+
+	// the new key reads planets but can neither write them nor manage keys
+	recorder = serve(t, server, http.MethodDelete, "/v1/planets/61f1a1b2c3d4e5f6a7b8c9d0", created.Key, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = serve(t, server, http.MethodGet, "/v1/admin/api-keys", created.Key, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = serve(t, server, http.MethodGet, "/v1/planets", created.Key, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serve(t, server, http.MethodGet, "/v1/admin/api-keys", bootstrapKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var listed []apikeymodel.KeyResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	require.Equal(t, created.KeyResponse, listed[0])
+
+	recorder = serve(t, server, http.MethodDelete, "/v1/admin/api-keys/"+created.ID, bootstrapKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = serve(t, server, http.MethodGet, "/v1/planets", created.Key, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = serve(t, server, http.MethodDelete, "/v1/admin/api-keys/61f1a1b2c3d4e5f6a7b8c9d0", bootstrapKey, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCreateInvalidScope(t *testing.T) {
+	server, err := planetsfactory.New(memorystore.NewStore(nil),
+		planetsfactory.WithAPIKeys(memorystore.NewKeyStore(), authmiddleware.WithBootstrapKey(bootstrapKey)),
+	)
+	require.NoError(t, err)
+
+	recorder := serve(t, server, http.MethodPost, "/v1/admin/api-keys", bootstrapKey, map[string]interface{}{
+		"name":   "root",
+		"scopes": []string{"planets:*"},
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func serve(t *testing.T, server *planetsfactory.Factory, method, url, key string, body interface{}) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	require.NoError(t, err)
+	req.Header.Set(authmiddleware.APIKeyHeader, key)
+
+	recorder := httptest.NewRecorder()
+	server.Router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// TestTenantBoundKey checks the planets routes are reached in the tenant a key is bound to only
+func TestTenantBoundKey(t *testing.T) {
+	server, err := planetsfactory.New(memorystore.NewStore(nil),
+		planetsfactory.WithAPIKeys(memorystore.NewKeyStore(), authmiddleware.WithBootstrapKey(bootstrapKey)),
+		planetsfactory.WithPlanetsMiddleware(tenantmiddleware.Bound(
+			tenantmiddleware.FromContextKey(authmiddleware.TenantKey), tenantmiddleware.DefaultHeader,
+		)),
+	)
+	require.NoError(t, err)
+
+	recorder := serve(t, server, http.MethodPost, "/v1/admin/api-keys", bootstrapKey, map[string]interface{}{
+		"name":   "rebels",
+		"scopes": []string{apikeys.ScopeRead},
+		"tenant": "rebels",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var bound apikeymodel.CreateResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bound))
+	require.Equal(t, "rebels", bound.Tenant)
+
+	recorder = serve(t, server, http.MethodPost, "/v1/admin/api-keys", bootstrapKey, map[string]interface{}{
+		"name":   "unbound",
+		"scopes": []string{apikeys.ScopeRead},
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var unbound apikeymodel.CreateResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &unbound))
+
+	testCases := []struct {
+		name         string
+		key          string
+		tenant       string
+		expectedCode int
+	}{
+		{name: "BoundTenant", key: bound.Key, expectedCode: http.StatusNotFound},
+		{name: "MatchingHeader", key: bound.Key, tenant: "rebels", expectedCode: http.StatusNotFound},
+		{name: "OtherTenantHeader", key: bound.Key, tenant: "empire", expectedCode: http.StatusForbidden},
+		{name: "Unbound", key: unbound.Key, tenant: "rebels", expectedCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/planets", nil)
+			require.NoError(t, err)
+			req.Header.Set(authmiddleware.APIKeyHeader, tc.key)
+			if tc.tenant != "" {
+				req.Header.Set(tenantmiddleware.DefaultHeader, tc.tenant)
+			}
+			recorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(recorder, req)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+		})
+	}
+
+	recorder = serve(t, server, http.MethodPost, "/v1/admin/api-keys", bootstrapKey, map[string]interface{}{
+		"name":   "invalid",
+		"scopes": []string{apikeys.ScopeRead},
+		"tenant": "../admin",
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// TestTenantBoundAdmin checks an admin key bound to a tenant manages the keys of its tenant only,
+// while the unbound bootstrap key manages the keys of every tenant
+func TestTenantBoundAdmin(t *testing.T) {
+	server, err := planetsfactory.New(memorystore.NewStore(nil),
+		planetsfactory.WithAPIKeys(memorystore.NewKeyStore(), authmiddleware.WithBootstrapKey(bootstrapKey)),
+	)
+	require.NoError(t, err)
+
+	create := func(key string, body map[string]interface{}) apikeymodel.CreateResponse {
+		recorder := serve(t, server, http.MethodPost, "/v1/admin/api-keys", key, body)
+		require.Equal(t, http.StatusCreated, recorder.Code)
+		var created apikeymodel.CreateResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+		return created
+	}
+	list := func(key string) []apikeymodel.KeyResponse {
+		recorder := serve(t, server, http.MethodGet, "/v1/admin/api-keys", key, nil)
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var listed []apikeymodel.KeyResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+		return listed
+	}
+
+	// the bootstrap key chooses the tenant of the keys it issues
+	admin := create(bootstrapKey, map[string]interface{}{
+		"name":   "rebels-admin",
+		"scopes": []string{apikeys.ScopeAdmin},
+		"tenant": "rebels",
+	})
+	require.Equal(t, "rebels", admin.Tenant)
+	empire := create(bootstrapKey, map[string]interface{}{
+		"name":   "empire-reader",
+		"scopes": []string{apikeys.ScopeRead},
+		"tenant": "empire",
+	})
+	require.Equal(t, "empire", empire.Tenant)
+
+	// the bound admin issues keys for its own tenant only
+	reader := create(admin.Key, map[string]interface{}{
+		"name":   "rebels-reader",
+		"scopes": []string{apikeys.ScopeRead},
+	})
+	require.Equal(t, "rebels", reader.Tenant)
+	writer := create(admin.Key, map[string]interface{}{
+		"name":   "rebels-writer",
+		"scopes": []string{apikeys.ScopeWrite},
+		"tenant": "rebels",
+	})
+	require.Equal(t, "rebels", writer.Tenant)
+	recorder := serve(t, server, http.MethodPost, "/v1/admin/api-keys", admin.Key, map[string]interface{}{
+		"name":   "empire-admin",
+		"scopes": []string{apikeys.ScopeAdmin},
+		"tenant": "empire",
+	})
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	listed := list(admin.Key)
+	require.Len(t, listed, 3)
+	for _, key := range listed {
+		require.Equal(t, "rebels", key.Tenant)
+	}
+	require.Len(t, list(bootstrapKey), 4)
+
+	recorder = serve(t, server, http.MethodDelete, "/v1/admin/api-keys/"+empire.ID, admin.Key, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = serve(t, server, http.MethodGet, "/v1/planets", empire.Key, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serve(t, server, http.MethodDelete, "/v1/admin/api-keys/"+reader.ID, admin.Key, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = serve(t, server, http.MethodDelete, "/v1/admin/api-keys/"+empire.ID, bootstrapKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	recorder = serve(t, server, http.MethodGet, "/v1/planets", empire.Key, nil)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
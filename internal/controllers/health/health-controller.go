@@ -0,0 +1,116 @@
+package healthcontroller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+type (
+	// Check probes a dependency of the API. A failing critical check makes the API not ready,
+	// a failing non critical check only degrades it.
+	Check struct {
+		Name     string
+		Critical bool
+		Probe    func(ctx context.Context) error
+	}
+
+	Controller struct {
+		checks  []Check
+		timeout time.Duration
+	}
+
+	// ReadinessResponse is the body of the readiness probe
+	ReadinessResponse struct {
+		Status       string                `json:"status"`
+		Dependencies map[string]Dependency `json:"dependencies"`
+	}
+
+	// Dependency is the outcome of a single check
+	Dependency struct {
+		Status   string `json:"status"`
+		Critical bool   `json:"critical"`
+		Latency  string `json:"latency"`
+		Error    string `json:"error,omitempty"`
+	}
+)
+
+// New creates a pointer to a Controller that bounds each readiness check by timeout
+func New(timeout time.Duration, checks ...Check) *Controller {
+	return &Controller{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Live handles the liveness probe, which only reports that the process is serving requests
+func (c *Controller) Live(ctx *gin.Context) {
+	negotiate.Render(ctx, http.StatusOK, gin.H{"status": StatusUp})
+}
+
+// Ready handles the readiness probe, running every check concurrently
+func (c *Controller) Ready(ctx *gin.Context) {
+	res := c.run(ctx.Request.Context())
+
+	status := http.StatusOK
+	if res.Status == StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	negotiate.Render(ctx, status, res)
+}
+
+func (c *Controller) run(ctx context.Context) ReadinessResponse {
+	res := ReadinessResponse{
+		Status:       StatusUp,
+		Dependencies: make(map[string]Dependency, len(c.checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			start := time.Now()
+			err := check.Probe(probeCtx)
+
+			dependency := Dependency{
+				Status:   StatusUp,
+				Critical: check.Critical,
+				Latency:  time.Since(start).Round(time.Millisecond).String(),
+			}
+			if err != nil {
+				dependency.Status = StatusDown
+				dependency.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			res.Dependencies[check.Name] = dependency
+			switch {
+			case err == nil:
+			case check.Critical:
+				res.Status = StatusDown
+			case res.Status == StatusUp:
+				res.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return res
+}
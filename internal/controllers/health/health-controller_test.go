@@ -0,0 +1,131 @@
+package healthcontroller_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	healthcontroller "github.com/gmaschi/b2w-sw-planets/internal/controllers/health"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// TestLive tests the liveness probe
+func TestLive(t *testing.T) {
+	controller := healthcontroller.New(time.Second, healthcontroller.Check{Name: "db", Critical: true, Probe: fail})
+
+	recorder := serve(t, controller, "/healthz")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// TestReady tests the readiness probe
+func TestReady(t *testing.T) {
+	testCases := []struct {
+		name           string
+		checks         []healthcontroller.Check
+		expectedCode   int
+		expectedStatus string
+		checkResponse  func(t *testing.T, res healthcontroller.ReadinessResponse)
+	}{
+		{
+			name: "Up",
+			checks: []healthcontroller.Check{
+				{Name: "db", Critical: true, Probe: succeed},
+				{Name: "swapi", Critical: true, Probe: succeed},
+			},
+			expectedCode:   http.StatusOK,
+			expectedStatus: healthcontroller.StatusUp,
+			checkResponse: func(t *testing.T, res healthcontroller.ReadinessResponse) {
+				require.Len(t, res.Dependencies, 2)
+				require.Equal(t, healthcontroller.StatusUp, res.Dependencies["db"].Status)
+				require.Empty(t, res.Dependencies["db"].Error)
+			},
+		},
+		{
+			name: "CriticalDown",
+			checks: []healthcontroller.Check{
+				{Name: "db", Critical: true, Probe: fail},
+				{Name: "swapi", Critical: false, Probe: succeed},
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: healthcontroller.StatusDown,
+			checkResponse: func(t *testing.T, res healthcontroller.ReadinessResponse) {
+				require.Equal(t, healthcontroller.StatusDown, res.Dependencies["db"].Status)
+				require.Equal(t, "connection refused", res.Dependencies["db"].Error)
+				require.True(t, res.Dependencies["db"].Critical)
+			},
+		},
+		{
+			name: "NonCriticalDown",
+			checks: []healthcontroller.Check{
+				{Name: "db", Critical: true, Probe: succeed},
+				{Name: "swapi", Critical: false, Probe: fail},
+			},
+			expectedCode:   http.StatusOK,
+			expectedStatus: healthcontroller.StatusDegraded,
+			checkResponse: func(t *testing.T, res healthcontroller.ReadinessResponse) {
+				require.Equal(t, healthcontroller.StatusDown, res.Dependencies["swapi"].Status)
+				require.False(t, res.Dependencies["swapi"].Critical)
+			},
+		},
+		{
+			name: "Timeout",
+			checks: []healthcontroller.Check{
+				{Name: "db", Critical: true, Probe: func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				}},
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: healthcontroller.StatusDown,
+			checkResponse: func(t *testing.T, res healthcontroller.ReadinessResponse) {
+				require.Equal(t, context.DeadlineExceeded.Error(), res.Dependencies["db"].Error)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			controller := healthcontroller.New(50*time.Millisecond, tc.checks...)
+
+			recorder := serve(t, controller, "/readyz")
+			require.Equal(t, tc.expectedCode, recorder.Code)
+
+			var res healthcontroller.ReadinessResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+			require.Equal(t, tc.expectedStatus, res.Status)
+			tc.checkResponse(t, res)
+		})
+	}
+}
+
+func serve(t *testing.T, controller *healthcontroller.Controller, url string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/healthz", controller.Live)
+	router.GET("/readyz", controller.Ready)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func succeed(context.Context) error {
+	return nil
+}
+
+func fail(context.Context) error {
+	return errors.New("connection refused")
+}
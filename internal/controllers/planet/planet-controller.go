@@ -1,25 +1,100 @@
 package planetcontroller
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
+	"github.com/gmaschi/b2w-sw-planets/internal/logging"
+	authmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/auth"
+	bodylimitmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/body-limit"
+	ratelimitmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/rate-limit"
+	validationmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/validation"
 	planetmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet"
 	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	"github.com/gmaschi/b2w-sw-planets/internal/planetio"
 	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/tenancy"
 	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"io"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
-type Controller struct {
-	store planetsdb.Store
+// maxBatchSize bounds the planets created by a single batch request
+const maxBatchSize = 500
+
+// streamFlushEvery is the number of streamed planets written between flushes of the response
+const streamFlushEvery = 100
+
+// streamed maps the media types of the lists written straight from the store to their format,
+// the other media types render the list once it has been read
+var streamed = map[string]planetio.Format{
+	binding.MIMEJSON:     planetio.JSON,
+	negotiate.MIMENDJSON: planetio.NDJSON,
+	negotiate.MIMECSV:    planetio.CSV,
+}
+
+// importChunkSize is the number of imported planets created by each call to the store
+const importChunkSize = 100
+
+// reservationTTL bounds how long a create with an idempotency key blocks the retries with the
+// same key, so a crashed request does not block them until the record expires
+const reservationTTL = time.Minute
+
+type (
+	Controller struct {
+		store          planetsdb.Store
+		logger         *zap.Logger
+		idempotency    idempotency.Store
+		idempotencyTTL time.Duration
+	}
+
+	// bodyRecorder keeps a copy of the response body
+	bodyRecorder struct {
+		gin.ResponseWriter
+		body bytes.Buffer
+	}
+
+	// Option configures a Controller
+	Option func(*Controller)
+)
+
+// WithLogger sets the logger of the server errors
+func WithLogger(logger *zap.Logger) Option {
+	return func(c *Controller) {
+		c.logger = logger
+	}
+}
+
+// WithIdempotency makes Create honor the Idempotency-Key header: the first response is kept in
+// store for ttl and replayed to the retries with the same key and payload
+func WithIdempotency(store idempotency.Store, ttl time.Duration) Option {
+	return func(c *Controller) {
+		c.idempotency = store
+		c.idempotencyTTL = ttl
+	}
 }
 
 // New creates a pointer to a Controller
-func New(store planetsdb.Store) *Controller {
-	return &Controller{
-		store: store,
+func New(store planetsdb.Store, opts ...Option) *Controller {
+	controller := &Controller{
+		store:  store,
+		logger: zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(controller)
 	}
+	return controller
 }
 
 // Create handles the request to create a new planet
@@ -27,45 +102,237 @@ func (c *Controller) Create(ctx *gin.Context) {
 	var req planetmodel.CreateRequest
 
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, parseerrors.ErrorResponse(err))
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if key := ctx.GetHeader(idempotency.Header); key != "" && c.idempotency != nil {
+		c.createOnce(ctx, key, req)
 		return
 	}
+	c.create(ctx, req)
+}
+
+// create creates the planet of req
+func (c *Controller) create(ctx *gin.Context, req planetmodel.CreateRequest) {
 	createArgs := planetsdb.CreatePlanetParams{
 		Name:    req.Name,
 		Terrain: req.Terrain,
 		Climate: req.Climate,
 	}
-	planet, err := c.store.CreatePlanet(ctx, createArgs)
+	if principal, ok := authmiddleware.PrincipalFromContext(ctx); ok {
+		createArgs.CreatedBy = principal.Subject
+	}
+	planet, err := c.store.CreatePlanet(ctx.Request.Context(), createArgs)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, parseerrors.ErrorResponse(err))
+		if err.Error() == fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists).Error() {
+			c.fail(ctx, http.StatusConflict, err)
+			return
+		}
+		c.fail(ctx, http.StatusInternalServerError, err)
 		return
 	}
 
 	res := planetmodel.CreateResponse(planet)
-	ctx.JSON(http.StatusCreated, res)
+	negotiate.Render(ctx, http.StatusCreated, res)
+}
+
+// CreateBatch handles the request to create an array of planets, answering with the outcome of
+// each of them. With atomic=true either every planet is created or none.
+func (c *Controller) CreateBatch(ctx *gin.Context) {
+	var query planetmodel.CreateBatchRequest
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	// the planets are decoded one by one, so an invalid planet only fails its own result
+	var reqs []json.RawMessage
+	if err := ctx.ShouldBindJSON(&reqs); err != nil {
+		if errors.Is(err, bodylimitmiddleware.ErrTooLarge) {
+			c.fail(ctx, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchSize {
+		c.fail(ctx, http.StatusBadRequest, fmt.Errorf("%s: a batch holds 1 to %d planets", errorsmodel.InvalidBatchSize, maxBatchSize))
+		return
+	}
+	// the request paid for the first planet, each other one costs a token
+	if !ratelimitmiddleware.Charge(ctx, len(reqs)-1) {
+		c.fail(ctx, http.StatusTooManyRequests, errors.New(errorsmodel.RateLimitExceeded))
+		return
+	}
+
+	var createdBy string
+	if principal, ok := authmiddleware.PrincipalFromContext(ctx); ok {
+		createdBy = principal.Subject
+	}
+	res := planetmodel.CreateBatchResponse{Results: make([]planetmodel.CreateBatchResult, len(reqs))}
+	args := planetsdb.CreatePlanetsParams{Atomic: query.Atomic}
+	// indexes maps the position of each planet sent to the store to its result
+	var indexes []int
+	for i := range reqs {
+		var req planetmodel.CreateRequest
+		if err := binding.JSON.BindBody(reqs[i], &req); err != nil {
+			res.Results[i] = planetmodel.CreateBatchResult{Status: http.StatusBadRequest, Error: err.Error()}
+			continue
+		}
+		args.Planets = append(args.Planets, planetsdb.CreatePlanetParams{
+			Name:      req.Name,
+			Terrain:   req.Terrain,
+			Climate:   req.Climate,
+			CreatedBy: createdBy,
+		})
+		indexes = append(indexes, i)
+	}
+
+	results := make([]planetsdb.CreatePlanetResult, len(args.Planets))
+	if len(indexes) < len(reqs) && query.Atomic {
+		for i := range results {
+			results[i].Err = fmt.Errorf("create planet: %s", errorsmodel.BatchAborted)
+		}
+	} else if len(args.Planets) > 0 {
+		var err error
+		results, err = c.store.CreatePlanets(ctx.Request.Context(), args)
+		if err != nil {
+			c.fail(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	for i, result := range results {
+		res.Results[indexes[i]] = c.batchResult(ctx, result)
+	}
+	negotiate.Render(ctx, http.StatusMultiStatus, res)
 }
 
-// Planet handles the request to get a planet based on the ID
+// batchResult describes the outcome of creating a planet of a batch
+func (c *Controller) batchResult(ctx *gin.Context, result planetsdb.CreatePlanetResult) planetmodel.CreateBatchResult {
+	if result.Err == nil {
+		planet := planetmodel.CreateResponse(result.Planet)
+		return planetmodel.CreateBatchResult{Status: http.StatusCreated, Planet: &planet}
+	}
+
+	status := http.StatusInternalServerError
+	switch result.Err.Error() {
+	case fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists).Error():
+		status = http.StatusConflict
+	case fmt.Errorf("create planet: %s", errorsmodel.BatchAborted).Error():
+		status = http.StatusFailedDependency
+	default:
+		logging.ForRequest(ctx.Request.Context(), c.logger).Error("batch planet failed",
+			zap.String("route", ctx.FullPath()),
+			zap.String("planet_name", result.Planet.Name),
+			zap.Error(result.Err),
+		)
+	}
+	return planetmodel.CreateBatchResult{Status: status, Error: result.Err.Error()}
+}
+
+// createOnce creates the planet of req at most once per idempotency key, replaying the
+// response of the first request to the retries
+func (c *Controller) createOnce(ctx *gin.Context, key string, req planetmodel.CreateRequest) {
+	if !idempotency.ValidKey(key) {
+		c.fail(ctx, http.StatusBadRequest, errors.New(errorsmodel.InvalidIdempotencyKey))
+		return
+	}
+	fingerprint, err := idempotency.Fingerprint(req)
+	if err != nil {
+		c.fail(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	tenantID, _ := tenancy.FromContext(ctx.Request.Context())
+	var subject string
+	if principal, ok := authmiddleware.PrincipalFromContext(ctx); ok {
+		subject = principal.Subject
+	}
+	now := time.Now()
+	record, reserved, err := c.idempotency.Reserve(ctx.Request.Context(), idempotency.Record{
+		ID:          idempotency.ID(tenantID, subject, key),
+		Owner:       primitive.NewObjectID().Hex(),
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(reservationTTL),
+	}, now)
+	if err != nil {
+		c.fail(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	if !reserved {
+		switch {
+		case record.Fingerprint != fingerprint:
+			c.fail(ctx, http.StatusUnprocessableEntity, errors.New(errorsmodel.IdempotencyKeyReused))
+		case !record.Completed:
+			c.fail(ctx, http.StatusConflict, errors.New(errorsmodel.IdempotencyKeyInProgress))
+		default:
+			ctx.Header(idempotency.ReplayedHeader, "true")
+			contentType := record.ContentType
+			if contentType == "" {
+				// recorded before the responses were negotiated
+				contentType = gin.MIMEJSON + "; charset=utf-8"
+			}
+			ctx.Data(record.Status, contentType, record.Body)
+		}
+		return
+	}
+
+	recorder := &bodyRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+	c.create(ctx, req)
+	ctx.Writer = recorder.ResponseWriter
+
+	// the record outlives the request, which may have been canceled by now
+	storeCtx, cancel := context.WithTimeout(context.Background(), reservationTTL)
+	defer cancel()
+	if recorder.Status() >= http.StatusInternalServerError {
+		// server errors are not replayed, the retries try to create the planet again
+		err = c.idempotency.Release(storeCtx, record.ID, record.Owner)
+	} else {
+		err = c.idempotency.Complete(storeCtx, record.ID, record.Owner, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes(), time.Now().Add(c.idempotencyTTL))
+	}
+	if err != nil {
+		logging.ForRequest(ctx.Request.Context(), c.logger).Error("could not store idempotency record", zap.Error(err))
+	}
+}
+
+// Planet handles the request to get a planet based on the ID, holding only the selected fields
 func (c *Controller) Planet(ctx *gin.Context) {
-	var req planetmodel.GetRequest
+	var (
+		req   planetmodel.GetRequest
+		query planetmodel.GetQuery
+	)
 
 	if err := ctx.ShouldBindUri(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, parseerrors.ErrorResponse(err))
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	fields, err := parseFields(query.Fields)
+	if err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
 		return
 	}
 
-	planet, err := c.store.GetPlanet(ctx, req.ID)
+	planet, err := c.store.GetPlanet(ctx.Request.Context(), req.ID, fields...)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			ctx.JSON(http.StatusNotFound, parseerrors.ErrorResponse(err))
+		if err.Error() == fmt.Errorf("get planet: %s", errorsmodel.PlanetDoesNotExist).Error() {
+			c.fail(ctx, http.StatusNotFound, err)
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, parseerrors.ErrorResponse(err))
+		c.fail(ctx, http.StatusInternalServerError, err)
 		return
 	}
 
+	if fields != nil {
+		negotiate.Render(ctx, http.StatusOK, planetmodel.Sparse{Response: planetmodel.GetResponse(planet), Fields: fields})
+		return
+	}
 	res := planetmodel.GetResponse(planet)
-	ctx.JSON(http.StatusOK, res)
+	negotiate.Render(ctx, http.StatusOK, res)
 }
 
 // Delete handles the request to delete a planet based on the ID
@@ -73,41 +340,115 @@ func (c *Controller) Delete(ctx *gin.Context) {
 	var req planetmodel.DeleteRequest
 
 	if err := ctx.ShouldBindUri(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, parseerrors.ErrorResponse(err))
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err := c.store.DeletePlanet(ctx.Request.Context(), req.ID)
+	if err != nil {
+		if err.Error() == fmt.Errorf("delete planet: %s", errorsmodel.PlanetDoesNotExist).Error() {
+			c.fail(ctx, http.StatusNotFound, err)
+			return
+		}
+		c.fail(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	negotiate.Render(ctx, http.StatusOK, fmt.Sprintf("planet with id %s deleted", req.ID))
+}
+
+// DeleteMany handles the request to delete the planets filtered by name, climate and terrain.
+// Without dry_run=true it requires confirm=true.
+func (c *Controller) DeleteMany(ctx *gin.Context) {
+	var req planetmodel.DeleteManyRequest
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	deleteArgs := planetsdb.DeletePlanetsParams{
+		Name:    req.Name,
+		Climate: req.Climate,
+		Terrain: req.Terrain,
+		DryRun:  req.DryRun,
+	}
+	if !planetsdb.HasFilter(deleteArgs) {
+		c.fail(ctx, http.StatusBadRequest, errors.New(errorsmodel.MissingFilter))
+		return
+	}
+	if !req.DryRun && !req.Confirm {
+		c.fail(ctx, http.StatusBadRequest, errors.New(errorsmodel.DeleteNotConfirmed))
 		return
 	}
 
-	err := c.store.DeletePlanet(ctx, req.ID)
-	// TODO: handle invalid hex
+	ids, err := c.store.DeletePlanets(ctx.Request.Context(), deleteArgs)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, parseerrors.ErrorResponse(err))
+		c.fail(ctx, http.StatusInternalServerError, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, fmt.Sprintf("planet with id %s deleted", req.ID))
+	res := planetmodel.DeleteManyResponse{Count: len(ids), IDs: ids, DryRun: req.DryRun}
+	if res.IDs == nil {
+		res.IDs = []primitive.ObjectID{}
+	}
+	negotiate.Render(ctx, http.StatusOK, res)
 }
 
-// List handles the request to list the planets
+// List handles the request to list the planets. JSON, NDJSON and CSV lists are written as the
+// planets are read from the store, the other media types once the whole list has been read.
 func (c *Controller) List(ctx *gin.Context) {
 	var req planetmodel.ListRequest
 
-	if err := ctx.ShouldBindQuery(&req); err != nil && req.Name != "" {
-		ctx.JSON(http.StatusBadRequest, parseerrors.ErrorResponse(err))
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	fields, err := parseFields(req.Fields)
+	if err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
 		return
 	}
 
 	listArgs := planetsdb.ListPlanetParams{
-		Name: req.Name,
+		Name:    req.Name,
+		Climate: req.Climate,
+		Terrain: req.Terrain,
+		Offset:  req.Offset,
+		Limit:   req.Limit,
+		Fields:  fields,
 	}
 
-	planets, err := c.store.ListPlanets(ctx, listArgs)
+	if format, ok := streamed[negotiate.MediaType(ctx)]; ok {
+		count, err := c.stream(ctx, listArgs, format, func() {
+			ctx.Header("Content-Type", format.ContentType())
+			ctx.Status(http.StatusOK)
+		})
+		if err != nil {
+			c.fail(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		if count == 0 {
+			c.fail(ctx, http.StatusNotFound, fmt.Errorf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+		}
+		return
+	}
+
+	planets, err := c.store.ListPlanets(ctx.Request.Context(), listArgs)
 	if err != nil {
-		fmt.Println(err)
 		if err.Error() == fmt.Errorf("list planets: %s", errorsmodel.PlanetDoesNotExist).Error() {
-			ctx.JSON(http.StatusNotFound, parseerrors.ErrorResponse(err))
+			c.fail(ctx, http.StatusNotFound, err)
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, parseerrors.ErrorResponse(err))
+		c.fail(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	if fields != nil {
+		sparse := make([]planetmodel.Sparse, 0, len(planets))
+		for _, planet := range planets {
+			sparse = append(sparse, planetmodel.Sparse{Response: planetmodel.ListResponse(planet), Fields: fields})
+		}
+		negotiate.Render(ctx, http.StatusOK, sparse)
 		return
 	}
 
@@ -117,5 +458,263 @@ func (c *Controller) List(ctx *gin.Context) {
 		res = append(res, planetmodel.ListResponse(planet))
 	}
 
-	ctx.JSON(http.StatusOK, res)
+	negotiate.Render(ctx, http.StatusOK, res)
+}
+
+// Export handles the request to export the planets filtered by name, climate and terrain as a
+// file, writing each planet as it is read from the store
+func (c *Controller) Export(ctx *gin.Context) {
+	var req planetmodel.ExportRequest
+
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+	format := planetio.Format(req.Format)
+	listArgs := planetsdb.ListPlanetParams{
+		Name:    req.Name,
+		Climate: req.Climate,
+		Terrain: req.Terrain,
+	}
+
+	count, err := c.stream(ctx, listArgs, format, func() {
+		exportHeaders(ctx, format)
+	})
+	if err != nil {
+		c.fail(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	if count == 0 {
+		exportHeaders(ctx, format)
+		if err := planetio.NewEncoder(ctx.Writer, format).Close(); err != nil {
+			_ = ctx.Error(err)
+		}
+	}
+}
+
+// exportHeaders sends the headers of an export file of format
+func exportHeaders(ctx *gin.Context, format planetio.Format) {
+	ctx.Header("Content-Type", format.ContentType())
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="planets.%s"`, format))
+	ctx.Status(http.StatusOK)
+}
+
+// stream writes the planets of listArgs as a file of format, each planet as it is read from the
+// store, and returns the number of planets written. start sends the headers before the first
+// planet, so a store failing before it returns its error for the caller to answer; later errors,
+// such as a client going away, are logged and leave the client with a truncated file.
+func (c *Controller) stream(ctx *gin.Context, listArgs planetsdb.ListPlanetParams, format planetio.Format, start func()) (int, error) {
+	var encoder planetio.Encoder
+	count := 0
+	err := c.store.WalkPlanets(ctx.Request.Context(), listArgs, func(planet planetsdb.Planet) error {
+		if encoder == nil {
+			start()
+			encoder = planetio.NewEncoder(ctx.Writer, format, listArgs.Fields...)
+		}
+		if err := encoder.Encode(planet); err != nil {
+			return err
+		}
+		count++
+		if count%streamFlushEvery == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if encoder == nil {
+		return 0, err
+	}
+	if err == nil {
+		err = encoder.Close()
+	}
+
+	if err != nil {
+		validationmiddleware.Truncated(ctx)
+	}
+	if err != nil && ctx.Request.Context().Err() == nil {
+		logging.ForRequest(ctx.Request.Context(), c.logger).Error("stream interrupted",
+			zap.String("route", ctx.FullPath()),
+			zap.Int("count", count),
+			zap.Error(err),
+		)
+	}
+	return count, nil
+}
+
+// Import handles the request to import a file of planets, creating them in chunks as the file is
+// read, and answers with the errors of each line. With lookup=false the movies of each planet are
+// read from the file instead of SWAPI.
+func (c *Controller) Import(ctx *gin.Context) {
+	var query planetmodel.ImportRequest
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		c.fail(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var createdBy string
+	if principal, ok := authmiddleware.PrincipalFromContext(ctx); ok {
+		createdBy = principal.Subject
+	}
+	res := planetmodel.ImportResponse{Errors: []planetmodel.ImportError{}}
+	lineFailed := func(line int, err string) {
+		res.Errors = append(res.Errors, planetmodel.ImportError{Line: line, Error: err})
+	}
+	args := planetsdb.CreatePlanetsParams{SkipLookup: !query.Lookup}
+	// lines holds the line of each planet of args
+	var lines []int
+	// paid is the number of planets paid for by the request, each other one costs a token
+	paid, limited := 1, false
+	create := func() error {
+		if len(args.Planets) == 0 {
+			return nil
+		}
+		if !ratelimitmiddleware.Charge(ctx, len(args.Planets)-paid) {
+			for _, line := range lines {
+				lineFailed(line, errorsmodel.RateLimitExceeded)
+			}
+			args.Planets, lines = args.Planets[:0], lines[:0]
+			limited = true
+			return nil
+		}
+		paid = 0
+		results, err := c.store.CreatePlanets(ctx.Request.Context(), args)
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			if result := c.batchResult(ctx, result); result.Status != http.StatusCreated {
+				lineFailed(lines[i], result.Error)
+				continue
+			}
+			res.Imported++
+		}
+		args.Planets, lines = args.Planets[:0], lines[:0]
+		return nil
+	}
+
+	decoder := planetio.NewDecoder(ctx.Request.Body, planetio.Format(query.Format))
+	for {
+		row, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		var lineErr *planetio.LineError
+		if errors.As(err, &lineErr) {
+			lineFailed(lineErr.Line, lineErr.Err.Error())
+			if lineErr.Fatal {
+				break
+			}
+			continue
+		}
+		if err := binding.Validator.ValidateStruct(row.Planet); err != nil {
+			lineFailed(row.Line, err.Error())
+			continue
+		}
+		planet := planetsdb.CreatePlanetParams{
+			Name:      row.Planet.Name,
+			Terrain:   row.Planet.Terrain,
+			Climate:   row.Planet.Climate,
+			CreatedBy: createdBy,
+		}
+		if !query.Lookup {
+			if row.Planet.Movies == nil {
+				lineFailed(row.Line, errorsmodel.MissingMovies)
+				continue
+			}
+			planet.Movies = *row.Planet.Movies
+		}
+		args.Planets = append(args.Planets, planet)
+		lines = append(lines, row.Line)
+
+		if len(args.Planets) == importChunkSize {
+			if err := create(); err != nil {
+				c.fail(ctx, http.StatusInternalServerError, err)
+				return
+			}
+			// the import stops at the first chunk over the rate limit, the lines left unread
+			// are reported by the first of them
+			if limited {
+				res.TruncatedAt = nextLine(decoder, row.Line)
+				break
+			}
+		}
+	}
+	if err := create(); err != nil {
+		c.fail(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the planets failing in the store are reported after the lines read since their chunk
+	sort.SliceStable(res.Errors, func(i, j int) bool {
+		return res.Errors[i].Line < res.Errors[j].Line
+	})
+	res.Failed = len(res.Errors)
+	negotiate.Render(ctx, http.StatusOK, res)
+}
+
+// nextLine returns the line of the next row of decoder, read after the one at line, or 0 when
+// there is none
+func nextLine(decoder planetio.Decoder, line int) int {
+	row, err := decoder.Decode()
+	if err == io.EOF {
+		return 0
+	}
+	var lineErr *planetio.LineError
+	if errors.As(err, &lineErr) {
+		row.Line = lineErr.Line
+	}
+	if row.Line <= line {
+		// the line of the errors outside the rows is unknown
+		return line + 1
+	}
+	return row.Line
+}
+
+// parseFields returns the fields selected by the comma separated list raw, always starting with
+// _id, or nil when raw is blank so that every field is returned
+func parseFields(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	fields := []string{"_id"}
+	seen := map[string]bool{"_id": true}
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			continue
+		}
+		if !planetsdb.IsField(field) {
+			return nil, fmt.Errorf("%s: %s", errorsmodel.UnknownField, field)
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// fail answers the request with err. Server errors are logged, client errors are left to
+// the access log.
+func (c *Controller) fail(ctx *gin.Context, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		logging.ForRequest(ctx.Request.Context(), c.logger).Error("request failed",
+			zap.String("route", ctx.FullPath()),
+			zap.Error(err),
+		)
+	} else {
+		_ = ctx.Error(err)
+	}
+	negotiate.Render(ctx, status, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+}
+
+func (r *bodyRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *bodyRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
 }
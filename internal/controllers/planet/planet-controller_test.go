@@ -2,12 +2,18 @@ package planetcontroller_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens/tokenstest"
 	planetsfactory "github.com/gmaschi/b2w-sw-planets/internal/factories/planets-factory"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
 	planetmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet"
 	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	memorystore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/memory/planets-db"
 	mockedstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mocks/mongodb/planets-db"
 	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
 	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
@@ -19,7 +25,9 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -62,6 +70,45 @@ func TestCreate(t *testing.T) {
 				requireBodyMatchCreate(t, recorder.Body, planet)
 			},
 		},
+		{
+			name: "OKNameWithSpace",
+			body: map[string]interface{}{
+				"name":    "Yavin IV",
+				"terrain": planet.Terrain,
+				"climate": planet.Climate,
+			},
+			buildStubs: func(store *mockedstore.MockStore) {
+				arg := planetsdb.CreatePlanetParams{
+					Name:    "Yavin IV",
+					Terrain: planet.Terrain,
+					Climate: planet.Climate,
+				}
+				store.EXPECT().
+					CreatePlanet(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(planet, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidName",
+			body: map[string]interface{}{
+				"name":    "Tatooine; drop",
+				"terrain": planet.Terrain,
+				"climate": planet.Climate,
+			},
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanet(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "planetname")
+			},
+		},
 		{
 			name: "BadRequest",
 			body: map[string]interface{}{
@@ -78,6 +125,23 @@ func TestCreate(t *testing.T) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 		},
+		{
+			name: "Conflict",
+			body: map[string]interface{}{
+				"name":    planet.Name,
+				"terrain": planet.Terrain,
+				"climate": planet.Climate,
+			},
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanet(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(planetsdb.Planet{}, fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
 		{
 			name: "InternalError",
 			body: map[string]interface{}{
@@ -124,6 +188,155 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+// TestCreateBatch tests the CreateBatch planet controller
+func TestCreateBatch(t *testing.T) {
+	tatooine, kamino := randomPlanet(), randomPlanet()
+	tatooine.Name, kamino.Name = "Tatooine", "Kamino"
+	valid := []map[string]interface{}{
+		{"name": tatooine.Name, "terrain": tatooine.Terrain, "climate": tatooine.Climate},
+		{"name": kamino.Name, "terrain": kamino.Terrain, "climate": kamino.Climate},
+	}
+	withInvalid := append([]map[string]interface{}{{"name": "", "terrain": "ocean", "climate": "temperate"}}, valid...)
+
+	testCases := []struct {
+		name          string
+		url           string
+		body          interface{}
+		buildStubs    func(store *mockedstore.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			url:  "/v1/planets:batch",
+			body: valid,
+			buildStubs: func(store *mockedstore.MockStore) {
+				arg := planetsdb.CreatePlanetsParams{Planets: []planetsdb.CreatePlanetParams{
+					{Name: tatooine.Name, Terrain: tatooine.Terrain, Climate: tatooine.Climate},
+					{Name: kamino.Name, Terrain: kamino.Terrain, Climate: kamino.Climate},
+				}}
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return([]planetsdb.CreatePlanetResult{{Planet: tatooine}, {Planet: kamino}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusMultiStatus, recorder.Code)
+				res := requireBatchResults(t, recorder, http.StatusCreated, http.StatusCreated)
+				require.Equal(t, planetmodel.CreateResponse(tatooine), *res.Results[0].Planet)
+				require.Equal(t, planetmodel.CreateResponse(kamino), *res.Results[1].Planet)
+			},
+		},
+		{
+			name: "PartialFailure",
+			url:  "/v1/planets:batch",
+			body: withInvalid,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return([]planetsdb.CreatePlanetResult{
+						{Planet: tatooine},
+						{Err: fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)},
+					}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusMultiStatus, recorder.Code)
+				res := requireBatchResults(t, recorder, http.StatusBadRequest, http.StatusCreated, http.StatusConflict)
+				require.NotEmpty(t, res.Results[0].Error)
+				require.Nil(t, res.Results[2].Planet)
+			},
+		},
+		{
+			name: "AtomicInvalidPlanet",
+			url:  "/v1/planets:batch?atomic=true",
+			body: withInvalid,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusMultiStatus, recorder.Code)
+				requireBatchResults(t, recorder, http.StatusBadRequest, http.StatusFailedDependency, http.StatusFailedDependency)
+			},
+		},
+		{
+			name: "Empty",
+			url:  "/v1/planets:batch",
+			body: []map[string]interface{}{},
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "NotAnArray",
+			url:  "/v1/planets:batch",
+			body: valid[0],
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			url:  "/v1/planets:batch",
+			body: valid,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, mongo.ErrClientDisconnected)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "UnknownMethod",
+			url:  "/v1/planets:import",
+			body: valid,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockedstore.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server, err := planetsfactory.New(store)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodPost, tc.url, bytes.NewReader(data))
+			require.NoError(t, err)
+			server.Router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
 // TestPlanet tests the Planet controller
 func TestPlanet(t *testing.T) {
 	planet := randomPlanet()
@@ -159,6 +372,18 @@ func TestPlanet(t *testing.T) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 		},
+		{
+			name:     "MalformedID",
+			planetID: planet.ID.Hex()[:23] + "z",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					GetPlanet(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
 		{
 			name:     "NotFound",
 			planetID: planet.ID.Hex(),
@@ -166,7 +391,7 @@ func TestPlanet(t *testing.T) {
 				store.EXPECT().
 					GetPlanet(gomock.Any(), gomock.Eq(planet.ID.Hex())).
 					Times(1).
-					Return(planetsdb.Planet{}, mongo.ErrNoDocuments)
+					Return(planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.PlanetDoesNotExist))
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNotFound, recorder.Code)
@@ -246,6 +471,19 @@ func TestDelete(t *testing.T) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 		},
+		{
+			name:     "NotFound",
+			planetID: planet.ID.Hex(),
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanet(gomock.Any(), gomock.Eq(planet.ID.Hex())).
+					Times(1).
+					Return(fmt.Errorf("delete planet: %s", errorsmodel.PlanetDoesNotExist))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
 		{
 			name:     "InternalError",
 			planetID: planet.ID.Hex(),
@@ -286,6 +524,118 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+// TestDeleteMany tests the DeleteMany planet controller
+func TestDeleteMany(t *testing.T) {
+	climate := random.String(5)
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockedstore.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: fmt.Sprintf("?climate=%s&confirm=true", climate),
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanets(gomock.Any(), gomock.Eq(planetsdb.DeletePlanetsParams{Climate: climate})).
+					Times(1).
+					Return(ids, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchDeleteMany(t, recorder.Body, planetmodel.DeleteManyResponse{Count: 2, IDs: ids})
+			},
+		},
+		{
+			name:  "DryRun",
+			query: fmt.Sprintf("?climate=%s&dry_run=true", climate),
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanets(gomock.Any(), gomock.Eq(planetsdb.DeletePlanetsParams{Climate: climate, DryRun: true})).
+					Times(1).
+					Return(ids, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchDeleteMany(t, recorder.Body, planetmodel.DeleteManyResponse{Count: 2, IDs: ids, DryRun: true})
+			},
+		},
+		{
+			name:  "NoMatches",
+			query: fmt.Sprintf("?terrain=%s&confirm=true", climate),
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanets(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchDeleteMany(t, recorder.Body, planetmodel.DeleteManyResponse{IDs: []primitive.ObjectID{}})
+			},
+		},
+		{
+			name:  "NotConfirmed",
+			query: fmt.Sprintf("?climate=%s", climate),
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "MissingFilter",
+			query: "?confirm=true",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InternalError",
+			query: fmt.Sprintf("?climate=%s&confirm=true", climate),
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanets(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, mongo.ErrClientDisconnected)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockedstore.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server, err := planetsfactory.New(store)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodDelete, "/v1/planets"+tc.query, nil)
+			require.NoError(t, err)
+			server.Router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
 // TestList tests the Planet controller
 func TestList(t *testing.T) {
 	n := 5
@@ -315,9 +665,9 @@ func TestList(t *testing.T) {
 					Name: "",
 				}
 				store.EXPECT().
-					ListPlanets(gomock.Any(), gomock.Eq(listArgs)).
+					WalkPlanets(gomock.Any(), gomock.Eq(listArgs), gomock.Any()).
 					Times(1).
-					Return(planetsSlice, nil)
+					DoAndReturn(walkPlanets(planetsSlice, nil))
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -336,9 +686,9 @@ func TestList(t *testing.T) {
 					Name: "randomName",
 				}
 				store.EXPECT().
-					ListPlanets(gomock.Any(), gomock.Eq(listArgs)).
+					WalkPlanets(gomock.Any(), gomock.Eq(listArgs), gomock.Any()).
 					Times(1).
-					Return(planetsSlice, nil)
+					DoAndReturn(walkPlanets(planetsSlice, nil))
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -346,39 +696,76 @@ func TestList(t *testing.T) {
 			},
 		},
 		{
-			name: "BadRequest",
+			name: "OKNameWithSpace",
 			listData: struct {
 				name string
 			}{
-				name: "invalid-n@me#",
+				name: "Yavin IV",
 			},
 			buildStubs: func(store *mockedstore.MockStore) {
 				listArgs := planetsdb.ListPlanetParams{
-					Name: "invalid-n@me#",
+					Name: "Yavin IV",
 				}
 				store.EXPECT().
-					ListPlanets(gomock.Any(), gomock.Eq(listArgs)).
-					Times(0)
+					WalkPlanets(gomock.Any(), gomock.Eq(listArgs), gomock.Any()).
+					Times(1).
+					DoAndReturn(walkPlanets(planetsSlice, nil))
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchList(t, recorder.Body, planetsSlice)
 			},
 		},
 		{
-			name: "NotFound",
+			name: "BadRequest",
 			listData: struct {
 				name string
 			}{
-				name: "",
+				name: "invalid-n@me#",
 			},
 			buildStubs: func(store *mockedstore.MockStore) {
 				listArgs := planetsdb.ListPlanetParams{
-					Name: "",
+					Name: "invalid-n@me#",
+				}
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Eq(listArgs), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "BadRequestNameTooLong",
+			listData: struct {
+				name string
+			}{
+				name: strings.Repeat("n", 101),
+			},
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "NotFound",
+			listData: struct {
+				name string
+			}{
+				name: "",
+			},
+			buildStubs: func(store *mockedstore.MockStore) {
+				listArgs := planetsdb.ListPlanetParams{
+					Name: "",
 				}
 				store.EXPECT().
-					ListPlanets(gomock.Any(), gomock.Eq(listArgs)).
+					WalkPlanets(gomock.Any(), gomock.Eq(listArgs), gomock.Any()).
 					Times(1).
-					Return(nil, fmt.Errorf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+					Return(nil)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNotFound, recorder.Code)
@@ -396,14 +783,34 @@ func TestList(t *testing.T) {
 					Name: "",
 				}
 				store.EXPECT().
-					ListPlanets(gomock.Any(), gomock.Eq(listArgs)).
+					WalkPlanets(gomock.Any(), gomock.Eq(listArgs), gomock.Any()).
 					Times(1).
-					Return(nil, mongo.ErrClientDisconnected)
+					Return(mongo.ErrClientDisconnected)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "Interrupted",
+			listData: struct {
+				name string
+			}{
+				name: "",
+			},
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(walkPlanets(planetsSlice[:1], mongo.ErrClientDisconnected))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				// the status was sent with the first planet, the client gets a truncated array
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.True(t, strings.HasPrefix(recorder.Body.String(), "[{"))
+				require.False(t, json.Valid(recorder.Body.Bytes()))
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -420,13 +827,11 @@ func TestList(t *testing.T) {
 			require.NoError(t, err)
 			recorder := httptest.NewRecorder()
 
-			var url string
-			if tc.listData.name == "" {
-				url = fmt.Sprintf("/v1/planets")
-			} else {
-				url = fmt.Sprintf("/v1/planets?name=%s", tc.listData.name)
+			target := "/v1/planets"
+			if tc.listData.name != "" {
+				target = fmt.Sprintf("/v1/planets?name=%s", url.QueryEscape(tc.listData.name))
 			}
-			req, err := http.NewRequest(http.MethodGet, url, nil)
+			req, err := http.NewRequest(http.MethodGet, target, nil)
 			require.NoError(t, err)
 
 			// check response
@@ -436,6 +841,87 @@ func TestList(t *testing.T) {
 	}
 }
 
+// TestMemoryStoreRoundTrip exercises every route against the in-memory store
+func TestMemoryStoreRoundTrip(t *testing.T) {
+	store := memorystore.NewStore(planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+		return 5, nil
+	}))
+	server, err := planetsfactory.New(store)
+	require.NoError(t, err)
+
+	serve := func(method, url string, body interface{}) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, url, bytes.NewReader(data))
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "/v1/planets", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	planets := make([]planetsdb.Planet, 0, 3)
+	for _, name := range []string{"Tatooine", "Kamino", "Alderaan"} {
+		planet := planetsdb.Planet{
+			Name:    name,
+			Terrain: random.String(6),
+			Climate: random.String(5),
+			Movies:  5,
+		}
+		recorder = serve(http.MethodPost, "/v1/planets", map[string]interface{}{
+			"name":    planet.Name,
+			"terrain": planet.Terrain,
+			"climate": planet.Climate,
+		})
+		require.Equal(t, http.StatusCreated, recorder.Code)
+		var created planetmodel.CreateResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+		planet.ID = created.ID
+		planets = append(planets, planet)
+	}
+
+	recorder = serve(http.MethodPost, "/v1/planets", map[string]interface{}{
+		"name":    "Tatooine",
+		"terrain": random.String(6),
+		"climate": random.String(5),
+	})
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = serve(http.MethodGet, fmt.Sprintf("/v1/planets/%s", planets[0].ID.Hex()), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatchPlanet(t, recorder.Body, planets[0])
+
+	recorder = serve(http.MethodGet, "/v1/planets?name=Kamino", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatchList(t, recorder.Body, planets[1:2])
+
+	recorder = serve(http.MethodGet, "/v1/planets?offset=1&limit=1", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatchList(t, recorder.Body, planets[1:2])
+
+	recorder = serve(http.MethodGet, fmt.Sprintf("/v1/planets?climate=%s", planets[2].Climate), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatchList(t, recorder.Body, planets[2:])
+
+	recorder = serve(http.MethodGet, "/v1/planets?limit=-1", nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serve(http.MethodDelete, fmt.Sprintf("/v1/planets/%s", planets[0].ID.Hex()), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = serve(http.MethodGet, fmt.Sprintf("/v1/planets/%s", planets[0].ID.Hex()), nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serve(http.MethodDelete, fmt.Sprintf("/v1/planets/%s", planets[0].ID.Hex()), nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serve(http.MethodGet, "/v1/planets", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatchList(t, recorder.Body, planets[1:])
+}
+
 func randomPlanet() planetsdb.Planet {
 	planets := []struct {
 		name   string
@@ -523,3 +1009,961 @@ func requireBodyMatchList(t *testing.T, body *bytes.Buffer, planets []planetsdb.
 		require.Equal(t, planets[i].Movies, planet.Movies)
 	}
 }
+
+// walkPlanets returns a WalkPlanets stub calling fn with planets and then returning err
+func walkPlanets(planets []planetsdb.Planet, err error) func(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+	return func(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+		for _, planet := range planets {
+			if err := fn(planet); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+// TestCreatedBy checks the subject of the bearer token is recorded as the creator of a planet
+func TestCreatedBy(t *testing.T) {
+	signer := tokenstest.NewSigner(t)
+	verifier := tokens.New(tokens.NewKeySet(tokenstest.WriteJWKS(t, signer)), tokenstest.Issuer, tokenstest.Audience)
+	store := memorystore.NewStore(planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+		return 5, nil
+	}))
+	server, err := planetsfactory.New(store, planetsfactory.WithTokens(verifier))
+	require.NoError(t, err)
+
+	serve := func(method, url, role string, body interface{}) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, url, bytes.NewReader(data))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+signer.Token(t, tokenstest.Claims(role+"-user", role)))
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(http.MethodPost, "/v1/planets", tokens.RoleEditor, map[string]interface{}{
+		"name":    "Tatooine",
+		"terrain": "desert",
+		"climate": "arid",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var created planetmodel.CreateResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.Equal(t, "editor-user", created.CreatedBy)
+
+	recorder = serve(http.MethodGet, fmt.Sprintf("/v1/planets/%s", created.ID.Hex()), tokens.RoleReader, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var got planetmodel.GetResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+	require.Equal(t, planetmodel.GetResponse(created), got)
+
+	recorder = serve(http.MethodDelete, fmt.Sprintf("/v1/planets/%s", created.ID.Hex()), tokens.RoleEditor, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = serve(http.MethodDelete, fmt.Sprintf("/v1/planets/%s", created.ID.Hex()), tokens.RoleAdmin, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// TestValidationAfterAuthentication checks the bodies of the anonymous requests are refused
+// before they are validated
+func TestValidationAfterAuthentication(t *testing.T) {
+	signer := tokenstest.NewSigner(t)
+	verifier := tokens.New(tokens.NewKeySet(tokenstest.WriteJWKS(t, signer)), tokenstest.Issuer, tokenstest.Audience)
+	server, err := planetsfactory.New(memorystore.NewStore(nil), planetsfactory.WithTokens(verifier))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		url          string
+		body         string
+		token        string
+		expectedCode int
+	}{
+		{name: "Anonymous", url: "/v1/planets", body: `{"terrain":1}`, expectedCode: http.StatusUnauthorized},
+		{name: "AnonymousBatch", url: "/v1/planets:batch", body: `[{"terrain":1}]`, expectedCode: http.StatusUnauthorized},
+		{name: "Authenticated", url: "/v1/planets", body: `{"terrain":1}`, token: signer.Token(t, tokenstest.Claims("editor-user", tokens.RoleEditor)), expectedCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, tc.url, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			recorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(recorder, req)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+			if tc.token == "" {
+				require.NotContains(t, recorder.Body.String(), "terrain")
+			}
+		})
+	}
+}
+
+// TestIdempotency tests that Create replays its response to the retries with the same Idempotency-Key
+func TestIdempotency(t *testing.T) {
+	planet := randomPlanet()
+	body := map[string]interface{}{
+		"name":    planet.Name,
+		"terrain": planet.Terrain,
+		"climate": planet.Climate,
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockedstore.NewMockStore(ctrl)
+	keys := idempotency.NewMemoryStore()
+	server, err := planetsfactory.New(store, planetsfactory.WithIdempotency(keys, time.Hour))
+	require.NoError(t, err)
+
+	accept := "application/json"
+	create := func(key string, body map[string]interface{}) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, "/v1/planets", bytes.NewReader(data))
+		require.NoError(t, err)
+		req.Header.Set(idempotency.Header, key)
+		req.Header.Set("Accept", accept)
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	store.EXPECT().
+		CreatePlanet(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(planet, nil)
+	first := create("create-tatooine", body)
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.Empty(t, first.Header().Get(idempotency.ReplayedHeader))
+
+	replayed := create("create-tatooine", body)
+	require.Equal(t, http.StatusCreated, replayed.Code)
+	require.Equal(t, "true", replayed.Header().Get(idempotency.ReplayedHeader))
+	require.Equal(t, first.Body.String(), replayed.Body.String())
+
+	// the replay keeps the media type of the first response
+	accept = "application/xml"
+	replayed = create("create-tatooine", body)
+	require.Equal(t, http.StatusCreated, replayed.Code)
+	require.Equal(t, first.Header().Get("Content-Type"), replayed.Header().Get("Content-Type"))
+	require.Equal(t, first.Body.String(), replayed.Body.String())
+	accept = "application/json"
+
+	otherBody := map[string]interface{}{
+		"name":    planet.Name,
+		"terrain": planet.Terrain,
+		"climate": random.String(5),
+	}
+	recorder := create("create-tatooine", otherBody)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	recorder = create(strings.Repeat("k", 256), body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// a key reserved by a request still running
+	fingerprint, err := idempotency.Fingerprint(planetmodel.CreateRequest{Name: planet.Name, Terrain: planet.Terrain, Climate: planet.Climate})
+	require.NoError(t, err)
+	_, reserved, err := keys.Reserve(context.Background(), idempotency.Record{
+		ID:          idempotency.ID("", "", "in-progress"),
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(time.Minute),
+	}, time.Now())
+	require.NoError(t, err)
+	require.True(t, reserved)
+	recorder = create("in-progress", body)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	// server errors are not replayed
+	store.EXPECT().
+		CreatePlanet(gomock.Any(), gomock.Any()).
+		Times(2).
+		Return(planetsdb.Planet{}, mongo.ErrClientDisconnected)
+	require.Equal(t, http.StatusInternalServerError, create("create-kamino", body).Code)
+	require.Equal(t, http.StatusInternalServerError, create("create-kamino", body).Code)
+}
+
+func requireBatchResults(t *testing.T, recorder *httptest.ResponseRecorder, statuses ...int) planetmodel.CreateBatchResponse {
+	var res planetmodel.CreateBatchResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.Len(t, res.Results, len(statuses))
+	for i, status := range statuses {
+		require.Equal(t, status, res.Results[i].Status, "result %d", i)
+	}
+	return res
+}
+
+func requireBodyMatchDeleteMany(t *testing.T, body *bytes.Buffer, expected planetmodel.DeleteManyResponse) {
+	var got planetmodel.DeleteManyResponse
+	require.NoError(t, json.Unmarshal(body.Bytes(), &got))
+	require.Equal(t, expected, got)
+}
+
+// TestExport tests the Export planets controller
+func TestExport(t *testing.T) {
+	planets := []planetsdb.Planet{randomPlanet(), randomPlanet()}
+	walk := walkPlanets(planets, nil)
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockedstore.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "NDJSON",
+			query: "?climate=" + planets[0].Climate,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Eq(planetsdb.ListPlanetParams{Climate: planets[0].Climate}), gomock.Any()).
+					Times(1).
+					DoAndReturn(walk)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+				require.Equal(t, `attachment; filename="planets.ndjson"`, recorder.Header().Get("Content-Disposition"))
+				lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+				require.Len(t, lines, len(planets))
+				for i, line := range lines {
+					var got planetmodel.ListResponse
+					require.NoError(t, json.Unmarshal([]byte(line), &got))
+					require.Equal(t, planetmodel.ListResponse(planets[i]), got)
+				}
+			},
+		},
+		{
+			name:  "CSV",
+			query: "?format=csv",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(walk)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+				lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+				require.Equal(t, "_id,name,terrain,climate,movies,created_by", lines[0])
+				require.Len(t, lines, len(planets)+1)
+			},
+		},
+		{
+			name:  "JSON",
+			query: "?format=json",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(walk)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchList(t, recorder.Body, planets)
+			},
+		},
+		{
+			name:  "Empty",
+			query: "?format=json",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "[]\n", recorder.Body.String())
+			},
+		},
+		{
+			name:  "InvalidFormat",
+			query: "?format=xml",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(mongo.ErrClientDisconnected)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockedstore.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server, err := planetsfactory.New(store)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodGet, "/v1/planets/export"+tc.query, nil)
+			require.NoError(t, err)
+			server.Router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+// TestImport tests the Import planets controller
+func TestImport(t *testing.T) {
+	planet := randomPlanet()
+	created := func(ctx context.Context, arg planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+		results := make([]planetsdb.CreatePlanetResult, len(arg.Planets))
+		for i, p := range arg.Planets {
+			results[i].Planet = planetsdb.Planet{ID: primitive.NewObjectID(), Name: p.Name, Terrain: p.Terrain, Climate: p.Climate, Movies: p.Movies}
+		}
+		return results, nil
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		body          string
+		buildStubs    func(store *mockedstore.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "NDJSON",
+			body: fmt.Sprintf(`{"name":%q,"terrain":%q,"climate":%q}`, planet.Name, planet.Terrain, planet.Climate) + "\n" +
+				`{"name":"Kamino","terrain":"ocean"}` + "\n" +
+				`{"name":` + "\n" +
+				`{"name":"Endor","terrain":"forest","climate":"temperate"}`,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Eq(planetsdb.CreatePlanetsParams{Planets: []planetsdb.CreatePlanetParams{
+						{Name: planet.Name, Terrain: planet.Terrain, Climate: planet.Climate},
+						{Name: "Endor", Terrain: "forest", Climate: "temperate"},
+					}})).
+					Times(1).
+					Return([]planetsdb.CreatePlanetResult{
+						{Planet: planet},
+						{Err: fmt.Errorf("create planet: %s: %s", errorsmodel.InvalidPlanetName, "Endor")},
+					}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				res := requireImportResponse(t, recorder, 1, 2, 3, 4)
+				require.Equal(t, fmt.Sprintf("create planet: %s: %s", errorsmodel.InvalidPlanetName, "Endor"), res.Errors[2].Error)
+			},
+		},
+		{
+			name:  "CSVWithoutLookup",
+			query: "?format=csv&lookup=false",
+			body:  "name,terrain,climate,movies\nTatooine,desert,arid,5\nKamino,ocean,temperate,\nEndor,forest,temperate,-1\n",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Eq(planetsdb.CreatePlanetsParams{
+						Planets:    []planetsdb.CreatePlanetParams{{Name: "Tatooine", Terrain: "desert", Climate: "arid", Movies: 5}},
+						SkipLookup: true,
+					})).
+					Times(1).
+					DoAndReturn(created)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				res := requireImportResponse(t, recorder, 1, 3, 4)
+				require.Equal(t, errorsmodel.MissingMovies, res.Errors[0].Error)
+			},
+		},
+		{
+			name:  "JSON",
+			query: "?format=json",
+			body:  `[{"name":"Tatooine","terrain":"desert","climate":"arid"}, 3]`,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(created)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireImportResponse(t, recorder, 1, 2)
+			},
+		},
+		{
+			name:  "CSVMissingColumn",
+			query: "?format=csv",
+			body:  "name,terrain\nTatooine,desert\n",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				res := requireImportResponse(t, recorder, 0, 1)
+				require.Equal(t, fmt.Sprintf("%s: %s", errorsmodel.MissingColumn, "climate"), res.Errors[0].Error)
+			},
+		},
+		{
+			name:  "InvalidFormat",
+			query: "?format=xml",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			body: `{"name":"Tatooine","terrain":"desert","climate":"arid"}`,
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					CreatePlanets(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, mongo.ErrClientDisconnected)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockedstore.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server, err := planetsfactory.New(store)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodPost, "/v1/planets/import"+tc.query, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			server.Router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+// TestExportImportRoundTrip moves the planets of a store to another one through an export file
+func TestExportImportRoundTrip(t *testing.T) {
+	movies := planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+		return 5, nil
+	})
+	source := memorystore.NewStore(movies)
+	for _, name := range []string{"Tatooine", "Kamino", "Alderaan"} {
+		_, err := source.CreatePlanet(context.Background(), planetsdb.CreatePlanetParams{Name: name, Terrain: random.String(6), Climate: random.String(5)})
+		require.NoError(t, err)
+	}
+	planets, err := source.ListPlanets(context.Background(), planetsdb.ListPlanetParams{})
+	require.NoError(t, err)
+
+	for _, format := range []string{"ndjson", "csv", "json"} {
+		t.Run(format, func(t *testing.T) {
+			sourceServer, err := planetsfactory.New(source)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/v1/planets/export?format="+format, nil)
+			require.NoError(t, err)
+			sourceServer.Router.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			// the target fails every lookup, the movies come from the file
+			target := memorystore.NewStore(planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+				return -1, fmt.Errorf("unexpected lookup of %s", name)
+			}))
+			targetServer, err := planetsfactory.New(target)
+			require.NoError(t, err)
+			file := recorder.Body.String()
+			recorder = httptest.NewRecorder()
+			req, err = http.NewRequest(http.MethodPost, "/v1/planets/import?lookup=false&format="+format, strings.NewReader(file))
+			require.NoError(t, err)
+			targetServer.Router.ServeHTTP(recorder, req)
+			requireImportResponse(t, recorder, len(planets))
+
+			for _, planet := range planets {
+				imported, err := target.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: planet.Climate})
+				require.NoError(t, err)
+				require.Len(t, imported, 1)
+				require.Equal(t, planet.Name, imported[0].Name)
+				require.Equal(t, planet.Terrain, imported[0].Terrain)
+				require.Equal(t, planet.Movies, imported[0].Movies)
+			}
+		})
+	}
+}
+
+// requireImportResponse checks that the import answered 200 with imported planets and errors on the
+// failedLines only
+func requireImportResponse(t *testing.T, recorder *httptest.ResponseRecorder, imported int, failedLines ...int) planetmodel.ImportResponse {
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var res planetmodel.ImportResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.Equal(t, imported, res.Imported)
+	require.Equal(t, len(failedLines), res.Failed)
+	require.Len(t, res.Errors, len(failedLines))
+	for i, line := range failedLines {
+		require.Equal(t, line, res.Errors[i].Line)
+	}
+	return res
+}
+
+// TestImportBodyLimit tests that the imports are refused or cut short past the body limit
+func TestImportBodyLimit(t *testing.T) {
+	store := memorystore.NewStore(planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+		return 5, nil
+	}))
+	server, err := planetsfactory.New(store, planetsfactory.WithBodyLimits(planetsfactory.BodyLimits{Import: 100}))
+	require.NoError(t, err)
+
+	body := `{"name":"Tatooine","terrain":"desert","climate":"arid"}` + "\n" +
+		`{"name":"Kamino","terrain":"ocean","climate":"temperate"}` + "\n"
+	serve := func(contentLength int64) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/v1/planets/import", strings.NewReader(body))
+		require.NoError(t, err)
+		req.ContentLength = contentLength
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(int64(len(body)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	// a chunked body is imported up to the line crossing the limit
+	res := requireImportResponse(t, serve(-1), 1, 2)
+	require.Equal(t, errorsmodel.RequestBodyTooLarge, res.Errors[0].Error)
+}
+
+// TestCreateBatchBodyLimit tests that the batches are refused past the body limit before they
+// are read whole
+func TestCreateBatchBodyLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockedstore.NewMockStore(ctrl)
+	store.EXPECT().CreatePlanets(gomock.Any(), gomock.Any()).Times(0)
+	server, err := planetsfactory.New(store)
+	require.NoError(t, err)
+
+	batch := make([]map[string]interface{}, 500)
+	for i := range batch {
+		batch[i] = map[string]interface{}{"name": "Tatooine", "terrain": strings.Repeat("desert ", 300), "climate": "arid"}
+	}
+	body, err := json.Marshal(batch)
+	require.NoError(t, err)
+	require.Greater(t, len(body), planetsfactory.DefaultBatchBodyLimit)
+
+	for _, contentLength := range []int64{int64(len(body)), -1} {
+		req, err := http.NewRequest(http.MethodPost, "/v1/planets:batch", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = contentLength
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+}
+
+// TestRateLimit tests that each planet of a batch or import costs a write and that the
+// requests failing the authentication are limited by IP
+func TestRateLimit(t *testing.T) {
+	newServer := func(t *testing.T, write int, options ...planetsfactory.Option) *planetsfactory.Factory {
+		store := memorystore.NewStore(planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+			return 5, nil
+		}))
+		limit := ratelimit.Limit{Requests: write, Period: time.Hour}
+		server, err := planetsfactory.New(store, append(options, planetsfactory.WithRateLimit(ratelimit.NewMemoryStore(), limit, limit))...)
+		require.NoError(t, err)
+		return server
+	}
+	serve := func(server *planetsfactory.Factory, method, url, body string, header http.Header) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	planets := func(n int) []map[string]interface{} {
+		batch := make([]map[string]interface{}, n)
+		for i := range batch {
+			batch[i] = map[string]interface{}{"name": fmt.Sprintf("Planet %d", i), "terrain": "desert", "climate": "arid"}
+		}
+		return batch
+	}
+
+	t.Run("Batch", func(t *testing.T) {
+		server := newServer(t, 3)
+		body, err := json.Marshal(planets(5))
+		require.NoError(t, err)
+
+		// the batch overdraws the bucket, which is paid off before the next write
+		recorder := serve(server, http.MethodPost, "/v1/planets:batch", string(body), nil)
+		require.Equal(t, http.StatusMultiStatus, recorder.Code)
+		recorder = serve(server, http.MethodPost, "/v1/planets:batch", string(body), nil)
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	})
+
+	t.Run("BatchOverLimit", func(t *testing.T) {
+		server := newServer(t, 3)
+		recorder := serve(server, http.MethodPost, "/v1/planets", `{"name":"Tatooine","terrain":"desert","climate":"arid"}`, nil)
+		require.Equal(t, http.StatusCreated, recorder.Code)
+		recorder = serve(server, http.MethodPost, "/v1/planets", `{"name":"Kamino","terrain":"ocean","climate":"temperate"}`, nil)
+		require.Equal(t, http.StatusCreated, recorder.Code)
+
+		// the batch is refused once its first planet took the last token
+		body, err := json.Marshal(planets(2))
+		require.NoError(t, err)
+		recorder = serve(server, http.MethodPost, "/v1/planets:batch", string(body), nil)
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		require.NotEmpty(t, recorder.Header().Get("Retry-After"))
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		server := newServer(t, 150)
+		var body strings.Builder
+		for _, planet := range planets(250) {
+			data, err := json.Marshal(planet)
+			require.NoError(t, err)
+			body.Write(data)
+			body.WriteString("\n")
+		}
+
+		// the chunks of 100 planets are imported until the bucket is in debt
+		recorder := serve(server, http.MethodPost, "/v1/planets/import", body.String(), nil)
+		res := requireImportResponse(t, recorder, 200, lineRange(201, 250)...)
+		require.Equal(t, errorsmodel.RateLimitExceeded, res.Errors[0].Error)
+		require.Zero(t, res.TruncatedAt)
+	})
+
+	t.Run("ImportTruncated", func(t *testing.T) {
+		server := newServer(t, 150)
+		var body strings.Builder
+		for _, planet := range planets(350) {
+			data, err := json.Marshal(planet)
+			require.NoError(t, err)
+			body.Write(data)
+			body.WriteString("\n")
+		}
+
+		// the lines after the chunk over the rate limit are not read
+		recorder := serve(server, http.MethodPost, "/v1/planets/import", body.String(), nil)
+		res := requireImportResponse(t, recorder, 200, lineRange(201, 300)...)
+		require.Equal(t, errorsmodel.RateLimitExceeded, res.Errors[0].Error)
+		require.Equal(t, 301, res.TruncatedAt)
+	})
+
+	t.Run("IP", func(t *testing.T) {
+		signer := tokenstest.NewSigner(t)
+		verifier := tokens.New(tokens.NewKeySet(tokenstest.WriteJWKS(t, signer)), tokenstest.Issuer, tokenstest.Audience)
+		server := newServer(t, 100,
+			planetsfactory.WithTokens(verifier),
+			planetsfactory.WithIPRateLimit(ratelimit.NewMemoryStore(), ratelimit.Limit{Requests: 2, Period: time.Hour}),
+		)
+
+		invalid := http.Header{"Authorization": {"Bearer invalid"}}
+		require.Equal(t, http.StatusUnauthorized, serve(server, http.MethodGet, "/v1/planets", "", invalid).Code)
+		require.Equal(t, http.StatusUnauthorized, serve(server, http.MethodGet, "/v1/planets", "", invalid).Code)
+		require.Equal(t, http.StatusTooManyRequests, serve(server, http.MethodGet, "/v1/planets", "", invalid).Code)
+	})
+}
+
+func lineRange(from, to int) []int {
+	lines := make([]int, 0, to-from+1)
+	for line := from; line <= to; line++ {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// TestNegotiation tests the media types the planet routes answer with
+func TestNegotiation(t *testing.T) {
+	planets := []planetsdb.Planet{randomPlanet(), randomPlanet()}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		accept        string
+		buildStubs    func(store *mockedstore.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "ListCSV",
+			method: http.MethodGet,
+			path:   "/v1/planets",
+			accept: "text/csv",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(walkPlanets(planets, nil))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+				lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+				require.Equal(t, []string{
+					"_id,name,terrain,climate,movies,created_by",
+					fmt.Sprintf("%s,%s,%s,%s,%d,", planets[0].ID.Hex(), planets[0].Name, planets[0].Terrain, planets[0].Climate, planets[0].Movies),
+					fmt.Sprintf("%s,%s,%s,%s,%d,", planets[1].ID.Hex(), planets[1].Name, planets[1].Terrain, planets[1].Climate, planets[1].Movies),
+				}, lines)
+			},
+		},
+		{
+			name:   "ListNDJSON",
+			method: http.MethodGet,
+			path:   "/v1/planets",
+			accept: "application/x-ndjson",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(walkPlanets(planets, nil))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+				lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+				require.Len(t, lines, len(planets))
+				for i, line := range lines {
+					var got planetmodel.ListResponse
+					require.NoError(t, json.Unmarshal([]byte(line), &got))
+					require.Equal(t, planetmodel.ListResponse(planets[i]), got)
+				}
+			},
+		},
+		{
+			name:   "ListYAML",
+			method: http.MethodGet,
+			path:   "/v1/planets",
+			accept: "application/yaml",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					ListPlanets(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(planets, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/yaml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Body.String(), "- _id: "+planets[0].ID.Hex()+"\n")
+			},
+		},
+		{
+			name:   "PlanetXML",
+			method: http.MethodGet,
+			path:   "/v1/planets/" + planets[0].ID.Hex(),
+			accept: "application/xml",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					GetPlanet(gomock.Any(), gomock.Eq(planets[0].ID.Hex())).
+					Times(1).
+					Return(planets[0], nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Body.String(), fmt.Sprintf("<response><_id>%s</_id><name>%s</name>", planets[0].ID.Hex(), planets[0].Name))
+			},
+		},
+		{
+			name:   "NotFoundYAML",
+			method: http.MethodGet,
+			path:   "/v1/planets/" + planets[0].ID.Hex(),
+			accept: "application/x-yaml",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					GetPlanet(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.PlanetDoesNotExist))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Equal(t, "application/x-yaml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Body.String(), fmt.Sprintf("error: 'get planet: %s'\n", errorsmodel.PlanetDoesNotExist))
+			},
+		},
+		{
+			name:   "DeleteNotAcceptable",
+			method: http.MethodDelete,
+			path:   "/v1/planets/" + planets[0].ID.Hex(),
+			accept: "text/csv",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					DeletePlanet(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotAcceptable, recorder.Code)
+				require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockedstore.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server, err := planetsfactory.New(store)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Accept", tc.accept)
+			server.Router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	planets := []planetsdb.Planet{randomPlanet(), randomPlanet()}
+	planet := planets[0]
+	projected := make([]planetsdb.Planet, 0, len(planets))
+	for _, p := range planets {
+		projected = append(projected, planetsdb.Planet{ID: p.ID, Name: p.Name})
+	}
+
+	testCases := []struct {
+		name          string
+		path          string
+		accept        string
+		buildStubs    func(store *mockedstore.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Planet",
+			path: "/v1/planets/" + planet.ID.Hex() + "?fields=movies,name,movies",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					GetPlanet(gomock.Any(), gomock.Eq(planet.ID.Hex()), "_id", "movies", "name").
+					Times(1).
+					Return(planetsdb.Planet{ID: planet.ID, Name: planet.Name, Movies: planet.Movies}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, fmt.Sprintf(`{"_id":"%s","name":"%s","movies":%d}`, planet.ID.Hex(), planet.Name, planet.Movies), recorder.Body.String())
+			},
+		},
+		{
+			name: "PlanetUnknownField",
+			path: "/v1/planets/" + planet.ID.Hex() + "?fields=name,diameter",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					GetPlanet(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), errorsmodel.UnknownField+": diameter")
+			},
+		},
+		{
+			name: "List",
+			path: "/v1/planets?fields=name",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Eq(planetsdb.ListPlanetParams{Fields: []string{"_id", "name"}}), gomock.Any()).
+					Times(1).
+					DoAndReturn(walkPlanets(projected, nil))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var got []map[string]interface{}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Len(t, got, len(planets))
+				for i, object := range got {
+					require.Equal(t, map[string]interface{}{"_id": planets[i].ID.Hex(), "name": planets[i].Name}, object)
+				}
+			},
+		},
+		{
+			name:   "ListCSV",
+			path:   "/v1/planets?fields=_id",
+			accept: "text/csv",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Eq(planetsdb.ListPlanetParams{Fields: []string{"_id"}}), gomock.Any()).
+					Times(1).
+					DoAndReturn(walkPlanets(projected, nil))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "_id\n"+planets[0].ID.Hex()+"\n"+planets[1].ID.Hex()+"\n", recorder.Body.String())
+			},
+		},
+		{
+			name:   "ListXML",
+			path:   "/v1/planets?fields=name",
+			accept: "application/xml",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					ListPlanets(gomock.Any(), gomock.Eq(planetsdb.ListPlanetParams{Fields: []string{"_id", "name"}})).
+					Times(1).
+					Return(projected, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(),
+					fmt.Sprintf("<item><_id>%s</_id><name>%s</name></item>", planets[0].ID.Hex(), planets[0].Name))
+				require.NotContains(t, recorder.Body.String(), "<movies>")
+			},
+		},
+		{
+			name: "ListUnknownField",
+			path: "/v1/planets?fields=name,password",
+			buildStubs: func(store *mockedstore.MockStore) {
+				store.EXPECT().
+					WalkPlanets(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockedstore.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server, err := planetsfactory.New(store)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			server.Router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -1,48 +1,374 @@
 package planetsfactory
 
 import (
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens"
+	apikeycontroller "github.com/gmaschi/b2w-sw-planets/internal/controllers/api-key"
+	healthcontroller "github.com/gmaschi/b2w-sw-planets/internal/controllers/health"
 	planetcontroller "github.com/gmaschi/b2w-sw-planets/internal/controllers/planet"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
+	authmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/auth"
+	bodylimitmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/body-limit"
+	deadlinemiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/deadline"
+	loggermiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/logger"
+	metricsmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/metrics"
+	ratelimitmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/rate-limit"
+	validationmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/validation"
+	planetmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	"github.com/gmaschi/b2w-sw-planets/internal/openapi"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
 	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
 )
 
 type (
 	Factory struct {
-		store          planetsdb.Store
-		planetsHandler planetsHandler
-		Router         *gin.Engine
+		store             planetsdb.Store
+		planetsHandler    planetsHandler
+		planetsMiddleware []gin.HandlerFunc
+		apiKeys           apikeys.Store
+		authOptions       []authmiddleware.Option
+		authenticate      gin.HandlerFunc
+		rateLimit         gin.HandlerFunc
+		ipRateLimit       gin.HandlerFunc
+		idempotency       idempotency.Store
+		idempotencyTTL    time.Duration
+		trustedProxies    []string
+		healthChecks      []healthcontroller.Check
+		healthTimeout     time.Duration
+		metricsRegistry   *prometheus.Registry
+		metricsPath       string
+		tracingService    string
+		logger            *zap.Logger
+		redactedHeaders   []string
+		timeouts          Timeouts
+		bodyLimits        BodyLimits
+		server            *http.Server
+		Router            *gin.Engine
+	}
+
+	// Timeouts bounds the phases of each HTTP connection, zero means no timeout
+	Timeouts struct {
+		ReadHeader time.Duration
+		Read       time.Duration
+		Write      time.Duration
+		Idle       time.Duration
+		// Stream replaces Read and Write for the routes streaming a file or list of planets
+		Stream time.Duration
+	}
+
+	// BodyLimits bounds the request bodies of the routes reading large ones, in bytes, zero
+	// means no limit
+	BodyLimits struct {
+		Import int64
+		Batch  int64
 	}
 
 	planetsHandler struct {
 		planetsController *planetcontroller.Controller
 	}
+
+	apiKeysHandler struct {
+		apiKeyController *apikeycontroller.Controller
+	}
+
+	healthHandler struct {
+		healthController *healthcontroller.Controller
+	}
+
+	// Option configures a Factory
+	Option func(*Factory)
 )
 
-func New(store planetsdb.Store) (*Factory, error) {
+// WithPlanetsMiddleware runs the handlers before every /v1/planets route
+func WithPlanetsMiddleware(handlers ...gin.HandlerFunc) Option {
+	return func(f *Factory) {
+		f.planetsMiddleware = append(f.planetsMiddleware, handlers...)
+	}
+}
+
+// WithHealthChecks adds the dependencies probed by /readyz, each bounded by timeout
+func WithHealthChecks(timeout time.Duration, checks ...healthcontroller.Check) Option {
+	return func(f *Factory) {
+		f.healthTimeout = timeout
+		f.healthChecks = append(f.healthChecks, checks...)
+	}
+}
+
+// WithMetrics instruments every request and exposes the metrics of registry on path
+func WithMetrics(registry *prometheus.Registry, path string) Option {
+	return func(f *Factory) {
+		f.metricsRegistry = registry
+		f.metricsPath = path
+	}
+}
+
+// WithTracing starts a span for every request, continuing the trace of its traceparent header
+func WithTracing(serviceName string) Option {
+	return func(f *Factory) {
+		f.tracingService = serviceName
+	}
+}
+
+// WithLogger logs every request and the server errors with logger, hiding the values of
+// loggermiddleware.DefaultRedactedHeaders and of redactedHeaders
+func WithLogger(logger *zap.Logger, redactedHeaders ...string) Option {
+	return func(f *Factory) {
+		f.logger = logger
+		f.redactedHeaders = redactedHeaders
+	}
+}
+
+// WithAPIKeys accepts the API keys of keys on every /v1/planets route, each route requiring
+// its scope, and serves the management of the keys under /v1/admin/api-keys
+func WithAPIKeys(keys apikeys.Store, opts ...authmiddleware.Option) Option {
+	return func(f *Factory) {
+		f.apiKeys = keys
+		f.authOptions = append(f.authOptions, authmiddleware.WithAPIKeys(keys))
+		f.authOptions = append(f.authOptions, opts...)
+	}
+}
+
+// WithTokens accepts the bearer tokens validated by verifier on every /v1/planets route, each
+// route requiring a role granting its scope
+func WithTokens(verifier *tokens.Verifier) Option {
+	return func(f *Factory) {
+		f.authOptions = append(f.authOptions, authmiddleware.WithTokens(verifier))
+	}
+}
+
+// WithRateLimit limits the /v1/planets requests of each client to read for the reads and to
+// write for the other methods, keeping the buckets in store
+func WithRateLimit(store ratelimit.Store, read, write ratelimit.Limit) Option {
+	return func(f *Factory) {
+		f.rateLimit = ratelimitmiddleware.New(store, read, write)
+	}
+}
+
+// WithIPRateLimit limits every /v1 request of each client IP to limit before the authentication,
+// so the requests with invalid credentials are limited too, keeping the buckets in store
+func WithIPRateLimit(store ratelimit.Store, limit ratelimit.Limit) Option {
+	return func(f *Factory) {
+		f.ipRateLimit = ratelimitmiddleware.ByIP(store, limit)
+	}
+}
+
+// WithIdempotency replays the response of POST /v1/planets to the retries with the same
+// Idempotency-Key header for ttl, keeping the responses in store
+func WithIdempotency(store idempotency.Store, ttl time.Duration) Option {
+	return func(f *Factory) {
+		f.idempotency = store
+		f.idempotencyTTL = ttl
+	}
+}
+
+// WithTrustedProxies trusts the X-Forwarded-For and X-Real-IP headers of the requests coming from
+// proxies, IPs or CIDRs, to find the client IP. Without it the client IP is the remote address.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(f *Factory) {
+		f.trustedProxies = proxies
+	}
+}
+
+// WithTimeouts sets the timeouts of the HTTP server
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(f *Factory) {
+		f.timeouts = timeouts
+	}
+}
+
+// DefaultBatchBodyLimit fits a batch of 500 planets of 2 KiB each
+const DefaultBatchBodyLimit = 500 * 2 << 10
+
+// WithBodyLimits bounds the request bodies of the planets import and batch. The batch is bounded
+// by DefaultBatchBodyLimit without it.
+func WithBodyLimits(limits BodyLimits) Option {
+	return func(f *Factory) {
+		f.bodyLimits = limits
+	}
+}
+
+func New(store planetsdb.Store, opts ...Option) (*Factory, error) {
 	factory := &Factory{
-		store: store,
-		planetsHandler: planetsHandler{
-			planetsController: planetcontroller.New(store),
-		},
+		store:         store,
+		healthTimeout: 2 * time.Second,
+		logger:        zap.NewNop(),
+		bodyLimits:    BodyLimits{Batch: DefaultBatchBodyLimit},
+	}
+	for _, opt := range opts {
+		opt(factory)
+	}
+	if err := planetmodel.RegisterValidators(); err != nil {
+		return nil, err
+	}
+	if len(factory.authOptions) > 0 {
+		factory.authenticate = authmiddleware.New(factory.authOptions...)
+	}
+	controllerOptions := []planetcontroller.Option{planetcontroller.WithLogger(factory.logger)}
+	if factory.idempotency != nil {
+		controllerOptions = append(controllerOptions, planetcontroller.WithIdempotency(factory.idempotency, factory.idempotencyTTL))
+	}
+	factory.planetsHandler = planetsHandler{
+		planetsController: planetcontroller.New(store, controllerOptions...),
 	}
-	router := gin.Default()
 
-	factory.setupRoutes(router)
+	router := gin.New()
+	if err := router.SetTrustedProxies(factory.trustedProxies); err != nil {
+		return nil, err
+	}
+	if factory.tracingService != "" {
+		router.Use(otelgin.Middleware(factory.tracingService))
+	}
+	router.Use(
+		loggermiddleware.RequestID(),
+		loggermiddleware.New(factory.logger, loggermiddleware.WithRedactedHeaders(factory.redactedHeaders...)),
+		loggermiddleware.Recovery(factory.logger),
+	)
+	if factory.metricsRegistry != nil {
+		router.Use(metricsmiddleware.New(factory.metricsRegistry))
+	}
+	var validationOptions []validationmiddleware.Option
+	if gin.Mode() == gin.TestMode {
+		validationOptions = append(validationOptions, validationmiddleware.WithResponses())
+	}
+	validate, err := validationmiddleware.New(openapi.Spec(), validationOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	factory.setupRoutes(router, validate)
 
 	factory.Router = router
+	factory.server = &http.Server{
+		Handler:           router,
+		ReadHeaderTimeout: factory.timeouts.ReadHeader,
+		ReadTimeout:       factory.timeouts.Read,
+		WriteTimeout:      factory.timeouts.Write,
+		IdleTimeout:       factory.timeouts.Idle,
+		ConnContext:       deadlinemiddleware.ConnContext,
+	}
 	return factory, nil
 }
 
-func (f *Factory) setupRoutes(router *gin.Engine) {
-	planetsV1 := router.Group("/v1/planets")
+// setupRoutes registers the routes. The requests are validated once the rate limits and the
+// authentication let them through, so that anonymous clients get their bodies neither parsed
+// nor described back.
+func (f *Factory) setupRoutes(router *gin.Engine, validate gin.HandlerFunc) {
+	// the bodies are bounded before the validation reads them
+	checkRequest := []gin.HandlerFunc{bodylimitmiddleware.New(map[string]int64{
+		bodylimitmiddleware.Route(http.MethodPost, "/v1/planets/import"): f.bodyLimits.Import,
+		// the custom methods are routed as a parameter, see customMethod
+		bodylimitmiddleware.Route(http.MethodPost, "/v1/planets:method"): f.bodyLimits.Batch,
+	}), validate}
+
+	health := healthHandler{
+		healthController: healthcontroller.New(f.healthTimeout, f.healthChecks...),
+	}
+	ops := router.Group("", validate)
 	{
-		planetsV1.POST("", f.planetsHandler.planetsController.Create)
-		planetsV1.GET("/:id", f.planetsHandler.planetsController.Planet)
-		planetsV1.GET("", f.planetsHandler.planetsController.List)
-		planetsV1.DELETE("/:id", f.planetsHandler.planetsController.Delete)
+		ops.GET("/healthz", negotiate.Accept(), health.healthController.Live)
+		ops.GET("/readyz", negotiate.Accept(), health.healthController.Ready)
+		ops.GET(openapi.SpecPath, openapi.ServeSpec)
+		ops.GET(openapi.DocsPath, openapi.ServeDocs)
+		if f.metricsRegistry != nil {
+			ops.GET(f.metricsPath, gin.WrapH(promhttp.HandlerFor(f.metricsRegistry, promhttp.HandlerOpts{})))
+		}
+	}
+
+	var planetsMiddleware []gin.HandlerFunc
+	if f.ipRateLimit != nil {
+		planetsMiddleware = append(planetsMiddleware, f.ipRateLimit)
+	}
+	if f.authenticate != nil {
+		planetsMiddleware = append(planetsMiddleware, f.authenticate)
+	}
+	if f.rateLimit != nil {
+		planetsMiddleware = append(planetsMiddleware, f.rateLimit)
+	}
+	// the files and streamed lists of planets take longer than the server timeouts allow
+	streamDeadline := deadlinemiddleware.Extend(f.timeouts.Stream)
+	planetsMiddleware = append(planetsMiddleware, f.planetsMiddleware...)
+	planetsMiddleware = append(planetsMiddleware, checkRequest...)
+	planetsV1 := router.Group("/v1/planets", planetsMiddleware...)
+	{
+		planetsV1.POST("", negotiated(f.scoped(apikeys.ScopeWrite, f.planetsHandler.planetsController.Create))...)
+		planetsV1.POST("/import", append([]gin.HandlerFunc{streamDeadline}, negotiated(f.scoped(apikeys.ScopeWrite, f.planetsHandler.planetsController.Import))...)...)
+		// the format query, not the Accept header, selects the media type of the exports
+		planetsV1.GET("/export", append([]gin.HandlerFunc{streamDeadline}, f.scoped(apikeys.ScopeRead, f.planetsHandler.planetsController.Export)...)...)
+		planetsV1.GET("/:id", negotiated(f.scoped(apikeys.ScopeRead, f.planetsHandler.planetsController.Planet))...)
+		planetsV1.GET("", append([]gin.HandlerFunc{streamDeadline}, negotiated(f.scoped(apikeys.ScopeRead, f.planetsHandler.planetsController.List), negotiate.MIMECSV, negotiate.MIMENDJSON)...)...)
+		planetsV1.DELETE("/:id", negotiated(f.scoped(apikeys.ScopeDelete, f.planetsHandler.planetsController.Delete))...)
+		planetsV1.DELETE("", negotiated(f.scoped(apikeys.ScopeDelete, f.planetsHandler.planetsController.DeleteMany))...)
+	}
+	batch := append([]gin.HandlerFunc{customMethod("batch")}, planetsMiddleware...)
+	router.POST("/v1/planets:method", append(batch, negotiated(f.scoped(apikeys.ScopeWrite, f.planetsHandler.planetsController.CreateBatch))...)...)
+
+	if f.apiKeys == nil {
+		return
+	}
+	keys := apiKeysHandler{
+		apiKeyController: apikeycontroller.New(f.apiKeys),
+	}
+	var apiKeysMiddleware []gin.HandlerFunc
+	if f.ipRateLimit != nil {
+		apiKeysMiddleware = append(apiKeysMiddleware, f.ipRateLimit)
+	}
+	apiKeysMiddleware = append(apiKeysMiddleware, f.authenticate, authmiddleware.RequireScope(apikeys.ScopeAdmin))
+	apiKeysMiddleware = append(apiKeysMiddleware, checkRequest...)
+	apiKeysMiddleware = append(apiKeysMiddleware, negotiate.Accept())
+	apiKeysV1 := router.Group("/v1/admin/api-keys", apiKeysMiddleware...)
+	{
+		apiKeysV1.POST("", keys.apiKeyController.Create)
+		apiKeysV1.GET("", keys.apiKeyController.List)
+		apiKeysV1.DELETE("/:id", keys.apiKeyController.Revoke)
 	}
 }
 
+// customMethod answers 404 to the requests for a custom method, such as POST /v1/planets:batch,
+// other than name. gin has no literal colons in paths, so the custom methods are routed as a
+// parameter following the collection, which also matches paths like /v1/planetsfoo.
+func customMethod(name string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Param("method") != ":"+name {
+			ctx.AbortWithStatus(http.StatusNotFound)
+		}
+	}
+}
+
+// negotiated negotiates the media type of the responses of handlers among negotiate.Offered and
+// extra before they run
+func negotiated(handlers []gin.HandlerFunc, extra ...string) []gin.HandlerFunc {
+	return append([]gin.HandlerFunc{negotiate.Accept(extra...)}, handlers...)
+}
+
+// scoped guards handler with a scope check when requests are authenticated
+func (f *Factory) scoped(scope string, handler gin.HandlerFunc) []gin.HandlerFunc {
+	if f.authenticate == nil {
+		return []gin.HandlerFunc{handler}
+	}
+	return []gin.HandlerFunc{authmiddleware.RequireScope(scope), handler}
+}
+
+// Start serves the API on address until Shutdown is called
 func (f *Factory) Start(address string) error {
-	return f.Router.Run(address)
+	f.server.Addr = address
+	err := f.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to finish or ctx to be done
+func (f *Factory) Shutdown(ctx context.Context) error {
+	return f.server.Shutdown(ctx)
 }
@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// Header carries the idempotency key of a request
+	Header = "Idempotency-Key"
+	// ReplayedHeader marks the responses replayed from a record
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// maxKeyLength bounds the idempotency keys
+	maxKeyLength = 255
+)
+
+type (
+	// Record is the outcome of the first request made with an idempotency key. It is reserved
+	// before the request runs and completed with its response.
+	Record struct {
+		// ID identifies the key within the scope of its client, see ID
+		ID string `bson:"_id"`
+		// Owner identifies the request that reserved the record, the only one completing or
+		// releasing it. A request outliving its reservation leaves the key to the next one.
+		Owner string `bson:"owner"`
+		// Fingerprint identifies the payload sent with the key
+		Fingerprint string    `bson:"fingerprint"`
+		Completed   bool      `bson:"completed"`
+		Status      int       `bson:"status"`
+		ContentType string    `bson:"content_type"`
+		Body        []byte    `bson:"body"`
+		ExpiresAt   time.Time `bson:"expires_at"`
+	}
+
+	// Store keeps the records until they expire. Expired records must be treated as missing.
+	Store interface {
+		// Reserve stores record unless a record with its ID exists, in which case the existing
+		// record is returned and reserved is false
+		Reserve(ctx context.Context, record Record, now time.Time) (existing Record, reserved bool, err error)
+		// Complete stores the response of the request that reserved the record with id as
+		// owner, keeping it until expiresAt. It fails with errorsmodel.IdempotencyKeyExpired once
+		// the record is gone or reserved by another owner.
+		Complete(ctx context.Context, id, owner string, status int, contentType string, body []byte, expiresAt time.Time) error
+		// Release forgets the record with id reserved by owner, so the request can be retried.
+		// It fails as Complete does.
+		Release(ctx context.Context, id, owner string) error
+	}
+)
+
+// ValidKey reports whether key is a usable idempotency key: not empty, at most 255 characters
+// and made of printable ASCII
+func ValidKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// ID scopes key to the tenant and the principal that sent it, so clients never see each
+// other's responses
+func ID(tenantID, subject, key string) string {
+	return hash(tenantID + "\x00" + subject + "\x00" + key)
+}
+
+// Fingerprint identifies a request payload, so a key reused with another payload is detected
+func Fingerprint(payload interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return hash(string(data)), nil
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,150 @@
+// Package idempotencytest provides a conformance test suite for idempotency.Store implementations.
+//
+// The suite uses random keys, so it can run against a store that already holds records.
+package idempotencytest
+
+import (
+	"context"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Factory creates the store under test
+type Factory func(t *testing.T) idempotency.Store
+
+// Run runs the whole conformance suite against the stores built by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store idempotency.Store)
+	}{
+		{name: "Reserve", test: testReserve},
+		{name: "Complete", test: testComplete},
+		{name: "Release", test: testRelease},
+		{name: "Expiry", test: testExpiry},
+		{name: "ExpiredReservation", test: testExpiredReservation},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore(t))
+		})
+	}
+}
+
+// newRecord returns a record with a random ID and owner, expiring a minute after now
+func newRecord(now time.Time) idempotency.Record {
+	return idempotency.Record{
+		ID:          idempotency.ID("tenant", "subject", random.String(16)),
+		Owner:       random.String(16),
+		Fingerprint: random.String(16),
+		ExpiresAt:   now.Add(time.Minute),
+	}
+}
+
+func reserve(t *testing.T, store idempotency.Store, record idempotency.Record, now time.Time) (idempotency.Record, bool) {
+	existing, reserved, err := store.Reserve(context.Background(), record, now)
+	require.NoError(t, err)
+	return existing, reserved
+}
+
+func testReserve(t *testing.T, store idempotency.Store) {
+	now := time.Now()
+	record := newRecord(now)
+
+	_, reserved := reserve(t, store, record, now)
+	require.True(t, reserved)
+
+	retry := record
+	retry.Fingerprint = random.String(16)
+	existing, reserved := reserve(t, store, retry, now)
+	require.False(t, reserved)
+	require.Equal(t, record.Fingerprint, existing.Fingerprint)
+	require.False(t, existing.Completed)
+}
+
+func testComplete(t *testing.T, store idempotency.Store) {
+	now := time.Now()
+	record := newRecord(now)
+	_, reserved := reserve(t, store, record, now)
+	require.True(t, reserved)
+
+	body := []byte(`{"name":"Tatooine"}`)
+	err := store.Complete(context.Background(), record.ID, record.Owner, http.StatusCreated, "application/xml; charset=utf-8", body, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	// the completed record outlives the reservation
+	existing, reserved := reserve(t, store, record, now.Add(30*time.Minute))
+	require.False(t, reserved)
+	require.True(t, existing.Completed)
+	require.Equal(t, http.StatusCreated, existing.Status)
+	require.Equal(t, "application/xml; charset=utf-8", existing.ContentType)
+	require.Equal(t, body, existing.Body)
+	require.Equal(t, record.Fingerprint, existing.Fingerprint)
+}
+
+func testRelease(t *testing.T, store idempotency.Store) {
+	now := time.Now()
+	record := newRecord(now)
+	_, reserved := reserve(t, store, record, now)
+	require.True(t, reserved)
+
+	require.NoError(t, store.Release(context.Background(), record.ID, record.Owner))
+
+	_, reserved = reserve(t, store, record, now)
+	require.True(t, reserved)
+}
+
+func testExpiry(t *testing.T, store idempotency.Store) {
+	now := time.Now()
+	record := newRecord(now)
+	_, reserved := reserve(t, store, record, now)
+	require.True(t, reserved)
+	require.NoError(t, store.Complete(context.Background(), record.ID, record.Owner, http.StatusCreated, "application/json; charset=utf-8", []byte(`{}`), now.Add(time.Hour)))
+
+	// an expired record is treated as missing, so the key can be reserved again
+	later := now.Add(2 * time.Hour)
+	retry := record
+	retry.ExpiresAt = later.Add(time.Minute)
+	existing, reserved := reserve(t, store, retry, later)
+	require.True(t, reserved)
+	require.False(t, existing.Completed)
+}
+
+func testExpiredReservation(t *testing.T, store idempotency.Store) {
+	now := time.Now()
+	record := newRecord(now)
+	_, reserved := reserve(t, store, record, now)
+	require.True(t, reserved)
+
+	// the key is reserved again once the first reservation expires
+	later := now.Add(2 * time.Minute)
+	retry := newRecord(later)
+	retry.ID = record.ID
+	_, reserved = reserve(t, store, retry, later)
+	require.True(t, reserved)
+
+	// the request that lost its reservation neither completes nor releases the new one
+	err := store.Complete(context.Background(), record.ID, record.Owner, http.StatusCreated, "application/json; charset=utf-8", []byte(`{}`), later.Add(time.Hour))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errorsmodel.IdempotencyKeyExpired)
+	err = store.Release(context.Background(), record.ID, record.Owner)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errorsmodel.IdempotencyKeyExpired)
+
+	existing, reserved := reserve(t, store, retry, later)
+	require.False(t, reserved)
+	require.Equal(t, retry.Owner, existing.Owner)
+	require.False(t, existing.Completed)
+
+	require.NoError(t, store.Complete(context.Background(), retry.ID, retry.Owner, http.StatusCreated, "application/json; charset=utf-8", []byte(`{}`), later.Add(time.Hour)))
+	existing, reserved = reserve(t, store, retry, later)
+	require.False(t, reserved)
+	require.True(t, existing.Completed)
+}
@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store forgets the expired records
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the records in the process, so retries must reach the same replica
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	swept   time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Reserve stores record unless an unexpired record with its ID exists
+func (ms *MemoryStore) Reserve(ctx context.Context, record Record, now time.Time) (Record, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if now.Sub(ms.swept) > sweepInterval {
+		for id, r := range ms.records {
+			if !now.Before(r.ExpiresAt) {
+				delete(ms.records, id)
+			}
+		}
+		ms.swept = now
+	}
+
+	if existing, ok := ms.records[record.ID]; ok && now.Before(existing.ExpiresAt) {
+		return existing, false, nil
+	}
+	ms.records[record.ID] = record
+	return record, true, nil
+}
+
+// Complete stores the response of the record with id reserved by owner
+func (ms *MemoryStore) Complete(ctx context.Context, id, owner string, status int, contentType string, body []byte, expiresAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, ok := ms.records[id]
+	if !ok || record.Owner != owner {
+		return fmt.Errorf("complete idempotency key: %s", errorsmodel.IdempotencyKeyExpired)
+	}
+	record.Completed = true
+	record.Status = status
+	record.ContentType = contentType
+	record.Body = body
+	record.ExpiresAt = expiresAt
+	ms.records[id] = record
+	return nil
+}
+
+// Release forgets the record with id reserved by owner
+func (ms *MemoryStore) Release(ctx context.Context, id, owner string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, ok := ms.records[id]
+	if !ok || record.Owner != owner {
+		return fmt.Errorf("release idempotency key: %s", errorsmodel.IdempotencyKeyExpired)
+	}
+	delete(ms.records, id)
+	return nil
+}
@@ -0,0 +1,13 @@
+package idempotency_test
+
+import (
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency/idempotencytest"
+	"testing"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	idempotencytest.Run(t, func(t *testing.T) idempotency.Store {
+		return idempotency.NewMemoryStore()
+	})
+}
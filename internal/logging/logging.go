@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"context"
+	requestid "github.com/gmaschi/b2w-sw-planets/pkg/tools/request-id"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New creates a logger writing JSON lines to stderr at level and above: debug, info, warn or error
+func New(level string) (*zap.Logger, error) {
+	var zapLevel zapcore.Level
+	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(zapLevel)
+	cfg.EncoderConfig.TimeKey = "time"
+	cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	cfg.EncoderConfig.EncodeDuration = zapcore.StringDurationEncoder
+	cfg.DisableStacktrace = true
+	cfg.Sampling = nil
+	return cfg.Build()
+}
+
+// ForRequest returns logger annotated with the ID of the request in ctx, if any
+func ForRequest(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := requestid.FromContext(ctx); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
@@ -0,0 +1,213 @@
+package authmiddleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	// TenantKey holds the tenant the credentials of an authenticated request are bound to in the
+	// gin context, unset when they are bound to none
+	TenantKey = "auth.tenant"
+
+	// principalKey holds the Principal of an authenticated request in the gin context
+	principalKey = "auth.principal"
+)
+
+// roleScopes grants the scopes of each token role: readers list and get the planets, editors
+// also create them and admins also delete them and manage the API keys
+var roleScopes = map[string][]string{
+	tokens.RoleReader: {apikeys.ScopeRead},
+	tokens.RoleEditor: {apikeys.ScopeRead, apikeys.ScopeWrite},
+	tokens.RoleAdmin:  {apikeys.ScopeRead, apikeys.ScopeWrite, apikeys.ScopeDelete, apikeys.ScopeAdmin},
+}
+
+type (
+	// Principal is the authenticated caller of a request
+	Principal struct {
+		// Subject identifies the caller, the ID of its API key or the subject of its token
+		Subject string
+		Scopes  []string
+		// Tenant is the tenant the credentials are bound to, empty for none
+		Tenant string
+	}
+
+	authenticator struct {
+		keys         apikeys.Store
+		bootstrapKey string
+		tokens       *tokens.Verifier
+	}
+
+	// Option configures the authentication
+	Option func(*authenticator)
+)
+
+// WithAPIKeys authenticates the requests carrying an X-API-Key header against keys
+func WithAPIKeys(keys apikeys.Store) Option {
+	return func(a *authenticator) {
+		a.keys = keys
+	}
+}
+
+// WithBootstrapKey accepts key with every scope without looking it up, so the first API keys
+// can be created
+func WithBootstrapKey(key string) Option {
+	return func(a *authenticator) {
+		a.bootstrapKey = key
+	}
+}
+
+// WithTokens authenticates the requests carrying an Authorization: Bearer header with verifier,
+// granting the scopes of the token roles
+func WithTokens(verifier *tokens.Verifier) Option {
+	return func(a *authenticator) {
+		a.tokens = verifier
+	}
+}
+
+// New creates a middleware that authenticates requests by their bearer token or API key,
+// rejecting the requests without valid credentials
+func New(opts ...Option) gin.HandlerFunc {
+	a := &authenticator{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return func(ctx *gin.Context) {
+		if token, ok := bearerToken(ctx); ok && a.tokens != nil {
+			a.authenticateToken(ctx, token)
+			return
+		}
+
+		key := strings.TrimSpace(ctx.GetHeader(APIKeyHeader))
+		if key == "" || (a.keys == nil && a.bootstrapKey == "") {
+			a.unauthorized(ctx, errors.New(errorsmodel.MissingCredentials))
+			return
+		}
+		a.authenticateKey(ctx, key)
+	}
+}
+
+func (a *authenticator) authenticateToken(ctx *gin.Context, token string) {
+	identity, err := a.tokens.Verify(ctx.Request.Context(), token)
+	if err != nil {
+		// the reason is only logged, callers are told the token is invalid
+		_ = ctx.Error(err)
+		ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		negotiate.Abort(ctx, http.StatusUnauthorized, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.InvalidToken)))
+		return
+	}
+
+	var scopes []string
+	for _, role := range identity.Roles {
+		scopes = append(scopes, roleScopes[role]...)
+	}
+	setPrincipal(ctx, Principal{Subject: identity.Subject, Scopes: scopes, Tenant: identity.Tenant})
+	ctx.Next()
+}
+
+func (a *authenticator) authenticateKey(ctx *gin.Context, key string) {
+	if a.bootstrapKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(a.bootstrapKey)) == 1 {
+		setPrincipal(ctx, Principal{
+			Subject: "bootstrap",
+			Scopes:  []string{apikeys.ScopeRead, apikeys.ScopeWrite, apikeys.ScopeDelete, apikeys.ScopeAdmin},
+		})
+		ctx.Next()
+		return
+	}
+	if a.keys == nil {
+		a.unauthorized(ctx, errors.New(errorsmodel.InvalidAPIKey))
+		return
+	}
+
+	stored, err := a.keys.KeyByHash(ctx.Request.Context(), apikeys.Hash(key))
+	if err != nil {
+		if strings.HasSuffix(err.Error(), errorsmodel.APIKeyDoesNotExist) {
+			a.unauthorized(ctx, errors.New(errorsmodel.InvalidAPIKey))
+			return
+		}
+		negotiate.Abort(ctx, http.StatusInternalServerError, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+	if stored.Revoked() {
+		a.unauthorized(ctx, errors.New(errorsmodel.InvalidAPIKey))
+		return
+	}
+
+	setPrincipal(ctx, Principal{Subject: stored.ID, Scopes: stored.GrantedScopes(), Tenant: stored.Tenant})
+	ctx.Next()
+}
+
+// setPrincipal stores the principal of the request and the tenant it is bound to
+func setPrincipal(ctx *gin.Context, principal Principal) {
+	ctx.Set(principalKey, principal)
+	if principal.Tenant != "" {
+		ctx.Set(TenantKey, principal.Tenant)
+	}
+}
+
+// unauthorized rejects the request, challenging for a bearer token when tokens are accepted
+func (a *authenticator) unauthorized(ctx *gin.Context, err error) {
+	if a.tokens != nil {
+		ctx.Header("WWW-Authenticate", "Bearer")
+	}
+	negotiate.Abort(ctx, http.StatusUnauthorized, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+}
+
+// RequireScope creates a middleware that rejects the requests whose principal lacks scope.
+// It must run after an authentication middleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, ok := PrincipalFromContext(ctx)
+		if !ok {
+			negotiate.Abort(ctx, http.StatusUnauthorized, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.MissingCredentials)))
+			return
+		}
+		if !principal.HasScope(scope) {
+			err := errors.New(errorsmodel.InsufficientScope + ": " + scope)
+			negotiate.Abort(ctx, http.StatusForbidden, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// PrincipalFromContext returns the principal authenticated for the request
+func PrincipalFromContext(ctx *gin.Context) (Principal, bool) {
+	principal, ok := ctx.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+	p, ok := principal.(Principal)
+	return p, ok
+}
+
+// HasScope reports whether the principal was granted scope
+func (p Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of an Authorization: Bearer header
+func bearerToken(ctx *gin.Context) (string, bool) {
+	parts := strings.SplitN(strings.TrimSpace(ctx.GetHeader("Authorization")), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	token := strings.TrimSpace(parts[1])
+	return token, token != ""
+}
@@ -0,0 +1,181 @@
+package authmiddleware_test
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/tokens/tokenstest"
+	authmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/auth"
+	memorystore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/memory/planets-db"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+const bootstrapKey = "bootstrap-bootstrap-bootstrap-bootstrap"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := memorystore.NewKeyStore()
+	reader := createKey(t, keys, apikeys.ScopeRead)
+	writer := createKey(t, keys, apikeys.ScopeRead, apikeys.ScopeWrite)
+	revoked := createKey(t, keys, apikeys.ScopeRead, apikeys.ScopeWrite)
+	stored, err := keys.KeyByHash(context.Background(), apikeys.Hash(revoked))
+	require.NoError(t, err)
+	require.NoError(t, keys.RevokeKey(context.Background(), stored.ID, time.Now()))
+
+	signer := tokenstest.NewSigner(t)
+	verifier := tokens.New(tokens.NewKeySet(tokenstest.WriteJWKS(t, signer)), tokenstest.Issuer, tokenstest.Audience)
+	readerToken := "Bearer " + signer.Token(t, tokenstest.Claims("luke", tokens.RoleReader))
+	editorToken := "Bearer " + signer.Token(t, tokenstest.Claims("leia", tokens.RoleEditor))
+	adminToken := "Bearer " + signer.Token(t, tokenstest.Claims("yoda", tokens.RoleAdmin))
+	forgedToken := "Bearer " + tokenstest.NewSigner(t).Token(t, tokenstest.Claims("vader", tokens.RoleAdmin))
+
+	router := newRouter(
+		authmiddleware.WithAPIKeys(keys),
+		authmiddleware.WithBootstrapKey(bootstrapKey),
+		authmiddleware.WithTokens(verifier),
+	)
+
+	testCases := []struct {
+		name          string
+		key           string
+		authorization string
+		method        string
+		url           string
+		expectedCode  int
+	}{
+		{name: "Missing", method: http.MethodGet, url: "/read", expectedCode: http.StatusUnauthorized},
+		{name: "Unknown", key: "swp_unknown", method: http.MethodGet, url: "/read", expectedCode: http.StatusUnauthorized},
+		{name: "Revoked", key: revoked, method: http.MethodGet, url: "/read", expectedCode: http.StatusUnauthorized},
+		{name: "Read", key: reader, method: http.MethodGet, url: "/read", expectedCode: http.StatusOK},
+		{name: "WriteWithReadScope", key: reader, method: http.MethodPost, url: "/write", expectedCode: http.StatusForbidden},
+		{name: "Write", key: writer, method: http.MethodPost, url: "/write", expectedCode: http.StatusOK},
+		{name: "DeleteWithReadScope", key: reader, method: http.MethodDelete, url: "/delete", expectedCode: http.StatusForbidden},
+		// the keys issued with planets:write before planets:delete existed keep deleting
+		{name: "DeleteWithWriteScope", key: writer, method: http.MethodDelete, url: "/delete", expectedCode: http.StatusOK},
+		{name: "Bootstrap", key: bootstrapKey, method: http.MethodDelete, url: "/delete", expectedCode: http.StatusOK},
+		{name: "ReaderToken", authorization: readerToken, method: http.MethodGet, url: "/read", expectedCode: http.StatusOK},
+		{name: "ReaderTokenWrite", authorization: readerToken, method: http.MethodPost, url: "/write", expectedCode: http.StatusForbidden},
+		{name: "EditorToken", authorization: editorToken, method: http.MethodPost, url: "/write", expectedCode: http.StatusOK},
+		{name: "EditorTokenDelete", authorization: editorToken, method: http.MethodDelete, url: "/delete", expectedCode: http.StatusForbidden},
+		{name: "AdminToken", authorization: adminToken, method: http.MethodDelete, url: "/delete", expectedCode: http.StatusOK},
+		{name: "ForgedToken", authorization: forgedToken, method: http.MethodGet, url: "/read", expectedCode: http.StatusUnauthorized},
+		{name: "ForgedTokenWithKey", key: writer, authorization: forgedToken, method: http.MethodGet, url: "/read", expectedCode: http.StatusUnauthorized},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+			if tc.key != "" {
+				req.Header.Set(authmiddleware.APIKeyHeader, tc.key)
+			}
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+			if tc.expectedCode == http.StatusUnauthorized {
+				require.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestAPIKeysOnly(t *testing.T) {
+	keys := memorystore.NewKeyStore()
+	reader := createKey(t, keys, apikeys.ScopeRead)
+	signer := tokenstest.NewSigner(t)
+	router := newRouter(authmiddleware.WithAPIKeys(keys))
+
+	// bearer tokens are not accepted unless a verifier is configured
+	req, err := http.NewRequest(http.MethodGet, "/read", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+signer.Token(t, tokenstest.Claims("luke", tokens.RoleAdmin)))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Empty(t, recorder.Header().Get("WWW-Authenticate"))
+
+	req.Header.Set(authmiddleware.APIKeyHeader, reader)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestTenant(t *testing.T) {
+	keys := memorystore.NewKeyStore()
+	plaintext, key, err := apikeys.New("rebels", []string{apikeys.ScopeRead}, time.Now())
+	require.NoError(t, err)
+	key.Tenant = "rebels"
+	require.NoError(t, keys.CreateKey(context.Background(), key))
+	unbound := createKey(t, keys, apikeys.ScopeRead)
+
+	signer := tokenstest.NewSigner(t)
+	verifier := tokens.New(tokens.NewKeySet(tokenstest.WriteJWKS(t, signer)), tokenstest.Issuer, tokenstest.Audience)
+	claims := tokenstest.Claims("vader", tokens.RoleReader)
+	claims[tokens.DefaultTenantClaim] = "empire"
+
+	router := gin.New()
+	router.Use(authmiddleware.New(authmiddleware.WithAPIKeys(keys), authmiddleware.WithTokens(verifier)))
+	router.GET("/tenant", func(ctx *gin.Context) {
+		principal, _ := authmiddleware.PrincipalFromContext(ctx)
+		require.Equal(t, principal.Tenant, ctx.GetString(authmiddleware.TenantKey))
+		ctx.String(http.StatusOK, principal.Tenant)
+	})
+
+	testCases := []struct {
+		name           string
+		header         string
+		value          string
+		expectedTenant string
+	}{
+		{name: "APIKey", header: authmiddleware.APIKeyHeader, value: plaintext, expectedTenant: "rebels"},
+		{name: "UnboundAPIKey", header: authmiddleware.APIKeyHeader, value: unbound, expectedTenant: ""},
+		{name: "Token", header: "Authorization", value: "Bearer " + signer.Token(t, claims), expectedTenant: "empire"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/tenant", nil)
+			require.NoError(t, err)
+			req.Header.Set(tc.header, tc.value)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			require.Equal(t, tc.expectedTenant, recorder.Body.String())
+		})
+	}
+}
+
+func newRouter(opts ...authmiddleware.Option) *gin.Engine {
+	router := gin.New()
+	router.Use(authmiddleware.New(opts...))
+	router.GET("/read", authmiddleware.RequireScope(apikeys.ScopeRead), ok)
+	router.POST("/write", authmiddleware.RequireScope(apikeys.ScopeWrite), ok)
+	router.DELETE("/delete", authmiddleware.RequireScope(apikeys.ScopeDelete), ok)
+	return router
+}
+
+func createKey(t *testing.T, keys apikeys.Store, scopes ...string) string {
+	plaintext, key, err := apikeys.New("test", scopes, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, keys.CreateKey(context.Background(), key))
+	return plaintext
+}
+
+func ok(ctx *gin.Context) {
+	ctx.Status(http.StatusOK)
+}
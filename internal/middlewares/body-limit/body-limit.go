@@ -0,0 +1,62 @@
+package bodylimitmiddleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"io"
+	"net/http"
+)
+
+// ErrTooLarge is the error of reading a request body past its limit. The handlers answer it
+// with 413.
+var ErrTooLarge = errors.New(errorsmodel.RequestBodyTooLarge)
+
+// limitedBody reads a request body bounded by http.MaxBytesReader, failing with ErrTooLarge
+// past its limit
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+// Route names a route by its method and path, as in "POST /v1/planets/import"
+func Route(method, path string) string {
+	return method + " " + path
+}
+
+// New creates a middleware that bounds the request bodies of the routes in limits, keyed by
+// Route, to their number of bytes. It must run before the middlewares reading the bodies. The
+// bodies declaring a larger Content-Length are refused with 413 before they are read.
+func New(limits map[string]int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, ok := limits[Route(ctx.Request.Method, ctx.FullPath())]
+		if !ok || limit <= 0 || ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+			ctx.Next()
+			return
+		}
+
+		if ctx.Request.ContentLength > limit {
+			Abort(ctx)
+			return
+		}
+		ctx.Request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit), limit: limit}
+		ctx.Next()
+	}
+}
+
+// Abort answers the request with 413
+func Abort(ctx *gin.Context) {
+	negotiate.Abort(ctx, http.StatusRequestEntityTooLarge, parseerrors.RequestErrorResponse(ctx.Request.Context(), ErrTooLarge))
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		err = ErrTooLarge
+	}
+	return n, err
+}
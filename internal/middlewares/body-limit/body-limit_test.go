@@ -0,0 +1,96 @@
+package bodylimitmiddleware_test
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	bodylimitmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/body-limit"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestBodyLimit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		target        string
+		body          string
+		chunked       bool
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			target: "/limited",
+			body:   strings.Repeat("a", 8),
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "8", recorder.Body.String())
+			},
+		},
+		{
+			name:   "ContentLengthTooLarge",
+			target: "/limited",
+			body:   strings.Repeat("a", 9),
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "request body too large")
+			},
+		},
+		{
+			name:    "ChunkedTooLarge",
+			target:  "/limited",
+			body:    strings.Repeat("a", 9),
+			chunked: true,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+			},
+		},
+		{
+			name:   "OtherRoute",
+			target: "/other",
+			body:   strings.Repeat("a", 9),
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "9", recorder.Body.String())
+			},
+		},
+	}
+
+	router := gin.New()
+	router.Use(bodylimitmiddleware.New(map[string]int64{
+		bodylimitmiddleware.Route(http.MethodPost, "/limited"): 8,
+	}))
+	read := func(ctx *gin.Context) {
+		data, err := ioutil.ReadAll(ctx.Request.Body)
+		if errors.Is(err, bodylimitmiddleware.ErrTooLarge) {
+			bodylimitmiddleware.Abort(ctx)
+			return
+		}
+		require.NoError(t, err)
+		ctx.String(http.StatusOK, "%d", len(data))
+	}
+	router.POST("/limited", read)
+	router.POST("/other", read)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			if tc.chunked {
+				// a chunked body has no Content-Length
+				req.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
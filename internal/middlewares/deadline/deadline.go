@@ -0,0 +1,38 @@
+package deadlinemiddleware
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net"
+	"time"
+)
+
+// connKey is the context key of the connection of a request
+type connKey struct{}
+
+// ConnContext stores the connection of each request in its context, for Extend. It is meant for
+// the ConnContext of an http.Server.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// Extend creates a middleware that replaces the read and write timeouts of the server for the
+// routes streaming their request or response, moving the deadlines of the connection to timeout
+// from now or clearing them when timeout is zero. It does nothing for the requests whose
+// connection was not stored by ConnContext. The deadlines are those of the whole connection, so
+// it is only meant for HTTP/1 servers, and the connection is closed after the response so that
+// they never apply to another request.
+func Extend(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		conn, ok := ctx.Request.Context().Value(connKey{}).(net.Conn)
+		if ok {
+			var deadline time.Time
+			if timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			_ = conn.SetDeadline(deadline)
+			ctx.Header("Connection", "close")
+		}
+		ctx.Next()
+	}
+}
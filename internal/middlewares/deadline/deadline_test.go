@@ -0,0 +1,50 @@
+package deadlinemiddleware_test
+
+import (
+	"github.com/gin-gonic/gin"
+	deadlinemiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/deadline"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestExtend(t *testing.T) {
+	slow := func(ctx *gin.Context) {
+		time.Sleep(200 * time.Millisecond)
+		ctx.String(http.StatusOK, "done")
+	}
+	router := gin.New()
+	router.GET("/extended", deadlinemiddleware.Extend(time.Second), slow)
+	router.GET("/cleared", deadlinemiddleware.Extend(0), slow)
+	router.GET("/plain", slow)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Config.ConnContext = deadlinemiddleware.ConnContext
+	server.Start()
+	defer server.Close()
+
+	for _, path := range []string{"/extended", "/cleared"} {
+		res, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "done", string(body))
+		require.True(t, res.Close)
+	}
+
+	// the server write timeout cuts the response of the other routes
+	_, err := http.Get(server.URL + "/plain")
+	require.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package loggermiddleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/logging"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	requestid "github.com/gmaschi/b2w-sw-planets/pkg/tools/request-id"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	redacted = "[REDACTED]"
+)
+
+// DefaultRedactedHeaders are the headers whose values never reach the logs
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+type (
+	accessLog struct {
+		logger          *zap.Logger
+		redactedHeaders map[string]bool
+	}
+
+	// Option configures the access log
+	Option func(*accessLog)
+)
+
+// WithRedactedHeaders hides the values of more headers in the access log
+func WithRedactedHeaders(headers ...string) Option {
+	return func(al *accessLog) {
+		for _, header := range headers {
+			al.redactedHeaders[http.CanonicalHeaderKey(header)] = true
+		}
+	}
+}
+
+// RequestID creates a middleware that names every request by its X-Request-ID header, generating
+// an ID when the header is missing or invalid, and echoes the ID in the response
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(RequestIDHeader)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		ctx.Header(RequestIDHeader, id)
+		ctx.Request = ctx.Request.WithContext(requestid.NewContext(ctx.Request.Context(), id))
+		ctx.Next()
+	}
+}
+
+// New creates a middleware that logs every request once it is served. Server errors are logged
+// at error level, client errors at warn level and the rest at info level; the request headers
+// are only logged at debug level.
+func New(logger *zap.Logger, opts ...Option) gin.HandlerFunc {
+	al := &accessLog{
+		logger:          logger,
+		redactedHeaders: make(map[string]bool),
+	}
+	WithRedactedHeaders(DefaultRedactedHeaders...)(al)
+	for _, opt := range opts {
+		opt(al)
+	}
+
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		level := zapcore.InfoLevel
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = zapcore.ErrorLevel
+		case status >= http.StatusBadRequest:
+			level = zapcore.WarnLevel
+		}
+
+		logger := logging.ForRequest(ctx.Request.Context(), al.logger)
+		entry := logger.Check(level, "request served")
+		if entry == nil {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.String("method", ctx.Request.Method),
+			zap.String("route", ctx.FullPath()),
+			zap.String("path", ctx.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", ctx.ClientIP()),
+			zap.Int("bytes", ctx.Writer.Size()),
+		}
+		if len(ctx.Errors) > 0 {
+			fields = append(fields, zap.Strings("errors", ctx.Errors.Errors()))
+		}
+		if logger.Core().Enabled(zapcore.DebugLevel) {
+			fields = append(fields, zap.Any("headers", al.headers(ctx.Request.Header)))
+		}
+		entry.Write(fields...)
+	}
+}
+
+// Recovery creates a middleware that logs panics with their stack and answers 500
+func Recovery(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				logging.ForRequest(ctx.Request.Context(), logger).Error("panic serving request",
+					zap.Any("panic", recovered),
+					zap.Stack("stack"),
+				)
+				err := errors.New(http.StatusText(http.StatusInternalServerError))
+				negotiate.Abort(ctx, http.StatusInternalServerError, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+// headers flattens the request headers, hiding the values of the redacted ones
+func (al *accessLog) headers(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if al.redactedHeaders[http.CanonicalHeaderKey(name)] {
+			headers[name] = redacted
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
@@ -0,0 +1,132 @@
+package loggermiddleware_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	loggermiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/logger"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestRequestID(t *testing.T) {
+	testCases := []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{
+			name:      "Echoed",
+			requestID: "3f2c-41aa.b9",
+		},
+		{
+			name:      "Missing",
+			generated: true,
+		},
+		{
+			name:      "Invalid",
+			requestID: "bad id\n",
+			generated: true,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			router, logs := newRouter(zapcore.InfoLevel)
+
+			req, err := http.NewRequest(http.MethodGet, "/v1/planets/abc", nil)
+			require.NoError(t, err)
+			if tc.requestID != "" {
+				req.Header.Set(loggermiddleware.RequestIDHeader, tc.requestID)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			id := recorder.Header().Get(loggermiddleware.RequestIDHeader)
+			if tc.generated {
+				require.Len(t, id, 32)
+			} else {
+				require.Equal(t, tc.requestID, id)
+			}
+
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			require.Equal(t, id, body["request_id"])
+
+			entries := logs.All()
+			require.Len(t, entries, 1)
+			require.Equal(t, zapcore.WarnLevel, entries[0].Level)
+			fields := entries[0].ContextMap()
+			require.Equal(t, id, fields["request_id"])
+			require.Equal(t, "/v1/planets/:id", fields["route"])
+			require.Equal(t, int64(http.StatusNotFound), fields["status"])
+			require.NotContains(t, fields, "headers")
+		})
+	}
+}
+
+func TestRedactedHeaders(t *testing.T) {
+	router, logs := newRouter(zapcore.DebugLevel)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/planets/abc", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "secret")
+	req.Header.Set("X-Session", "secret")
+	req.Header.Set("Accept", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	headers := entries[0].ContextMap()["headers"].(map[string]string)
+	require.Equal(t, "[REDACTED]", headers["Authorization"])
+	require.Equal(t, "[REDACTED]", headers["X-Api-Key"])
+	require.Equal(t, "[REDACTED]", headers["X-Session"])
+	require.Equal(t, "application/json", headers["Accept"])
+}
+
+func TestRecovery(t *testing.T) {
+	router, logs := newRouter(zapcore.InfoLevel)
+
+	req, err := http.NewRequest(http.MethodGet, "/panic", nil)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, 1, logs.FilterMessage("panic serving request").Len())
+	require.Equal(t, 1, logs.FilterMessage("request served").FilterField(zap.Int("status", http.StatusInternalServerError)).Len())
+}
+
+func newRouter(level zapcore.Level) (*gin.Engine, *observer.ObservedLogs) {
+	core, logs := observer.New(level)
+	logger := zap.New(core)
+
+	router := gin.New()
+	router.Use(
+		loggermiddleware.RequestID(),
+		loggermiddleware.New(logger, loggermiddleware.WithRedactedHeaders("x-session")),
+		loggermiddleware.Recovery(logger),
+	)
+	router.GET("/v1/planets/:id", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusNotFound, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New("planet does not exist")))
+	})
+	router.GET("/panic", func(ctx *gin.Context) {
+		panic("boom")
+	})
+	return router, logs
+}
@@ -0,0 +1,46 @@
+package metricsmiddleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"time"
+)
+
+// unmatchedRoute labels the requests that match no route, keeping the label cardinality bounded
+const unmatchedRoute = "unmatched"
+
+// New creates a middleware that counts the requests and observes their latency by method,
+// route template (e.g. /v1/planets/:id) and status code
+func New(registerer prometheus.Registerer) gin.HandlerFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of the HTTP requests by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served.",
+	})
+	registerer.MustRegister(requests, duration, inFlight)
+
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		code := strconv.Itoa(ctx.Writer.Status())
+		requests.WithLabelValues(ctx.Request.Method, route, code).Inc()
+		duration.WithLabelValues(ctx.Request.Method, route, code).Observe(time.Since(start).Seconds())
+	}
+}
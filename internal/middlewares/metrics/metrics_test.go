@@ -0,0 +1,43 @@
+package metricsmiddleware_test
+
+import (
+	"github.com/gin-gonic/gin"
+	metricsmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// TestRouteLabel tests that requests are labeled by route template instead of raw path
+func TestRouteLabel(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	router := gin.New()
+	router.Use(metricsmiddleware.New(registry))
+	router.GET("/v1/planets/:id", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNotFound)
+	})
+
+	for _, url := range []string{"/v1/planets/1", "/v1/planets/2", "/unknown"} {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	expected := `
+# HELP http_requests_total HTTP requests by method, route and status code.
+# TYPE http_requests_total counter
+http_requests_total{code="404",method="GET",route="/v1/planets/:id"} 2
+http_requests_total{code="404",method="GET",route="unmatched"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_requests_total"))
+}
@@ -0,0 +1,105 @@
+package ratelimitmiddleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	authmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/auth"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Rate limit headers, see draft-ietf-httpapi-ratelimit-headers
+const (
+	LimitHeader     = "RateLimit-Limit"
+	RemainingHeader = "RateLimit-Remaining"
+	ResetHeader     = "RateLimit-Reset"
+)
+
+// chargeKey holds the function taking more tokens from the bucket of a request
+const chargeKey = "ratelimit.charge"
+
+// New creates a middleware that limits the requests of each client with a token bucket, one
+// for its reads and one for its writes. Clients are told apart by their authenticated principal
+// or else by their IP, so it must run after the authentication. When the store fails the
+// request is let through.
+func New(store ratelimit.Store, read, write ratelimit.Limit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, kind := write, "write"
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			limit, kind = read, "read"
+		}
+
+		key := clientKey(ctx) + ":" + kind
+		if !take(ctx, store, key, limit, 1) {
+			abort(ctx)
+			return
+		}
+		ctx.Set(chargeKey, func(n int) bool {
+			return take(ctx, store, key, limit, n)
+		})
+		ctx.Next()
+	}
+}
+
+// ByIP creates a middleware that limits every request of each client IP with a token bucket. It
+// runs before the authentication, so the requests failing it are limited too.
+func ByIP(store ratelimit.Store, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !take(ctx, store, "ip:"+ctx.ClientIP()+":any", limit, 1) {
+			abort(ctx)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Charge takes n more tokens from the bucket of a request costing more than one, such as a
+// batch of planets, and reports whether they were allowed. The requests that are not rate
+// limited are always allowed.
+func Charge(ctx *gin.Context, n int) bool {
+	charge, ok := ctx.Value(chargeKey).(func(int) bool)
+	if !ok || n <= 0 {
+		return true
+	}
+	return charge(n)
+}
+
+// take takes n tokens from the bucket of key and sets the rate limit headers of the response
+func take(ctx *gin.Context, store ratelimit.Store, key string, limit ratelimit.Limit, n int) bool {
+	res, err := store.Take(ctx.Request.Context(), key, limit, n, time.Now())
+	if err != nil {
+		_ = ctx.Error(err)
+		return true
+	}
+
+	ctx.Header(LimitHeader, strconv.Itoa(limit.Requests))
+	ctx.Header(RemainingHeader, strconv.Itoa(res.Remaining))
+	ctx.Header(ResetHeader, strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		ctx.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	}
+	return res.Allowed
+}
+
+func abort(ctx *gin.Context) {
+	negotiate.Abort(ctx, http.StatusTooManyRequests, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.RateLimitExceeded)))
+}
+
+// clientKey identifies the client of a request
+func clientKey(ctx *gin.Context) string {
+	if principal, ok := authmiddleware.PrincipalFromContext(ctx); ok {
+		return "principal:" + principal.Subject
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,127 @@
+package ratelimitmiddleware_test
+
+import (
+	"github.com/gin-gonic/gin"
+	ratelimitmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/rate-limit"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestRateLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(ratelimitmiddleware.New(ratelimit.NewMemoryStore(),
+		ratelimit.Limit{Requests: 3, Period: time.Minute},
+		ratelimit.Limit{Requests: 1, Period: time.Minute},
+	))
+	router.GET("/planets", ok)
+	router.POST("/planets", ok)
+
+	serve := func(method, remoteAddr string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/planets", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(http.MethodPost, "10.0.0.1:1234")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "1", recorder.Header().Get(ratelimitmiddleware.LimitHeader))
+	require.Equal(t, "0", recorder.Header().Get(ratelimitmiddleware.RemainingHeader))
+	require.Equal(t, "60", recorder.Header().Get(ratelimitmiddleware.ResetHeader))
+
+	recorder = serve(http.MethodPost, "10.0.0.1:4321")
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+	require.Contains(t, recorder.Body.String(), "rate limit exceeded")
+
+	// reads are limited apart from writes, and each client apart from the others
+	for remaining := 2; remaining >= 0; remaining-- {
+		recorder = serve(http.MethodGet, "10.0.0.1:1234")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		require.Equal(t, "3", recorder.Header().Get(ratelimitmiddleware.LimitHeader))
+		require.Equal(t, string(rune('0'+remaining)), recorder.Header().Get(ratelimitmiddleware.RemainingHeader))
+	}
+	recorder = serve(http.MethodGet, "10.0.0.1:1234")
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "20", recorder.Header().Get("Retry-After"))
+
+	recorder = serve(http.MethodPost, "10.0.0.2:1234")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestByIP(t *testing.T) {
+	router := gin.New()
+	router.Use(ratelimitmiddleware.ByIP(ratelimit.NewMemoryStore(), ratelimit.Limit{Requests: 2, Period: time.Minute}))
+	// the requests are refused after the IP limit, as the authentication would
+	router.GET("/planets", func(ctx *gin.Context) {
+		ctx.Status(http.StatusUnauthorized)
+	})
+
+	serve := func(remoteAddr string) int {
+		req, err := http.NewRequest(http.MethodGet, "/planets", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, serve("10.0.0.1:1234"))
+	require.Equal(t, http.StatusUnauthorized, serve("10.0.0.1:1234"))
+	require.Equal(t, http.StatusTooManyRequests, serve("10.0.0.1:1234"))
+	require.Equal(t, http.StatusUnauthorized, serve("10.0.0.2:1234"))
+}
+
+func TestCharge(t *testing.T) {
+	router := gin.New()
+	router.Use(ratelimitmiddleware.New(ratelimit.NewMemoryStore(),
+		ratelimit.Limit{Requests: 3, Period: time.Minute},
+		ratelimit.Limit{Requests: 3, Period: time.Minute},
+	))
+	// each planet of a batch costs a token
+	router.POST("/planets", func(ctx *gin.Context) {
+		if !ratelimitmiddleware.Charge(ctx, 4) {
+			ctx.Status(http.StatusTooManyRequests)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+
+	serve := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/planets", nil)
+		require.NoError(t, err)
+		req.RemoteAddr = "10.0.0.1:1234"
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// the batch of 5 planets overdraws the bucket of 3 tokens by 2
+	recorder := serve()
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "0", recorder.Header().Get(ratelimitmiddleware.RemainingHeader))
+
+	recorder = serve()
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+
+	// without a rate limit every charge is allowed
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	require.True(t, ratelimitmiddleware.Charge(ctx, 100))
+}
+
+func ok(ctx *gin.Context) {
+	ctx.Status(http.StatusOK)
+}
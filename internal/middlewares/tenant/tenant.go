@@ -0,0 +1,82 @@
+package tenantmiddleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	"github.com/gmaschi/b2w-sw-planets/internal/tenancy"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"net/http"
+	"strings"
+)
+
+const DefaultHeader = "X-Tenant-ID"
+
+// Resolver extracts the tenant ID of a request, returning "" when the request does not name one
+type Resolver func(ctx *gin.Context) string
+
+// FromHeader resolves the tenant ID from a request header
+func FromHeader(header string) Resolver {
+	return func(ctx *gin.Context) string {
+		return strings.TrimSpace(ctx.GetHeader(header))
+	}
+}
+
+// FromContextKey resolves the tenant ID from a value stored in the gin context by an earlier
+// middleware, such as a claim of an authenticated token
+func FromContextKey(key string) Resolver {
+	return func(ctx *gin.Context) string {
+		return ctx.GetString(key)
+	}
+}
+
+// New creates a middleware that routes each request to its tenant. The first resolver that
+// finds a tenant ID wins, and requests without a valid tenant ID are rejected. The client picks
+// its tenant, so it is only meant for deployments without authentication.
+func New(resolvers ...Resolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var tenantID string
+		for _, resolve := range resolvers {
+			if tenantID = resolve(ctx); tenantID != "" {
+				break
+			}
+		}
+
+		if tenantID == "" {
+			negotiate.Abort(ctx, http.StatusBadRequest, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.MissingTenantID)))
+			return
+		}
+		route(ctx, tenantID)
+	}
+}
+
+// Bound creates a middleware that routes each request to the tenant its credentials are bound
+// to, resolved by bound after the authentication. Requests whose credentials are bound to no
+// tenant, or whose header names another tenant, are rejected with 403.
+func Bound(bound Resolver, header string) gin.HandlerFunc {
+	fromHeader := FromHeader(header)
+	return func(ctx *gin.Context) {
+		tenantID := bound(ctx)
+		if tenantID == "" {
+			negotiate.Abort(ctx, http.StatusForbidden, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.UnboundCredentials)))
+			return
+		}
+		if named := fromHeader(ctx); named != "" && named != tenantID {
+			negotiate.Abort(ctx, http.StatusForbidden, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.TenantMismatch)))
+			return
+		}
+		route(ctx, tenantID)
+	}
+}
+
+// route carries tenantID in the context of the request, rejecting the invalid IDs
+func route(ctx *gin.Context, tenantID string) {
+	if !tenancy.ValidID(tenantID) {
+		negotiate.Abort(ctx, http.StatusBadRequest, parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.InvalidTenantID)))
+		return
+	}
+
+	ctx.Request = ctx.Request.WithContext(tenancy.NewContext(ctx.Request.Context(), tenantID))
+	ctx.Next()
+}
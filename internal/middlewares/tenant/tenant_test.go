@@ -0,0 +1,155 @@
+package tenantmiddleware_test
+
+import (
+	"github.com/gin-gonic/gin"
+	tenantmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/tenant"
+	"github.com/gmaschi/b2w-sw-planets/internal/tenancy"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	testCases := []struct {
+		name           string
+		header         string
+		claim          string
+		expectedCode   int
+		expectedTenant string
+	}{
+		{
+			name:           "Header",
+			header:         "rebels",
+			expectedCode:   http.StatusOK,
+			expectedTenant: "rebels",
+		},
+		{
+			name:           "HeaderWinsOverClaim",
+			header:         "rebels",
+			claim:          "empire",
+			expectedCode:   http.StatusOK,
+			expectedTenant: "rebels",
+		},
+		{
+			name:           "Claim",
+			claim:          "empire",
+			expectedCode:   http.StatusOK,
+			expectedTenant: "empire",
+		},
+		{
+			name:         "Missing",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Invalid",
+			header:       "../admin",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(ctx *gin.Context) {
+				if tc.claim != "" {
+					ctx.Set("tenant", tc.claim)
+				}
+			})
+			router.Use(tenantmiddleware.New(
+				tenantmiddleware.FromHeader(tenantmiddleware.DefaultHeader),
+				tenantmiddleware.FromContextKey("tenant"),
+			))
+
+			var gotTenant string
+			router.GET("/", func(ctx *gin.Context) {
+				gotTenant, _ = tenancy.FromContext(ctx.Request.Context())
+			})
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			require.NoError(t, err)
+			if tc.header != "" {
+				req.Header.Set(tenantmiddleware.DefaultHeader, tc.header)
+			}
+
+			router.ServeHTTP(recorder, req)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+			require.Equal(t, tc.expectedTenant, gotTenant)
+		})
+	}
+}
+
+func TestBound(t *testing.T) {
+	testCases := []struct {
+		name           string
+		header         string
+		bound          string
+		expectedCode   int
+		expectedTenant string
+	}{
+		{
+			name:           "Credentials",
+			bound:          "rebels",
+			expectedCode:   http.StatusOK,
+			expectedTenant: "rebels",
+		},
+		{
+			name:           "MatchingHeader",
+			header:         "rebels",
+			bound:          "rebels",
+			expectedCode:   http.StatusOK,
+			expectedTenant: "rebels",
+		},
+		{
+			name:         "OtherTenantHeader",
+			header:       "empire",
+			bound:        "rebels",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Unbound",
+			header:       "rebels",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "Invalid",
+			bound:        "../admin",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(ctx *gin.Context) {
+				if tc.bound != "" {
+					ctx.Set("tenant", tc.bound)
+				}
+			})
+			router.Use(tenantmiddleware.Bound(tenantmiddleware.FromContextKey("tenant"), tenantmiddleware.DefaultHeader))
+
+			var gotTenant string
+			router.GET("/", func(ctx *gin.Context) {
+				gotTenant, _ = tenancy.FromContext(ctx.Request.Context())
+			})
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			require.NoError(t, err)
+			if tc.header != "" {
+				req.Header.Set(tenantmiddleware.DefaultHeader, tc.header)
+			}
+
+			router.ServeHTTP(recorder, req)
+			require.Equal(t, tc.expectedCode, recorder.Code)
+			require.Equal(t, tc.expectedTenant, gotTenant)
+		})
+	}
+}
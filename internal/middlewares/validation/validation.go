@@ -0,0 +1,242 @@
+package validationmiddleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	bodylimitmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/body-limit"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// StreamedBody is the extension marking the operations whose request body is streamed by the
+// handler. Their bodies are not validated, which would read them whole into memory.
+const StreamedBody = "x-streamed-body"
+
+// truncatedKey is the context key of the responses cut short by their handler
+const truncatedKey = "validation.truncated"
+
+type (
+	// FieldError is a value of a request that does not match the OpenAPI document
+	FieldError struct {
+		// In is where the value is: path, query, header or body
+		In string `json:"in"`
+		// Field is the name of the parameter or the path, dot separated, of the value in the body
+		Field string `json:"field,omitempty"`
+		Error string `json:"error"`
+	}
+
+	// Option configures the middleware
+	Option func(v *validator)
+
+	validator struct {
+		router    routers.Router
+		responses bool
+	}
+
+	// responseBuffer holds the response until it is validated
+	responseBuffer struct {
+		gin.ResponseWriter
+		status  int
+		written bool
+		body    bytes.Buffer
+	}
+)
+
+// WithResponses also validates the JSON responses, answering 500 in place of a response that does
+// not match the document or has a status it does not list. The responses are buffered, streams
+// included, so it is meant for tests.
+func WithResponses() Option {
+	return func(v *validator) {
+		v.responses = true
+	}
+}
+
+// New creates a middleware that validates the requests against the OpenAPI document spec,
+// answering 400 with an error per invalid value. Requests for routes the document does not have
+// are let through. The bodies of a media type the operation does not list, none included, are
+// validated as JSON, as the handlers bind them.
+func New(spec []byte, opts ...Option) (gin.HandlerFunc, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("load OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validator{router: router}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v.handle, nil
+}
+
+// Truncated marks the response of ctx as cut short, a stream interrupted after its status was
+// sent. Only its status and headers are validated.
+func Truncated(ctx *gin.Context) {
+	ctx.Set(truncatedKey, true)
+}
+
+func (v *validator) handle(ctx *gin.Context) {
+	route, pathParams, err := v.router.FindRoute(ctx.Request)
+	if err != nil {
+		ctx.Next()
+		return
+	}
+
+	streamed := route.Operation.Extensions[StreamedBody] != nil
+	if body := route.Operation.RequestBody; !streamed && body != nil && body.Value != nil &&
+		ctx.Request.Body != nil && ctx.Request.Body != http.NoBody &&
+		body.Value.GetMediaType(ctx.GetHeader("Content-Type")) == nil {
+		ctx.Request.Header.Set("Content-Type", binding.MIMEJSON)
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    ctx.Request,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			ExcludeRequestBody: streamed,
+			MultiError:         true,
+			// the authentication middleware checks the credentials
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	if err := openapi3filter.ValidateRequest(ctx.Request.Context(), input); err != nil {
+		if errors.Is(err, bodylimitmiddleware.ErrTooLarge) {
+			bodylimitmiddleware.Abort(ctx)
+			return
+		}
+		res := parseerrors.RequestErrorResponse(ctx.Request.Context(), errors.New(errorsmodel.InvalidRequest))
+		res["fields"] = fieldErrors("", "", err)
+		negotiate.Abort(ctx, http.StatusBadRequest, res)
+		return
+	}
+
+	if !v.responses {
+		ctx.Next()
+		return
+	}
+	buffer := &responseBuffer{ResponseWriter: ctx.Writer, status: http.StatusOK}
+	ctx.Writer = buffer
+	ctx.Next()
+	ctx.Writer = buffer.ResponseWriter
+	v.validateResponse(ctx, input, buffer)
+}
+
+// validateResponse sends the response held by buffer when it matches the document and a 500
+// otherwise
+func (v *validator) validateResponse(ctx *gin.Context, input *openapi3filter.RequestValidationInput, buffer *responseBuffer) {
+	header := ctx.Writer.Header()
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	err := openapi3filter.ValidateResponse(ctx.Request.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 buffer.status,
+		Header:                 header,
+		Body:                   io.NopCloser(bytes.NewReader(buffer.body.Bytes())),
+		Options: &openapi3filter.Options{
+			// the document only has the schemas of the JSON responses
+			ExcludeResponseBody:   mediaType != binding.MIMEJSON || ctx.GetBool(truncatedKey),
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	})
+	if err != nil {
+		_ = ctx.Error(err)
+		header.Del("Content-Type")
+		header.Del("Content-Disposition")
+		err = fmt.Errorf("%s: %d %s: %s", errorsmodel.InvalidResponse, buffer.status, ctx.FullPath(), err)
+		negotiate.Render(ctx, http.StatusInternalServerError, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+		return
+	}
+
+	ctx.Writer.WriteHeader(buffer.status)
+	if buffer.written {
+		ctx.Writer.WriteHeaderNow()
+	}
+	if buffer.body.Len() > 0 {
+		_, _ = ctx.Writer.Write(buffer.body.Bytes())
+	}
+}
+
+// fieldErrors flattens err, the error of the value in at field, into an error per invalid value
+func fieldErrors(in, field string, err error) []FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var errs []FieldError
+		for _, err := range e {
+			errs = append(errs, fieldErrors(in, field, err)...)
+		}
+		return errs
+	case *openapi3filter.RequestError:
+		in, field = "body", ""
+		if e.Parameter != nil {
+			in, field = e.Parameter.In, e.Parameter.Name
+		}
+		if e.Err == nil {
+			return []FieldError{{In: in, Field: field, Error: e.Reason}}
+		}
+		return fieldErrors(in, field, e.Err)
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			field = strings.Join(pointer, ".")
+		}
+		return []FieldError{{In: in, Field: field, Error: e.Reason}}
+	default:
+		return []FieldError{{In: in, Field: field, Error: err.Error()}}
+	}
+}
+
+func (b *responseBuffer) WriteHeader(code int) {
+	if code > 0 && !b.written {
+		b.status = code
+	}
+}
+
+func (b *responseBuffer) WriteHeaderNow() {
+	b.written = true
+}
+
+func (b *responseBuffer) Write(data []byte) (int, error) {
+	b.written = true
+	return b.body.Write(data)
+}
+
+func (b *responseBuffer) WriteString(s string) (int, error) {
+	b.written = true
+	return b.body.WriteString(s)
+}
+
+func (b *responseBuffer) Status() int {
+	return b.status
+}
+
+func (b *responseBuffer) Size() int {
+	if !b.written {
+		return -1
+	}
+	return b.body.Len()
+}
+
+func (b *responseBuffer) Written() bool {
+	return b.written
+}
+
+// Flush keeps the response buffered until it is validated
+func (b *responseBuffer) Flush() {}
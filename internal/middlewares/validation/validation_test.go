@@ -0,0 +1,235 @@
+package validationmiddleware_test
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	validationmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/validation"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const spec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "things", "version": "1.0.0"},
+  "paths": {
+    "/things": {
+      "get": {
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1}}
+        ],
+        "responses": {
+          "200": {
+            "description": "things",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Thing"}}}}
+          }
+        }
+      },
+      "post": {
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Thing"}}}
+        },
+        "responses": {
+          "201": {
+            "description": "created",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Thing"}}}
+          },
+          "400": {"description": "invalid"}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Thing": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {"name": {"type": "string", "minLength": 1}}
+      }
+    }
+  }
+}`
+
+type errorResponse struct {
+	Error  string                            `json:"error"`
+	Fields []validationmiddleware.FieldError `json:"fields"`
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestRequests(t *testing.T) {
+	testCases := []struct {
+		name          string
+		method        string
+		target        string
+		body          string
+		contentType   string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			method: http.MethodGet,
+			target: "/things?limit=2",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "InvalidQuery",
+			method: http.MethodGet,
+			target: "/things?limit=0",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				res := decodeError(t, recorder)
+				require.Len(t, res.Fields, 1)
+				require.Equal(t, "query", res.Fields[0].In)
+				require.Equal(t, "limit", res.Fields[0].Field)
+				require.NotEmpty(t, res.Fields[0].Error)
+			},
+		},
+		{
+			name:        "InvalidBody",
+			method:      http.MethodPost,
+			target:      "/things",
+			body:        `{"name": ""}`,
+			contentType: "application/json",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				res := decodeError(t, recorder)
+				require.Len(t, res.Fields, 1)
+				require.Equal(t, "body", res.Fields[0].In)
+				require.Equal(t, "name", res.Fields[0].Field)
+			},
+		},
+		{
+			name:   "BodyWithoutContentType",
+			method: http.MethodPost,
+			target: "/things",
+			body:   `{}`,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				res := decodeError(t, recorder)
+				require.Len(t, res.Fields, 1)
+				require.Equal(t, "body", res.Fields[0].In)
+			},
+		},
+		{
+			name:        "FormBody",
+			method:      http.MethodPost,
+			target:      "/things",
+			body:        `{"name": "Yavin IV"}`,
+			contentType: "application/x-www-form-urlencoded",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "UnknownRoute",
+			method: http.MethodGet,
+			target: "/other?limit=0",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+	}
+
+	validate, err := validationmiddleware.New([]byte(spec))
+	require.NoError(t, err)
+	router := gin.New()
+	router.Use(validate)
+	router.GET("/things", ok)
+	router.POST("/things", ok)
+	router.GET("/other", ok)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestResponses(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler gin.HandlerFunc
+		status  int
+	}{
+		{
+			name: "OK",
+			handler: func(ctx *gin.Context) {
+				ctx.JSON(http.StatusOK, []gin.H{{"name": "Yavin IV"}})
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "InvalidBody",
+			handler: func(ctx *gin.Context) {
+				ctx.JSON(http.StatusOK, []gin.H{{"name": 4}})
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name: "UndocumentedStatus",
+			handler: func(ctx *gin.Context) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name: "Truncated",
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Content-Type", "application/json")
+				ctx.Status(http.StatusOK)
+				_, _ = ctx.Writer.WriteString(`[{"name":`)
+				validationmiddleware.Truncated(ctx)
+			},
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			validate, err := validationmiddleware.New([]byte(spec), validationmiddleware.WithResponses())
+			require.NoError(t, err)
+			router := gin.New()
+			router.Use(validate)
+			router.GET("/things", tc.handler)
+
+			req, err := http.NewRequest(http.MethodGet, "/things", nil)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			require.Equal(t, tc.status, recorder.Code)
+		})
+	}
+}
+
+func TestInvalidDocument(t *testing.T) {
+	_, err := validationmiddleware.New([]byte(`{"openapi": "3.0.3"}`))
+	require.Error(t, err)
+}
+
+func decodeError(t *testing.T, recorder *httptest.ResponseRecorder) errorResponse {
+	var res errorResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	require.NotEmpty(t, res.Error)
+	return res
+}
+
+func ok(ctx *gin.Context) {
+	ctx.Status(http.StatusOK)
+}
@@ -0,0 +1,14 @@
+package apikeymodel
+
+type (
+	CreateRequest struct {
+		Name   string   `json:"name" binding:"required,max=64"`
+		Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=planets:read planets:write planets:delete keys:admin"`
+		// Tenant binds the key to a tenant, required to reach the planets when tenancy is enabled
+		Tenant string `json:"tenant"`
+	}
+
+	RevokeRequest struct {
+		ID string `uri:"id" binding:"required,alphanum"`
+	}
+)
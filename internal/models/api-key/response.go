@@ -0,0 +1,23 @@
+package apikeymodel
+
+import (
+	"time"
+)
+
+type (
+	KeyResponse struct {
+		ID        string     `json:"id"`
+		Name      string     `json:"name"`
+		Prefix    string     `json:"prefix"`
+		Scopes    []string   `json:"scopes"`
+		Tenant    string     `json:"tenant,omitempty"`
+		CreatedAt time.Time  `json:"created_at"`
+		RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	}
+
+	// CreateResponse carries the key in clear, which is only ever shown once
+	CreateResponse struct {
+		KeyResponse
+		Key string `json:"key"`
+	}
+)
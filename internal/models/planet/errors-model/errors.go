@@ -7,10 +7,48 @@ const (
 	InvalidPlanetName = "invalid planet name"
 	InvalidID         = "invalid ID"
 
+	MissingTenantID    = "missing tenant ID"
+	InvalidTenantID    = "invalid tenant ID"
+	UnboundCredentials = "the credentials are not bound to a tenant"
+	TenantMismatch     = "the tenant does not match the credentials"
+	TenantNotReady     = "the tenant database could not be prepared"
+
+	MissingCredentials = "missing API key or bearer token"
+	InvalidAPIKey      = "invalid API key"
+	InvalidToken       = "invalid bearer token"
+	InsufficientScope  = "insufficient scope"
+	APIKeyDoesNotExist = "API key does not exist"
+	InvalidScope       = "invalid scope"
+
+	RateLimitExceeded = "rate limit exceeded"
+
+	InvalidIdempotencyKey    = "invalid idempotency key"
+	IdempotencyKeyReused     = "idempotency key reused with a different payload"
+	IdempotencyKeyInProgress = "a request with this idempotency key is in progress"
+	IdempotencyKeyExpired    = "the reservation of the idempotency key expired"
+
 	PlanetAlreadyExists = "planet already exists"
 	PlanetDoesNotExist  = "planet does not exist"
 
+	InvalidBatchSize = "invalid batch size"
+	BatchAborted     = "not created, another planet of the batch failed"
+
+	MissingColumn = "missing column"
+	InvalidMovies = "invalid movies"
+	MissingMovies = "movies is required when the SWAPI lookup is skipped"
+
 	CouldNotDeleteItem = "could not delete item"
+	MissingFilter      = "at least one of name, climate or terrain is required"
+	DeleteNotConfirmed = "deleting planets requires confirm=true"
+
+	NotAcceptable = "none of the accepted media types is offered"
+
+	UnknownField = "unknown field"
+
+	RequestBodyTooLarge = "request body too large"
+
+	InvalidRequest  = "the request does not match the API specification"
+	InvalidResponse = "the response does not match the API specification"
 
 	FailedToUnmarshalRecord = "failed to unmarshal record"
 	FailedToMarshalItem     = "failed to marshal item"
@@ -2,21 +2,69 @@ package planetmodel
 
 type (
 	CreateRequest struct {
-		Name    string `json:"name" binding:"required"`
+		Name    string `json:"name" binding:"required,planetname,max=100"`
 		Terrain string `json:"terrain" binding:"required"`
 		Climate string `json:"climate" binding:"required"`
 	}
 
+	// CreateBatchRequest is the query of a batch create, whose body is an array of CreateRequest
+	CreateBatchRequest struct {
+		Atomic bool `form:"atomic"`
+	}
+
 	GetRequest struct {
-		ID string `uri:"id" binding:"required,alphanum"`
+		ID string `uri:"id" binding:"required,objectid"`
+	}
+
+	// GetQuery selects the fields of the planet, a comma separated list of its json names
+	GetQuery struct {
+		Fields string `form:"fields"`
 	}
 
 	DeleteRequest struct {
-		ID string `uri:"id" binding:"required,alphanum"`
+		ID string `uri:"id" binding:"required,objectid"`
+	}
+
+	// DeleteManyRequest selects the planets to delete. Deleting requires Confirm, a dry run
+	// only reports the matching planets.
+	DeleteManyRequest struct {
+		Name    string `form:"name" binding:"omitempty,planetname,max=100"`
+		Climate string `form:"climate"`
+		Terrain string `form:"terrain"`
+		Confirm bool   `form:"confirm"`
+		DryRun  bool   `form:"dry_run"`
+	}
+
+	// ExportRequest selects the planets to export and the format of the file
+	ExportRequest struct {
+		Format  string `form:"format,default=ndjson" binding:"oneof=ndjson csv json"`
+		Name    string `form:"name" binding:"omitempty,planetname,max=100"`
+		Climate string `form:"climate"`
+		Terrain string `form:"terrain"`
+	}
+
+	// ImportRequest is the query of an import, whose body is a file of ImportRow. Without Lookup
+	// the movies of each row are kept instead of asking SWAPI.
+	ImportRequest struct {
+		Format string `form:"format,default=ndjson" binding:"oneof=ndjson csv json"`
+		Lookup bool   `form:"lookup,default=true"`
+	}
+
+	// ImportRow is a planet of an import file
+	ImportRow struct {
+		Name    string `json:"name" binding:"required,planetname,max=100"`
+		Terrain string `json:"terrain" binding:"required"`
+		Climate string `json:"climate" binding:"required"`
+		Movies  *int   `json:"movies" binding:"omitempty,min=0"`
 	}
 
 	ListRequest struct {
-		// TODO: implement pagination
-		Name string `form:"name" binding:"alphanum"`
+		Name    string `form:"name" binding:"omitempty,planetname,max=100"`
+		Climate string `form:"climate"`
+		Terrain string `form:"terrain"`
+		Offset  int64  `form:"offset" binding:"omitempty,min=0"`
+		Limit   int64  `form:"limit" binding:"omitempty,min=1"`
+		// Fields selects the fields of the planets, a comma separated list of their json names
+		Fields string `form:"fields"`
 	}
 )
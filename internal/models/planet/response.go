@@ -1,31 +1,121 @@
 package planetmodel
 
 import (
+	"bytes"
+	"encoding/json"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type (
 	CreateResponse struct {
-		ID      primitive.ObjectID `json:"_id"`
-		Name    string             `json:"name"`
-		Terrain string             `json:"terrain"`
-		Climate string             `json:"climate"`
-		Movies  int                `json:"movies"`
+		ID        primitive.ObjectID `json:"_id"`
+		Name      string             `json:"name"`
+		Terrain   string             `json:"terrain"`
+		Climate   string             `json:"climate"`
+		Movies    int                `json:"movies"`
+		CreatedBy string             `json:"created_by,omitempty"`
+	}
+
+	// CreateBatchResponse holds the outcome of each planet of a batch, in the order they were sent
+	CreateBatchResponse struct {
+		Results []CreateBatchResult `json:"results"`
+	}
+
+	// CreateBatchResult holds the created planet, or the error it failed with, and the status the
+	// planet would get from POST /v1/planets
+	CreateBatchResult struct {
+		Status int             `json:"status"`
+		Planet *CreateResponse `json:"planet,omitempty"`
+		Error  string          `json:"error,omitempty"`
 	}
 
 	GetResponse struct {
-		ID      primitive.ObjectID `json:"_id"`
-		Name    string             `json:"name"`
-		Terrain string             `json:"terrain"`
-		Climate string             `json:"climate"`
-		Movies  int                `json:"movies"`
+		ID        primitive.ObjectID `json:"_id"`
+		Name      string             `json:"name"`
+		Terrain   string             `json:"terrain"`
+		Climate   string             `json:"climate"`
+		Movies    int                `json:"movies"`
+		CreatedBy string             `json:"created_by,omitempty"`
+	}
+
+	// DeleteManyResponse lists the deleted planets, or the planets a dry run would delete
+	DeleteManyResponse struct {
+		Count  int                  `json:"count"`
+		IDs    []primitive.ObjectID `json:"ids"`
+		DryRun bool                 `json:"dry_run"`
+	}
+
+	// ImportResponse counts the imported and failed rows of an import, listing the errors by line.
+	// TruncatedAt is the first line left unread when the rate limit stopped the import.
+	ImportResponse struct {
+		Imported    int           `json:"imported"`
+		Failed      int           `json:"failed"`
+		Errors      []ImportError `json:"errors"`
+		TruncatedAt int           `json:"truncated_at,omitempty"`
+	}
+
+	// ImportError is the error of a row, Line is its line in the file or, in a JSON array, its position
+	ImportError struct {
+		Line  int    `json:"line"`
+		Error string `json:"error"`
+	}
+
+	// Sparse is a response holding only Fields of Response, which are named by their json tag and
+	// kept in the order of Response
+	Sparse struct {
+		Response interface{}
+		Fields   []string
 	}
 
 	ListResponse struct {
-		ID      primitive.ObjectID `json:"_id"`
-		Name    string             `json:"name"`
-		Terrain string             `json:"terrain"`
-		Climate string             `json:"climate"`
-		Movies  int                `json:"movies"`
+		ID        primitive.ObjectID `json:"_id"`
+		Name      string             `json:"name"`
+		Terrain   string             `json:"terrain"`
+		Climate   string             `json:"climate"`
+		Movies    int                `json:"movies"`
+		CreatedBy string             `json:"created_by,omitempty"`
 	}
 )
+
+// MarshalJSON encodes the fields of the JSON object of s.Response selected by s.Fields
+func (s Sparse) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(s.Response)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]bool, len(s.Fields))
+	for _, field := range s.Fields {
+		selected[field] = true
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// the opening brace of the object
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		name, _ := key.(string)
+		if !selected[name] {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		encodedKey, _ := json.Marshal(name)
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
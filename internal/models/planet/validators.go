@@ -0,0 +1,54 @@
+package planetmodel
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"sync"
+)
+
+const (
+	// NameTag validates a planet name: words of letters and digits separated by a space or a
+	// hyphen, as in "Yavin IV" or "Mon Cala"
+	NameTag = "planetname"
+	// ObjectIDTag validates the hex of an ObjectID, the ID of a planet
+	ObjectIDTag = "objectid"
+)
+
+// NamePattern is the pattern of the planet names
+const NamePattern = `^[\p{L}\p{N}]+(?:[ -][\p{L}\p{N}]+)*$`
+
+var (
+	namePattern = regexp.MustCompile(NamePattern)
+
+	registerOnce sync.Once
+	registerErr  error
+)
+
+// RegisterValidators registers the validators of the planet models with the validator of gin.
+// It is safe to call more than once.
+func RegisterValidators() error {
+	registerOnce.Do(func() {
+		engine, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			registerErr = fmt.Errorf("register validators: unexpected validator %T", binding.Validator.Engine())
+			return
+		}
+		if registerErr = engine.RegisterValidation(NameTag, isName); registerErr != nil {
+			return
+		}
+		registerErr = engine.RegisterValidation(ObjectIDTag, isObjectID)
+	})
+	return registerErr
+}
+
+func isName(fl validator.FieldLevel) bool {
+	return namePattern.MatchString(fl.Field().String())
+}
+
+func isObjectID(fl validator.FieldLevel) bool {
+	_, err := primitive.ObjectIDFromHex(fl.Field().String())
+	return err == nil
+}
@@ -0,0 +1,246 @@
+// Package negotiate renders the responses in the media type chosen by the Accept header of the
+// request: JSON, the default, XML, YAML and MessagePack. The routes writing their own CSV or
+// NDJSON streams offer those to Accept too, and Render answers them in JSON.
+//
+// XML, YAML and MessagePack are rendered from the JSON encoding of the response, so every format
+// names and orders the fields as the json tags do.
+package negotiate
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	parseerrors "github.com/gmaschi/b2w-sw-planets/pkg/tools/parse-errors"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"strings"
+)
+
+const (
+	MIMECSV    = "text/csv"
+	MIMEYAML2  = "application/yaml"
+	MIMENDJSON = "application/x-ndjson"
+
+	// contextKey holds the media type negotiated by Accept
+	contextKey = "negotiate.media_type"
+	// xmlRoot names the root element of the XML responses, the items of arrays are named xmlItem
+	xmlRoot = "response"
+	xmlItem = "item"
+)
+
+// Offered are the media types every response can be rendered as, JSON first as the default
+var Offered = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEYAML,
+	MIMEYAML2,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+}
+
+// Accept negotiates the media type of the responses of a route among Offered and extra, answering
+// 406 before the handler runs when the request accepts none of them
+func Accept(extra ...string) gin.HandlerFunc {
+	offered := append(append([]string{}, Offered...), extra...)
+	return func(ctx *gin.Context) {
+		mediaType := ctx.NegotiateFormat(offered...)
+		if mediaType == "" {
+			err := fmt.Errorf("%s: %s", errorsmodel.NotAcceptable, strings.Join(offered, ", "))
+			Abort(ctx, http.StatusNotAcceptable, parseerrors.RequestErrorResponse(ctx.Request.Context(), err))
+			return
+		}
+		ctx.Set(contextKey, mediaType)
+	}
+}
+
+// MediaType returns the media type negotiated by Accept or, on routes without it, the one of
+// Offered preferred by the request, empty when none is acceptable
+func MediaType(ctx *gin.Context) string {
+	if mediaType := ctx.GetString(contextKey); mediaType != "" {
+		return mediaType
+	}
+	return ctx.NegotiateFormat(Offered...)
+}
+
+// Render writes data with status in the media type negotiated by Accept or, on routes without
+// it, among Offered. JSON is the fallback when the media type is not acceptable, which only
+// happens before Accept runs, or is one of the streamed media types, such as CSV.
+func Render(ctx *gin.Context, status int, data interface{}) {
+	mediaType := MediaType(ctx)
+
+	var err error
+	switch mediaType {
+	case binding.MIMEXML, binding.MIMEXML2:
+		err = renderXML(ctx, status, mediaType, data)
+	case binding.MIMEYAML, MIMEYAML2:
+		err = renderYAML(ctx, status, mediaType, data)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		err = renderMsgPack(ctx, status, data)
+	default:
+		ctx.JSON(status, data)
+		return
+	}
+	if err != nil {
+		// as ctx.JSON does, leaving the response to the recovery middleware
+		panic(err)
+	}
+}
+
+// Abort is Render stopping the handlers after the current one
+func Abort(ctx *gin.Context, status int, data interface{}) {
+	ctx.Abort()
+	Render(ctx, status, data)
+}
+
+func renderXML(ctx *gin.Context, status int, mediaType string, data interface{}) error {
+	value, err := document(data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if err := writeXML(encoder, xmlRoot, value); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	ctx.Data(status, mediaType+"; charset=utf-8", buf.Bytes())
+	return nil
+}
+
+// writeXML writes value as the element name: objects hold an element per field and arrays an
+// xmlItem element per item
+func writeXML(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			if err := writeXML(encoder, item.Key.(string), item.Value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXML(encoder, xmlItem, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+func renderYAML(ctx *gin.Context, status int, mediaType string, data interface{}) error {
+	value, err := document(data)
+	if err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	ctx.Data(status, mediaType+"; charset=utf-8", out)
+	return nil
+}
+
+func renderMsgPack(ctx *gin.Context, status int, data interface{}) error {
+	value, err := document(data)
+	if err != nil {
+		return err
+	}
+	ctx.Render(status, render.MsgPack{Data: unordered(value)})
+	return nil
+}
+
+// document decodes the JSON encoding of data into objects as yaml.MapSlice, keeping the order of
+// their fields, arrays as []interface{}, integers as int64 and the other numbers as float64
+func document(data interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	return decodeValue(decoder)
+}
+
+func decodeValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			object := yaml.MapSlice{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				object = append(object, yaml.MapItem{Key: key, Value: value})
+			}
+			_, err := decoder.Token()
+			return object, err
+		case '[':
+			array := []interface{}{}
+			for decoder.More() {
+				value, err := decodeValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+			_, err := decoder.Token()
+			return array, err
+		}
+		return nil, errors.New("unexpected JSON delimiter")
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	default:
+		return v, nil
+	}
+}
+
+// unordered replaces the objects of value with maps, which MessagePack encodes as maps
+func unordered(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		object := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			object[item.Key.(string)] = unordered(item.Value)
+		}
+		return object
+	case []interface{}:
+		for i := range v {
+			v[i] = unordered(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
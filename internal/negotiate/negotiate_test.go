@@ -0,0 +1,171 @@
+package negotiate_test
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gmaschi/b2w-sw-planets/internal/negotiate"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+type (
+	planet struct {
+		Name      string `json:"name"`
+		Movies    int    `json:"movies"`
+		CreatedBy string `json:"created_by,omitempty"`
+	}
+
+	planets []planet
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestRender(t *testing.T) {
+	list := planets{{Name: "Tatooine", Movies: 5, CreatedBy: "luke"}, {Name: "Kamino", Movies: 1}}
+
+	router := gin.New()
+	router.GET("/planets", negotiate.Accept(negotiate.MIMECSV), func(ctx *gin.Context) {
+		negotiate.Render(ctx, http.StatusOK, list)
+	})
+	router.GET("/planet", negotiate.Accept(), func(ctx *gin.Context) {
+		negotiate.Render(ctx, http.StatusCreated, list[0])
+	})
+	router.GET("/missing", func(ctx *gin.Context) {
+		negotiate.Abort(ctx, http.StatusNotFound, map[string]interface{}{"error": "planet does not exist"})
+	})
+
+	testCases := []struct {
+		name          string
+		path          string
+		accept        string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "JSONByDefault",
+			path: "/planet",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.JSONEq(t, `{"name":"Tatooine","movies":5,"created_by":"luke"}`, recorder.Body.String())
+			},
+		},
+		{
+			name:   "Wildcard",
+			path:   "/planet",
+			accept: "*/*",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "XML",
+			path:   "/planets",
+			accept: "application/xml",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+					`<response><item><name>Tatooine</name><movies>5</movies><created_by>luke</created_by></item>`+
+					`<item><name>Kamino</name><movies>1</movies></item></response>`, recorder.Body.String())
+			},
+		},
+		{
+			name:   "YAML",
+			path:   "/planet",
+			accept: "application/yaml",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Equal(t, "application/yaml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.Equal(t, "name: Tatooine\nmovies: 5\ncreated_by: luke\n", recorder.Body.String())
+			},
+		},
+		{
+			name:   "MessagePack",
+			path:   "/planet",
+			accept: "application/msgpack",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Equal(t, "application/msgpack; charset=utf-8", recorder.Header().Get("Content-Type"))
+				var got map[string]interface{}
+				handle := codec.MsgpackHandle{}
+				handle.RawToString = true
+				require.NoError(t, codec.NewDecoderBytes(recorder.Body.Bytes(), &handle).Decode(&got))
+				require.Equal(t, map[string]interface{}{"name": "Tatooine", "movies": int64(5), "created_by": "luke"}, got)
+			},
+		},
+		{
+			name:   "CSVRenderedAsJSON",
+			path:   "/planets",
+			accept: "text/csv",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.JSONEq(t, `[{"name":"Tatooine","movies":5,"created_by":"luke"},{"name":"Kamino","movies":1}]`, recorder.Body.String())
+			},
+		},
+		{
+			name:   "PreferenceOrder",
+			path:   "/planet",
+			accept: "text/csv, application/x-yaml, application/json",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Equal(t, "application/x-yaml; charset=utf-8", recorder.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "CSVNotOffered",
+			path:   "/planet",
+			accept: "text/csv",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotAcceptable, recorder.Code)
+				require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name:   "NotAcceptable",
+			path:   "/planets",
+			accept: "text/html",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotAcceptable, recorder.Code)
+			},
+		},
+		{
+			name:   "ErrorWithoutAccept",
+			path:   "/missing",
+			accept: "application/xml",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "<response><error>planet does not exist</error></response>")
+			},
+		},
+		{
+			name:   "ErrorFallsBackToJSON",
+			path:   "/missing",
+			accept: "text/html",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.JSONEq(t, `{"error":"planet does not exist"}`, recorder.Body.String())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
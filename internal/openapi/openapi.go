@@ -0,0 +1,39 @@
+// Package openapi serves the OpenAPI 3 document of the API, kept in openapi.json, and a Redoc
+// page rendering it.
+package openapi
+
+import (
+	_ "embed"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const (
+	// SpecPath serves the OpenAPI document
+	SpecPath = "/openapi.json"
+	// DocsPath serves the page rendering the document
+	DocsPath = "/docs"
+)
+
+var (
+	//go:embed openapi.json
+	spec []byte
+
+	//go:embed docs.html
+	docs []byte
+)
+
+// Spec returns the OpenAPI document
+func Spec() []byte {
+	return append([]byte(nil), spec...)
+}
+
+// ServeSpec handles the request for the OpenAPI document
+func ServeSpec(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+}
+
+// ServeDocs handles the request for the page rendering the OpenAPI document
+func ServeDocs(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", docs)
+}
@@ -0,0 +1,242 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	healthcontroller "github.com/gmaschi/b2w-sw-planets/internal/controllers/health"
+	planetsfactory "github.com/gmaschi/b2w-sw-planets/internal/factories/planets-factory"
+	validationmiddleware "github.com/gmaschi/b2w-sw-planets/internal/middlewares/validation"
+	apikeymodel "github.com/gmaschi/b2w-sw-planets/internal/models/api-key"
+	planetmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet"
+	"github.com/gmaschi/b2w-sw-planets/internal/openapi"
+	memorystore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/memory/planets-db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type (
+	// document is the part of the OpenAPI document checked against the routes and the models
+	document struct {
+		Paths      map[string]map[string]operation `json:"paths"`
+		Components struct {
+			Schemas map[string]schema `json:"schemas"`
+		} `json:"components"`
+	}
+
+	operation struct {
+		Parameters []struct {
+			Name   string `json:"name"`
+			In     string `json:"in"`
+			Schema struct {
+				Pattern string `json:"pattern"`
+			} `json:"schema"`
+		} `json:"parameters"`
+	}
+
+	schema struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+)
+
+// pathParam matches the path parameters of gin, which the document writes between braces
+var pathParam = regexp.MustCompile(`:([a-zA-Z_]+)`)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func loadDocument(t *testing.T) document {
+	var doc document
+	require.NoError(t, json.Unmarshal(openapi.Spec(), &doc))
+	return doc
+}
+
+// TestRoutes fails when a route is missing from the document or the document has an operation
+// no route serves
+func TestRoutes(t *testing.T) {
+	server, err := planetsfactory.New(memorystore.NewStore(nil),
+		planetsfactory.WithAPIKeys(memorystore.NewKeyStore()),
+		planetsfactory.WithMetrics(prometheus.NewRegistry(), "/metrics"),
+	)
+	require.NoError(t, err)
+
+	var routes []string
+	for _, route := range server.Router.Routes() {
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		// the custom methods are routed as a parameter following the collection
+		path = strings.Replace(path, "/v1/planets{method}", "/v1/planets:batch", 1)
+		routes = append(routes, route.Method+" "+path)
+	}
+
+	var operations []string
+	for path, item := range loadDocument(t).Paths {
+		for method := range item {
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(routes)
+	sort.Strings(operations)
+	require.Equal(t, routes, operations)
+}
+
+// TestSchemas fails when a schema and its model disagree on the fields or, for the requests, on
+// the required fields
+func TestSchemas(t *testing.T) {
+	testCases := []struct {
+		schema  string
+		model   interface{}
+		request bool
+	}{
+		{schema: "CreateRequest", model: planetmodel.CreateRequest{}, request: true},
+		{schema: "ImportRow", model: planetmodel.ImportRow{}, request: true},
+		{schema: "CreateAPIKeyRequest", model: apikeymodel.CreateRequest{}, request: true},
+		{schema: "Planet", model: planetmodel.CreateResponse{}},
+		{schema: "Planet", model: planetmodel.GetResponse{}},
+		{schema: "Planet", model: planetmodel.ListResponse{}},
+		{schema: "CreateBatchResponse", model: planetmodel.CreateBatchResponse{}},
+		{schema: "CreateBatchResult", model: planetmodel.CreateBatchResult{}},
+		{schema: "DeleteManyResponse", model: planetmodel.DeleteManyResponse{}},
+		{schema: "ImportResponse", model: planetmodel.ImportResponse{}},
+		{schema: "ImportError", model: planetmodel.ImportError{}},
+		{schema: "Readiness", model: healthcontroller.ReadinessResponse{}},
+		{schema: "Dependency", model: healthcontroller.Dependency{}},
+		{schema: "APIKey", model: apikeymodel.KeyResponse{}},
+		{schema: "CreatedAPIKey", model: apikeymodel.CreateResponse{}},
+		{schema: "FieldError", model: validationmiddleware.FieldError{}},
+	}
+
+	schemas := loadDocument(t).Components.Schemas
+	for _, tc := range testCases {
+		t.Run(tc.schema+"/"+reflect.TypeOf(tc.model).Name(), func(t *testing.T) {
+			schema, ok := schemas[tc.schema]
+			require.True(t, ok, "missing schema")
+
+			fields, required := jsonFields(reflect.TypeOf(tc.model))
+			properties := make([]string, 0, len(schema.Properties))
+			for name := range schema.Properties {
+				properties = append(properties, name)
+			}
+			require.ElementsMatch(t, fields, properties)
+			if tc.request {
+				require.ElementsMatch(t, required, schema.Required)
+			}
+		})
+	}
+}
+
+// TestParameters fails when the query parameters of an operation and the fields of its query
+// model disagree
+func TestParameters(t *testing.T) {
+	testCases := []struct {
+		method string
+		path   string
+		model  interface{}
+	}{
+		{method: "get", path: "/v1/planets", model: planetmodel.ListRequest{}},
+		{method: "delete", path: "/v1/planets", model: planetmodel.DeleteManyRequest{}},
+		{method: "get", path: "/v1/planets/{id}", model: planetmodel.GetQuery{}},
+		{method: "post", path: "/v1/planets:batch", model: planetmodel.CreateBatchRequest{}},
+		{method: "get", path: "/v1/planets/export", model: planetmodel.ExportRequest{}},
+		{method: "post", path: "/v1/planets/import", model: planetmodel.ImportRequest{}},
+	}
+
+	doc := loadDocument(t)
+	for _, tc := range testCases {
+		t.Run(strings.ToUpper(tc.method)+" "+tc.path, func(t *testing.T) {
+			operation, ok := doc.Paths[tc.path][tc.method]
+			require.True(t, ok, "missing operation")
+
+			var params []string
+			for _, param := range operation.Parameters {
+				if param.In == "query" {
+					params = append(params, param.Name)
+				}
+			}
+			require.ElementsMatch(t, formFields(reflect.TypeOf(tc.model)), params)
+		})
+	}
+}
+
+// TestNamePattern fails when the name filters and the planetname validator disagree
+func TestNamePattern(t *testing.T) {
+	doc := loadDocument(t)
+	for _, op := range []struct{ method, path string }{
+		{method: "get", path: "/v1/planets"},
+		{method: "delete", path: "/v1/planets"},
+		{method: "get", path: "/v1/planets/export"},
+	} {
+		var found bool
+		for _, param := range doc.Paths[op.path][op.method].Parameters {
+			if param.In == "query" && param.Name == "name" {
+				found = true
+				require.Equal(t, planetmodel.NamePattern, param.Schema.Pattern, op.method+" "+op.path)
+			}
+		}
+		require.True(t, found, "missing name filter in "+op.method+" "+op.path)
+	}
+}
+
+func TestServe(t *testing.T) {
+	server, err := planetsfactory.New(memorystore.NewStore(nil))
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, openapi.SpecPath, nil)
+	require.NoError(t, err)
+	server.Router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+	require.JSONEq(t, string(openapi.Spec()), recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, openapi.DocsPath, nil)
+	require.NoError(t, err)
+	server.Router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `spec-url="`+openapi.SpecPath+`"`)
+}
+
+// jsonFields returns the json names of the fields of model, those of embedded structs included,
+// and the names of the fields bound as required
+func jsonFields(model reflect.Type) (fields, required []string) {
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		if field.Anonymous {
+			embedded, embeddedRequired := jsonFields(field.Type)
+			fields = append(fields, embedded...)
+			required = append(required, embeddedRequired...)
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, name)
+		if strings.HasPrefix(field.Tag.Get("binding"), "required") {
+			required = append(required, name)
+		}
+	}
+	return fields, required
+}
+
+// formFields returns the query names of the fields of model
+func formFields(model reflect.Type) []string {
+	var fields []string
+	for i := 0; i < model.NumField(); i++ {
+		if name := strings.Split(model.Field(i).Tag.Get("form"), ",")[0]; name != "" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,242 @@
+package planetio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	planetmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxLineSize bounds the lines of the NDJSON and CSV files, so that a file without line breaks is
+// not read into memory whole. A longer line fails the import.
+const MaxLineSize = 64 * 1024
+
+type (
+	// Decoder reads planets from a file as they are decoded
+	Decoder interface {
+		// Decode reads the next planet, returning io.EOF after the last one or a *LineError
+		// when the planet cannot be read
+		Decode() (Row, error)
+	}
+
+	// Row is a planet read from a file
+	Row struct {
+		// Line is the line of the planet in the file or, in a JSON array, its position
+		Line   int
+		Planet planetmodel.ImportRow
+	}
+
+	ndjsonDecoder struct {
+		reader *bufio.Reader
+		line   int
+	}
+
+	csvDecoder struct {
+		reader  *csv.Reader
+		columns map[string]int
+	}
+
+	jsonDecoder struct {
+		decoder  *json.Decoder
+		started  bool
+		position int
+	}
+
+	// lineLimitReader fails the reads of a line longer than MaxLineSize
+	lineLimitReader struct {
+		reader io.Reader
+		// line is the current line and size the bytes of it read so far
+		line int
+		size int
+	}
+)
+
+// NewDecoder returns a Decoder reading a file of format from r
+func NewDecoder(r io.Reader, format Format) Decoder {
+	switch format {
+	case CSV:
+		reader := csv.NewReader(&lineLimitReader{reader: r, line: 1})
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		return &csvDecoder{reader: reader}
+	case JSON:
+		return &jsonDecoder{decoder: json.NewDecoder(r)}
+	default:
+		return &ndjsonDecoder{reader: bufio.NewReader(&lineLimitReader{reader: r, line: 1})}
+	}
+}
+
+func (d *ndjsonDecoder) Decode() (Row, error) {
+	for {
+		// the lines are bounded by the lineLimitReader, as ReadBytes has no limit
+		line, err := d.reader.ReadBytes('\n')
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			return Row{}, lineErr
+		}
+		if err != nil && err != io.EOF {
+			return Row{}, &LineError{Line: d.line + 1, Err: err, Fatal: true}
+		}
+		if len(line) == 0 && err == io.EOF {
+			return Row{}, io.EOF
+		}
+		d.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		row := Row{Line: d.line}
+		if err := json.Unmarshal(line, &row.Planet); err != nil {
+			return row, &LineError{Line: d.line, Err: jsonError(err)}
+		}
+		return row, nil
+	}
+}
+
+func (d *csvDecoder) Decode() (Row, error) {
+	if d.columns == nil {
+		if err := d.readHeader(); err != nil {
+			return Row{}, err
+		}
+	}
+
+	record, err := d.reader.Read()
+	if err == io.EOF {
+		return Row{}, io.EOF
+	}
+	var (
+		parseErr *csv.ParseError
+		lineErr  *LineError
+	)
+	if errors.As(err, &parseErr) {
+		return Row{}, &LineError{Line: parseErr.Line, Err: parseErr.Err}
+	}
+	if errors.As(err, &lineErr) {
+		return Row{}, lineErr
+	}
+	if err != nil {
+		return Row{}, &LineError{Err: err, Fatal: true}
+	}
+
+	line, _ := d.reader.FieldPos(0)
+	row := Row{
+		Line: line,
+		Planet: planetmodel.ImportRow{
+			Name:    d.field(record, "name"),
+			Terrain: d.field(record, "terrain"),
+			Climate: d.field(record, "climate"),
+		},
+	}
+	if movies := d.field(record, "movies"); movies != "" {
+		n, err := strconv.Atoi(movies)
+		if err != nil {
+			return row, &LineError{Line: line, Err: fmt.Errorf("%s: %s", errorsmodel.InvalidMovies, movies)}
+		}
+		row.Planet.Movies = &n
+	}
+	return row, nil
+}
+
+// readHeader maps the columns of the header to their index, requiring name, terrain and climate
+func (d *csvDecoder) readHeader() error {
+	header, err := d.reader.Read()
+	if err == io.EOF {
+		return io.EOF
+	}
+	var lineErr *LineError
+	if errors.As(err, &lineErr) {
+		return lineErr
+	}
+	if err != nil {
+		return &LineError{Line: 1, Err: err, Fatal: true}
+	}
+
+	d.columns = make(map[string]int, len(header))
+	for i, column := range header {
+		d.columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range []string{"name", "terrain", "climate"} {
+		if _, ok := d.columns[column]; !ok {
+			return &LineError{Line: 1, Err: fmt.Errorf("%s: %s", errorsmodel.MissingColumn, column), Fatal: true}
+		}
+	}
+	return nil
+}
+
+// field returns the trimmed value of column in record, empty when the record is too short
+func (d *csvDecoder) field(record []string, column string) string {
+	i, ok := d.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (d *jsonDecoder) Decode() (Row, error) {
+	if !d.started {
+		d.started = true
+		token, err := d.decoder.Token()
+		if err == io.EOF {
+			return Row{}, io.EOF
+		}
+		if err != nil || token != json.Delim('[') {
+			return Row{}, &LineError{Line: 1, Err: errors.New("expected a JSON array"), Fatal: true}
+		}
+	}
+	if !d.decoder.More() {
+		return Row{}, io.EOF
+	}
+
+	d.position++
+	row := Row{Line: d.position}
+	if err := d.decoder.Decode(&row.Planet); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		// a value of the wrong type is read whole, so the array goes on after it
+		return row, &LineError{Line: d.position, Err: jsonError(err), Fatal: !errors.As(err, &typeErr)}
+	}
+	return row, nil
+}
+
+// lineTooLong is the error of a line longer than MaxLineSize
+var lineTooLong = fmt.Errorf("line longer than %d bytes", MaxLineSize)
+
+func (r *lineLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			r.line++
+			r.size = 0
+			continue
+		}
+		r.size++
+		// the line is cut short, so that its end is never read as a record
+		if r.size > MaxLineSize {
+			return i, &LineError{Line: r.line, Err: lineTooLong, Fatal: true}
+		}
+	}
+	return n, err
+}
+
+// jsonError describes the error of decoding a planet without the Go types of the json package
+func jsonError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return errors.New("expected a JSON object")
+		}
+		return fmt.Errorf("invalid %s: expected %s, got %s", typeErr.Field, typeErr.Type.Kind(), typeErr.Value)
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("invalid JSON: %s", syntaxErr.Error())
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package planetio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	planetmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"io"
+)
+
+type (
+	// Encoder writes planets to a file as they are encoded
+	Encoder interface {
+		Encode(planet planetsdb.Planet) error
+		// Flush writes the planets buffered by the encoder, if any
+		Flush() error
+		// Close ends the file and flushes it, it must be called even when no planet was encoded
+		Close() error
+	}
+
+	ndjsonEncoder struct {
+		encoder *json.Encoder
+		fields  []string
+	}
+
+	csvEncoder struct {
+		writer *csv.Writer
+		header bool
+		// columns are the indexes in Columns of the written columns
+		columns []int
+	}
+
+	jsonEncoder struct {
+		w      io.Writer
+		count  int
+		fields []string
+	}
+)
+
+// NewEncoder returns an Encoder writing a file of format to w holding only fields of the planets,
+// by their json name, or every field when there is none
+func NewEncoder(w io.Writer, format Format, fields ...string) Encoder {
+	switch format {
+	case CSV:
+		return &csvEncoder{writer: csv.NewWriter(w), columns: columns(fields)}
+	case JSON:
+		return &jsonEncoder{w: w, fields: fields}
+	default:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w), fields: fields}
+	}
+}
+
+// response is the object written for planet, holding only fields unless there is none
+func response(planet planetsdb.Planet, fields []string) interface{} {
+	if len(fields) == 0 {
+		return planetmodel.ListResponse(planet)
+	}
+	return planetmodel.Sparse{Response: planetmodel.ListResponse(planet), Fields: fields}
+}
+
+// columns returns the indexes in Columns of fields, in the order of Columns
+func columns(fields []string) []int {
+	selected := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		selected[field] = true
+	}
+	indexes := make([]int, 0, len(Columns))
+	for i, column := range Columns {
+		if len(fields) == 0 || selected[column] {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// pick returns the values of columns of record
+func pick(record []string, columns []int) []string {
+	picked := make([]string, len(columns))
+	for i, column := range columns {
+		picked[i] = record[column]
+	}
+	return picked
+}
+
+func (e *ndjsonEncoder) Encode(planet planetsdb.Planet) error {
+	return e.encoder.Encode(response(planet, e.fields))
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+func (e *csvEncoder) Encode(planet planetsdb.Planet) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.writer.Write(pick(record(planet), e.columns))
+}
+
+func (e *csvEncoder) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+// writeHeader writes the header once, before the first planet
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.writer.Write(pick(Columns, e.columns))
+}
+
+func (e *jsonEncoder) Encode(planet planetsdb.Planet) error {
+	data, err := json.Marshal(response(planet, e.fields))
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if e.count == 0 {
+		separator = "["
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonEncoder) Flush() error {
+	return nil
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
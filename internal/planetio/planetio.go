@@ -0,0 +1,65 @@
+// Package planetio writes the files of the planets export and reads the files of the planets
+// import, as newline delimited JSON, CSV or a JSON array.
+package planetio
+
+import (
+	"fmt"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+)
+
+// Format is the encoding of a planets file
+type Format string
+
+const (
+	// NDJSON holds a JSON object per line
+	NDJSON Format = "ndjson"
+	// CSV holds a header naming the columns followed by a planet per line
+	CSV Format = "csv"
+	// JSON holds an array of objects
+	JSON Format = "json"
+)
+
+// Columns are the header of the exported CSV files. Imports read the name, terrain, climate and
+// movies columns, in any order, and ignore the others.
+var Columns = []string{"_id", "name", "terrain", "climate", "movies", "created_by"}
+
+// ContentType is the media type of the files of f
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSON:
+		return "application/json; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// LineError is a planet that could not be read. Reading goes on with the next planet unless
+// the error is Fatal.
+type LineError struct {
+	// Line is the line of the planet in the file or, in a JSON array, its position
+	Line  int
+	Err   error
+	Fatal bool
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// record returns the CSV columns of planet, in the order of Columns
+func record(planet planetsdb.Planet) []string {
+	return []string{
+		planet.ID.Hex(),
+		planet.Name,
+		planet.Terrain,
+		planet.Climate,
+		fmt.Sprint(planet.Movies),
+		planet.CreatedBy,
+	}
+}
@@ -0,0 +1,203 @@
+package planetio_test
+
+import (
+	"bytes"
+	"errors"
+	planetmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet"
+	"github.com/gmaschi/b2w-sw-planets/internal/planetio"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	id := primitive.NewObjectID()
+	planets := []planetsdb.Planet{
+		{ID: id, Name: "Tatooine", Terrain: "desert", Climate: "arid, hot", Movies: 5, CreatedBy: "luke"},
+		{ID: id, Name: "Kamino", Terrain: "ocean", Climate: "temperate", Movies: 1},
+	}
+	object := `{"_id":"` + id.Hex() + `","name":"Tatooine","terrain":"desert","climate":"arid, hot","movies":5,"created_by":"luke"}`
+	other := `{"_id":"` + id.Hex() + `","name":"Kamino","terrain":"ocean","climate":"temperate","movies":1}`
+
+	testCases := []struct {
+		name     string
+		format   planetio.Format
+		fields   []string
+		planets  []planetsdb.Planet
+		expected string
+	}{
+		{name: "NDJSON", format: planetio.NDJSON, planets: planets, expected: object + "\n" + other + "\n"},
+		{name: "NDJSONEmpty", format: planetio.NDJSON, expected: ""},
+		{
+			name:    "CSV",
+			format:  planetio.CSV,
+			planets: planets,
+			expected: "_id,name,terrain,climate,movies,created_by\n" +
+				id.Hex() + ",Tatooine,desert,\"arid, hot\",5,luke\n" +
+				id.Hex() + ",Kamino,ocean,temperate,1,\n",
+		},
+		{name: "CSVEmpty", format: planetio.CSV, expected: "_id,name,terrain,climate,movies,created_by\n"},
+		{name: "JSON", format: planetio.JSON, planets: planets, expected: "[" + object + "," + other + "]\n"},
+		{name: "JSONEmpty", format: planetio.JSON, expected: "[]\n"},
+		{
+			name:     "NDJSONFields",
+			format:   planetio.NDJSON,
+			fields:   []string{"_id", "movies", "name"},
+			planets:  planets[:1],
+			expected: `{"_id":"` + id.Hex() + `","name":"Tatooine","movies":5}` + "\n",
+		},
+		{
+			name:     "CSVFields",
+			format:   planetio.CSV,
+			fields:   []string{"_id", "movies", "name"},
+			planets:  planets[:1],
+			expected: "_id,name,movies\n" + id.Hex() + ",Tatooine,5\n",
+		},
+		{
+			name:     "JSONFields",
+			format:   planetio.JSON,
+			fields:   []string{"_id"},
+			planets:  planets,
+			expected: `[{"_id":"` + id.Hex() + `"},{"_id":"` + id.Hex() + `"}]` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := planetio.NewEncoder(&buf, tc.format, tc.fields...)
+			for _, planet := range tc.planets {
+				require.NoError(t, encoder.Encode(planet))
+			}
+			require.NoError(t, encoder.Close())
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	three := 3
+
+	testCases := []struct {
+		name     string
+		format   planetio.Format
+		file     string
+		expected []planetio.Row
+		errors   []planetio.LineError
+	}{
+		{
+			name:   "NDJSON",
+			format: planetio.NDJSON,
+			file: `{"name":"Tatooine","terrain":"desert","climate":"arid","movies":3}` + "\n\n" +
+				`{"name":"Kamino",` + "\n" +
+				`{"name":"Kamino","terrain":"ocean","climate":"temperate","movies":"many"}` + "\n" +
+				`{"name":"Kamino","terrain":"ocean","climate":"temperate"}`,
+			expected: []planetio.Row{
+				{Line: 1, Planet: planetmodel.ImportRow{Name: "Tatooine", Terrain: "desert", Climate: "arid", Movies: &three}},
+				{Line: 5, Planet: planetmodel.ImportRow{Name: "Kamino", Terrain: "ocean", Climate: "temperate"}},
+			},
+			errors: []planetio.LineError{{Line: 3}, {Line: 4}},
+		},
+		{
+			name:   "CSV",
+			format: planetio.CSV,
+			file: "Climate,name,terrain,movies\n" +
+				"arid,Tatooine,desert,3\n" +
+				"temp\"erate,Kamino,ocean\n" +
+				"temperate,Kamino,ocean,many\n" +
+				"temperate,Kamino,ocean\n",
+			expected: []planetio.Row{
+				{Line: 2, Planet: planetmodel.ImportRow{Name: "Tatooine", Terrain: "desert", Climate: "arid", Movies: &three}},
+				{Line: 5, Planet: planetmodel.ImportRow{Name: "Kamino", Terrain: "ocean", Climate: "temperate"}},
+			},
+			errors: []planetio.LineError{{Line: 3}, {Line: 4}},
+		},
+		{
+			name:   "CSVMissingColumn",
+			format: planetio.CSV,
+			file:   "name,terrain\nTatooine,desert\n",
+			errors: []planetio.LineError{{Line: 1, Fatal: true}},
+		},
+		{
+			name:   "JSON",
+			format: planetio.JSON,
+			file: `[{"name":"Tatooine","terrain":"desert","climate":"arid","movies":3},` + "\n" +
+				`{"name":"Kamino","movies":"many"}, 1,` + "\n" +
+				`{"name":"Kamino","terrain":"ocean","climate":"temperate"}]`,
+			expected: []planetio.Row{
+				{Line: 1, Planet: planetmodel.ImportRow{Name: "Tatooine", Terrain: "desert", Climate: "arid", Movies: &three}},
+				{Line: 4, Planet: planetmodel.ImportRow{Name: "Kamino", Terrain: "ocean", Climate: "temperate"}},
+			},
+			errors: []planetio.LineError{{Line: 2}, {Line: 3}},
+		},
+		{
+			name:   "JSONSyntax",
+			format: planetio.JSON,
+			file:   `[{"name":"Tatooine"}, {"name":]`,
+			expected: []planetio.Row{
+				{Line: 1, Planet: planetmodel.ImportRow{Name: "Tatooine"}},
+			},
+			errors: []planetio.LineError{{Line: 2, Fatal: true}},
+		},
+		{
+			name:   "JSONNotArray",
+			format: planetio.JSON,
+			file:   `{"name":"Tatooine"}`,
+			errors: []planetio.LineError{{Line: 1, Fatal: true}},
+		},
+		{
+			name:   "NDJSONLineTooLong",
+			format: planetio.NDJSON,
+			file: `{"name":"Tatooine","terrain":"desert","climate":"arid","movies":3}` + "\n" +
+				`{"name":"` + strings.Repeat("a", planetio.MaxLineSize) + `"}` + "\n" +
+				`{"name":"Kamino","terrain":"ocean","climate":"temperate"}`,
+			expected: []planetio.Row{
+				{Line: 1, Planet: planetmodel.ImportRow{Name: "Tatooine", Terrain: "desert", Climate: "arid", Movies: &three}},
+			},
+			errors: []planetio.LineError{{Line: 2, Fatal: true}},
+		},
+		{
+			name:   "CSVLineTooLong",
+			format: planetio.CSV,
+			file: "name,terrain,climate\n" +
+				"Tatooine,desert,arid\n" +
+				strings.Repeat("a", planetio.MaxLineSize) + ",ocean,temperate\n",
+			expected: []planetio.Row{
+				{Line: 2, Planet: planetmodel.ImportRow{Name: "Tatooine", Terrain: "desert", Climate: "arid"}},
+			},
+			errors: []planetio.LineError{{Line: 3, Fatal: true}},
+		},
+		{name: "Empty", format: planetio.CSV, file: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoder := planetio.NewDecoder(strings.NewReader(tc.file), tc.format)
+			var (
+				rows      []planetio.Row
+				lineErrs  []planetio.LineError
+				lineError *planetio.LineError
+			)
+			for {
+				row, err := decoder.Decode()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					require.True(t, errors.As(err, &lineError))
+					lineErrs = append(lineErrs, planetio.LineError{Line: lineError.Line, Fatal: lineError.Fatal})
+					if lineError.Fatal {
+						break
+					}
+					continue
+				}
+				rows = append(rows, row)
+			}
+			require.Equal(t, tc.expected, rows)
+			require.Equal(t, tc.errors, lineErrs)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store forgets the buckets that are full again
+const sweepInterval = time.Minute
+
+type (
+	// MemoryStore keeps the buckets in the process, limiting each replica on its own
+	MemoryStore struct {
+		mu      sync.Mutex
+		buckets map[string]memoryBucket
+		swept   time.Time
+	}
+
+	memoryBucket struct {
+		Bucket
+		fullAt time.Time
+	}
+)
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]memoryBucket)}
+}
+
+// Take takes n tokens from the bucket of key
+func (ms *MemoryStore) Take(ctx context.Context, key string, limit Limit, n int, now time.Time) (Result, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if now.Sub(ms.swept) > sweepInterval {
+		for k, b := range ms.buckets {
+			if !now.Before(b.fullAt) {
+				delete(ms.buckets, k)
+			}
+		}
+		ms.swept = now
+	}
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b.Bucket = limit.Full(now)
+	}
+	bucket, res := limit.Take(b.Bucket, n, now)
+	ms.buckets[key] = memoryBucket{Bucket: bucket, fullAt: limit.FullAt(bucket)}
+	return res, nil
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: time.Minute}
+	now := time.Now()
+
+	for _, key := range []string{"idle", "busy"} {
+		_, err := store.Take(context.Background(), key, limit, 1, now)
+		require.NoError(t, err)
+	}
+	_, err := store.Take(context.Background(), "busy", limit, 1, now.Add(50*time.Second))
+	require.NoError(t, err)
+
+	// idle is full again after 30s, busy only after 80s
+	_, err = store.Take(context.Background(), "other", limit, 1, now.Add(sweepInterval+time.Second))
+	require.NoError(t, err)
+	require.NotContains(t, store.buckets, "idle")
+	require.Contains(t, store.buckets, "busy")
+}
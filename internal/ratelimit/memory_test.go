@@ -0,0 +1,13 @@
+package ratelimit_test
+
+import (
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit/ratelimittest"
+	"testing"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Store {
+		return ratelimit.NewMemoryStore()
+	})
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+type (
+	// Limit allows bursts of Requests requests, refilled at Requests per Period
+	Limit struct {
+		Requests int
+		Period   time.Duration
+	}
+
+	// Result is the outcome of taking tokens from a bucket
+	Result struct {
+		Allowed   bool
+		Remaining int
+		// RetryAfter is how long until the next token, zero when the request was allowed
+		RetryAfter time.Duration
+		// Reset is how long until the bucket is full again
+		Reset time.Duration
+	}
+
+	// Bucket is the state of a token bucket at Updated. Tokens is negative while the bucket
+	// pays off a request that cost more than it held.
+	Bucket struct {
+		Tokens  float64
+		Updated time.Time
+	}
+
+	// Store keeps the buckets of every client. Stores shared by several replicas must take
+	// tokens atomically.
+	Store interface {
+		// Take takes n tokens from the bucket of key when it holds at least one
+		Take(ctx context.Context, key string, limit Limit, n int, now time.Time) (Result, error)
+	}
+)
+
+// rate is the number of tokens refilled per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Full returns the bucket of a client that has not made requests lately
+func (l Limit) Full(now time.Time) Bucket {
+	return Bucket{Tokens: float64(l.Requests), Updated: now}
+}
+
+// Take refills b up to now and takes n tokens from it when one is left. A request costing more
+// than the tokens left, such as a batch of planets, leaves the bucket in debt, so the requests
+// that follow wait until it is paid off.
+func (l Limit) Take(b Bucket, n int, now time.Time) (Bucket, Result) {
+	elapsed := now.Sub(b.Updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	tokens := math.Min(float64(l.Requests), b.Tokens+elapsed*l.rate())
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens -= float64(n)
+	}
+	return Bucket{Tokens: tokens, Updated: now}, l.Result(tokens, allowed)
+}
+
+// Result describes a take that left tokens in the bucket, for the stores that keep the
+// buckets in another form
+func (l Limit) Result(tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Max(tokens, 0)),
+		Reset:     seconds((float64(l.Requests) - tokens) / l.rate()),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / l.rate())
+	}
+	return res
+}
+
+// Interval is the time a token takes to be refilled
+func (l Limit) Interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// FullAt returns when b is full again, after which it can be forgotten
+func (l Limit) FullAt(b Bucket) time.Time {
+	return b.Updated.Add(seconds((float64(l.Requests) - b.Tokens) / l.rate()))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
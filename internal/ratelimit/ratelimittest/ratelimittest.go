@@ -0,0 +1,142 @@
+// Package ratelimittest provides a conformance test suite for ratelimit.Store implementations.
+//
+// The suite uses random bucket keys, so it can run against a store that already holds buckets.
+package ratelimittest
+
+import (
+	"context"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory creates the store under test
+type Factory func(t *testing.T) ratelimit.Store
+
+// Run runs the whole conformance suite against the stores built by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store ratelimit.Store)
+	}{
+		{name: "Burst", test: testBurst},
+		{name: "Refill", test: testRefill},
+		{name: "Keys", test: testKeys},
+		{name: "Debt", test: testDebt},
+		{name: "Concurrency", test: testConcurrency},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore(t))
+		})
+	}
+}
+
+var limit = ratelimit.Limit{Requests: 3, Period: time.Minute}
+
+func take(t *testing.T, store ratelimit.Store, key string, now time.Time) ratelimit.Result {
+	res, err := store.Take(context.Background(), key, limit, 1, now)
+	require.NoError(t, err)
+	return res
+}
+
+func testBurst(t *testing.T, store ratelimit.Store) {
+	key, now := random.String(12), time.Now()
+
+	for remaining := limit.Requests - 1; remaining >= 0; remaining-- {
+		res := take(t, store, key, now)
+		require.True(t, res.Allowed)
+		require.Equal(t, remaining, res.Remaining)
+		require.Zero(t, res.RetryAfter)
+	}
+
+	res := take(t, store, key, now)
+	require.False(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+	require.InDelta(t, float64(20*time.Second), float64(res.RetryAfter), float64(time.Millisecond))
+	require.InDelta(t, float64(time.Minute), float64(res.Reset), float64(time.Millisecond))
+}
+
+func testRefill(t *testing.T, store ratelimit.Store) {
+	key, now := random.String(12), time.Now()
+	for i := 0; i < limit.Requests; i++ {
+		require.True(t, take(t, store, key, now).Allowed)
+	}
+	require.False(t, take(t, store, key, now.Add(19*time.Second)).Allowed)
+
+	res := take(t, store, key, now.Add(20*time.Second))
+	require.True(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+
+	// a bucket never holds more than the burst
+	res = take(t, store, key, now.Add(time.Hour))
+	require.True(t, res.Allowed)
+	require.Equal(t, limit.Requests-1, res.Remaining)
+}
+
+func testKeys(t *testing.T, store ratelimit.Store) {
+	key, now := random.String(12), time.Now()
+	for i := 0; i < limit.Requests; i++ {
+		require.True(t, take(t, store, key, now).Allowed)
+	}
+	require.False(t, take(t, store, key, now).Allowed)
+	require.True(t, take(t, store, random.String(12), now).Allowed)
+}
+
+func testDebt(t *testing.T, store ratelimit.Store) {
+	key, now := random.String(12), time.Now()
+
+	// a request costing more than the burst is allowed from a bucket holding a token
+	res, err := store.Take(context.Background(), key, limit, 2*limit.Requests-1, now)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+
+	// and the bucket is paid off before the next one
+	res = take(t, store, key, now)
+	require.False(t, res.Allowed)
+	require.InDelta(t, float64(time.Minute), float64(res.RetryAfter), float64(time.Millisecond))
+	require.False(t, take(t, store, key, now.Add(59*time.Second)).Allowed)
+	require.True(t, take(t, store, key, now.Add(time.Minute)).Allowed)
+}
+
+func testConcurrency(t *testing.T, store ratelimit.Store) {
+	key, now := random.String(12), time.Now()
+	limit := ratelimit.Limit{Requests: 10, Period: time.Hour}
+
+	n := 3 * limit.Requests
+	var wg sync.WaitGroup
+	results := make(chan ratelimit.Result, n)
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := store.Take(context.Background(), key, limit, 1, now)
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- res
+		}()
+	}
+	wg.Wait()
+	close(results)
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	allowed := 0
+	for res := range results {
+		if res.Allowed {
+			allowed++
+		}
+	}
+	require.Equal(t, limit.Requests, allowed)
+}
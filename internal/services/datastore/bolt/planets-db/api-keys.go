@@ -0,0 +1,117 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// errKeyNotFound stops a transaction that did not find the API key
+var errKeyNotFound = errors.New(errorsmodel.APIKeyDoesNotExist)
+
+// KeyStore is an apikeys.Store kept in the api_keys bucket of a BoltStore file, with an
+// index from hash to ID
+type KeyStore struct {
+	db *bolt.DB
+}
+
+// KeyStore returns the API keys stored next to the planets
+func (bs *BoltStore) KeyStore() *KeyStore {
+	return &KeyStore{db: bs.db}
+}
+
+// CreateKey stores key
+func (ks *KeyStore) CreateKey(ctx context.Context, key apikeys.Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("create API key: %s", errorsmodel.FailedToMarshalItem)
+	}
+
+	err = ks.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(apiKeysBucket).Put([]byte(key.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(apiKeysHashBucket).Put([]byte(key.Hash), []byte(key.ID))
+	})
+	if err != nil {
+		return fmt.Errorf("create API key: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return nil
+}
+
+// KeyByHash gets the key with hash
+func (ks *KeyStore) KeyByHash(ctx context.Context, hash string) (apikeys.Key, error) {
+	var key apikeys.Key
+	err := ks.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(apiKeysHashBucket).Get([]byte(hash))
+		if id == nil {
+			return errKeyNotFound
+		}
+		return json.Unmarshal(tx.Bucket(apiKeysBucket).Get(id), &key)
+	})
+	if err != nil {
+		if errors.Is(err, errKeyNotFound) {
+			return apikeys.Key{}, fmt.Errorf("get API key: %s", errorsmodel.APIKeyDoesNotExist)
+		}
+		return apikeys.Key{}, fmt.Errorf("get API key: %s", errorsmodel.FailedToUnmarshalRecord)
+	}
+	return key, nil
+}
+
+// ListKeys lists every key, revoked ones included, oldest first
+func (ks *KeyStore) ListKeys(ctx context.Context) ([]apikeys.Key, error) {
+	keys := []apikeys.Key{}
+	err := ks.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).ForEach(func(_, data []byte) error {
+			var key apikeys.Key
+			if err := json.Unmarshal(data, &key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %s", errorsmodel.FailedToUnmarshalRecord)
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes the key with id. Revoking a revoked key keeps its first revocation time.
+func (ks *KeyStore) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	err := ks.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(apiKeysBucket)
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return errKeyNotFound
+		}
+
+		var key apikeys.Key
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		if key.Revoked() {
+			return nil
+		}
+		revokedAt := at.UTC()
+		key.RevokedAt = &revokedAt
+
+		data, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+	if err != nil {
+		if errors.Is(err, errKeyNotFound) {
+			return fmt.Errorf("revoke API key: %s", errorsmodel.APIKeyDoesNotExist)
+		}
+		return fmt.Errorf("revoke API key: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return nil
+}
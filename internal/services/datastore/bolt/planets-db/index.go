@@ -0,0 +1,84 @@
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	bolt "go.etcd.io/bbolt"
+)
+
+// errNameTaken rolls back the transaction creating a planet whose name is taken
+var errNameTaken = errors.New(errorsmodel.PlanetAlreadyExists)
+
+// index is a secondary index of planets by one of their fields
+type index struct {
+	bucket []byte
+	value  func(planet planetsdb.Planet) string
+}
+
+var indexes = []index{
+	{bucket: nameIndexBucket, value: func(planet planetsdb.Planet) string { return planet.Name }},
+	{bucket: climateIndexBucket, value: func(planet planetsdb.Planet) string { return planet.Climate }},
+	{bucket: terrainIndexBucket, value: func(planet planetsdb.Planet) string { return planet.Terrain }},
+}
+
+// indexPrefix encodes the length of value before value itself, so the prefix of
+// one value never matches the entries of a longer value that starts the same way
+func indexPrefix(value string) []byte {
+	prefix := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(value))
+	n := binary.PutUvarint(prefix, uint64(len(value)))
+	return append(prefix[:n], value...)
+}
+
+// indexKey is the prefix of value followed by the planet ID, keeping the entries of one value ordered by ID
+func indexKey(value string, id []byte) []byte {
+	return append(indexPrefix(value), id...)
+}
+
+func putIndexes(tx *bolt.Tx, planet planetsdb.Planet) error {
+	for _, idx := range indexes {
+		if err := tx.Bucket(idx.bucket).Put(indexKey(idx.value(planet), planet.ID[:]), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteIndexes(tx *bolt.Tx, planet planetsdb.Planet) error {
+	for _, idx := range indexes {
+		if err := tx.Bucket(idx.bucket).Delete(indexKey(idx.value(planet), planet.ID[:])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanIndex calls fn with the ID of every planet whose indexed field equals value, in ID order
+// and after the ID after when it is not nil, until fn returns false
+func scanIndex(tx *bolt.Tx, bucket []byte, value string, after []byte, fn func(id []byte) bool) {
+	prefix, start := indexPrefix(value), indexPrefix(value)
+	if after != nil {
+		start = indexKey(value, after)
+	}
+	c := tx.Bucket(bucket).Cursor()
+	for k, _ := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if after != nil && bytes.Equal(k[len(prefix):], after) {
+			continue
+		}
+		if !fn(k[len(prefix):]) {
+			return
+		}
+	}
+}
+
+// named reports whether a planet is named name
+func named(tx *bolt.Tx, name string) bool {
+	var found bool
+	scanIndex(tx, nameIndexBucket, name, nil, func(id []byte) bool {
+		found = true
+		return false
+	})
+	return found
+}
@@ -0,0 +1,348 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+// CreatePlanet creates a new planet resource with the specified arguments
+func (bs *BoltStore) CreatePlanet(ctx context.Context, arg planetsdb.CreatePlanetParams) (planetsdb.Planet, error) {
+	movies, err := bs.movies.MovieAppearances(ctx, arg.Name)
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("create planet: %s", err.Error())
+	}
+
+	planet := planetsdb.Planet{
+		ID:        primitive.NewObjectID(),
+		Name:      arg.Name,
+		Terrain:   arg.Terrain,
+		Climate:   arg.Climate,
+		Movies:    movies,
+		CreatedBy: arg.CreatedBy,
+	}
+
+	data, err := json.Marshal(planet)
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("create planet: %s", errorsmodel.FailedToMarshalItem)
+	}
+
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+		if named(tx, planet.Name) {
+			return errNameTaken
+		}
+		if err := tx.Bucket(planetsBucket).Put(planet.ID[:], data); err != nil {
+			return err
+		}
+		return putIndexes(tx, planet)
+	})
+	if errors.Is(err, errNameTaken) {
+		return planetsdb.Planet{}, fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)
+	}
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("create planet: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return planet, nil
+}
+
+// CreatePlanets creates the planets of arg in a single transaction, so a failed write creates
+// none of them
+func (bs *BoltStore) CreatePlanets(ctx context.Context, arg planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+	results := planetsdb.LookupMovies(ctx, bs.movies, arg)
+	if arg.Atomic && planetsdb.Failed(results) {
+		planetsdb.Abort(results)
+		return results, nil
+	}
+
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		for i := range results {
+			if results[i].Err != nil {
+				continue
+			}
+			if named(tx, results[i].Planet.Name) {
+				results[i].Err = fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)
+				if arg.Atomic {
+					return errNameTaken
+				}
+				continue
+			}
+			results[i].Planet.ID = primitive.NewObjectID()
+			data, err := json.Marshal(results[i].Planet)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(planetsBucket).Put(results[i].Planet.ID[:], data); err != nil {
+				return err
+			}
+			if err := putIndexes(tx, results[i].Planet); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errNameTaken) {
+		// the transaction was rolled back, so none of the planets was created
+		planetsdb.Abort(results)
+		return results, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create planets: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return results, nil
+}
+
+// CountPlanets counts the planets of the store
+func (bs *BoltStore) CountPlanets(ctx context.Context) (int64, error) {
+	var count int64
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		count = int64(tx.Bucket(planetsBucket).Stats().KeyN)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("count planets: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return count, nil
+}
+
+// DeletePlanet deletes an existing planet and its index entries based on the id
+func (bs *BoltStore) DeletePlanet(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("delete planet: %s", errorsmodel.InvalidID)
+	}
+
+	var found bool
+	err = bs.db.Update(func(tx *bolt.Tx) error {
+		planets := tx.Bucket(planetsBucket)
+		data := planets.Get(objectID[:])
+		if data == nil {
+			return nil
+		}
+		found = true
+		var planet planetsdb.Planet
+		if err := json.Unmarshal(data, &planet); err != nil {
+			return err
+		}
+		if err := deleteIndexes(tx, planet); err != nil {
+			return err
+		}
+		return planets.Delete(objectID[:])
+	})
+	if err != nil {
+		return fmt.Errorf("delete planet: %s", errorsmodel.CouldNotDeleteItem)
+	}
+	if !found {
+		return fmt.Errorf("delete planet: %s", errorsmodel.PlanetDoesNotExist)
+	}
+	return nil
+}
+
+// GetPlanet finds a planet based on the ID, holding only its ID and fields unless fields is empty
+func (bs *BoltStore) GetPlanet(ctx context.Context, id string, fields ...string) (planetsdb.Planet, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.InvalidID)
+	}
+
+	var data []byte
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		// data is only valid inside the transaction, so keep a copy
+		data = append(data, tx.Bucket(planetsBucket).Get(objectID[:])...)
+		return nil
+	})
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.FailedToFetchRecord)
+	}
+	if len(data) == 0 {
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.PlanetDoesNotExist)
+	}
+
+	var planet planetsdb.Planet
+	if err := json.Unmarshal(data, &planet); err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.FailedToUnmarshalRecord)
+	}
+	return planetsdb.Project(planet, fields), nil
+}
+
+// ListPlanets list planets filtered by name, climate and terrain, ordered by ID.
+// A filtered list walks the index of the first filter instead of every planet.
+func (bs *BoltStore) ListPlanets(ctx context.Context, arg planetsdb.ListPlanetParams) ([]planetsdb.Planet, error) {
+	planets, err := bs.list(arg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("list planets: %s", err.Error())
+	}
+
+	if len(planets) == 0 {
+		return nil, fmt.Errorf("list planets: %s", errorsmodel.PlanetDoesNotExist)
+	}
+
+	return planets, nil
+}
+
+// walkPageSize is the number of planets WalkPlanets reads at a time
+const walkPageSize int64 = 500
+
+// WalkPlanets calls fn with each planet filtered by name, climate and terrain, ordered by ID.
+// The planets are read a page at a time, after the last ID of the previous page, so only a page
+// is held in memory and a slow fn never holds a transaction open. An error of fn or the
+// cancellation of ctx stops the walk and is returned.
+func (bs *BoltStore) WalkPlanets(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+	page, walked := arg, int64(0)
+	var after []byte
+	for {
+		page.Limit = walkPageSize
+		if arg.Limit > 0 && arg.Limit-walked < walkPageSize {
+			page.Limit = arg.Limit - walked
+		}
+		planets, err := bs.list(page, after)
+		if err != nil {
+			return fmt.Errorf("walk planets: %s", err.Error())
+		}
+
+		for _, planet := range planets {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(planet); err != nil {
+				return err
+			}
+		}
+		walked += int64(len(planets))
+		if int64(len(planets)) < page.Limit || walked == arg.Limit {
+			return nil
+		}
+		// the offset only skips planets of the first page
+		last := planets[len(planets)-1].ID
+		page.Offset, after = 0, last[:]
+	}
+}
+
+// list reads the page of arg of the planets filtered by name, climate and terrain, ordered by ID,
+// starting after the ID after when it is not nil
+func (bs *BoltStore) list(arg planetsdb.ListPlanetParams, after []byte) ([]planetsdb.Planet, error) {
+	var (
+		planets []planetsdb.Planet
+		skipped int64
+	)
+	// collect keeps a matching planet when it is in the page, returning false once the page is full
+	collect := func(planet planetsdb.Planet) bool {
+		if skipped < arg.Offset {
+			skipped++
+			return true
+		}
+		planets = append(planets, planetsdb.Project(planet, arg.Fields))
+		return arg.Limit <= 0 || int64(len(planets)) < arg.Limit
+	}
+
+	var scanErr error
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		scanErr = scanPlanets(tx, arg.Name, arg.Climate, arg.Terrain, after, collect)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New(errorsmodel.FailedToFetchRecord)
+	}
+	if scanErr != nil {
+		return nil, errors.New(errorsmodel.FailedToUnmarshalRecord)
+	}
+	return planets, nil
+}
+
+// DeletePlanets deletes the planets filtered by name, climate and terrain and their index entries,
+// returning their IDs in ascending order. At least one filter is required.
+func (bs *BoltStore) DeletePlanets(ctx context.Context, arg planetsdb.DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	if !planetsdb.HasFilter(arg) {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.MissingFilter)
+	}
+
+	var planets []planetsdb.Planet
+	update := bs.db.Update
+	if arg.DryRun {
+		update = bs.db.View
+	}
+	err := update(func(tx *bolt.Tx) error {
+		err := scanPlanets(tx, arg.Name, arg.Climate, arg.Terrain, nil, func(planet planetsdb.Planet) bool {
+			planets = append(planets, planet)
+			return true
+		})
+		if err != nil || arg.DryRun {
+			return err
+		}
+		// the planets are deleted once the scan is over, since it walks the buckets they are deleted from
+		for _, planet := range planets {
+			if err := deleteIndexes(tx, planet); err != nil {
+				return err
+			}
+			if err := tx.Bucket(planetsBucket).Delete(planet.ID[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.CouldNotDeleteItem)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(planets))
+	for _, planet := range planets {
+		ids = append(ids, planet.ID)
+	}
+	return ids, nil
+}
+
+// scanPlanets calls fn with every planet matching the non blank of name, climate and terrain, in
+// ID order and after the ID after when it is not nil, until fn returns false. A filtered scan
+// walks the index of the first filter instead of every planet.
+func scanPlanets(tx *bolt.Tx, name, climate, terrain string, after []byte, fn func(planet planetsdb.Planet) bool) error {
+	name = strings.TrimSpace(name)
+	climate = strings.TrimSpace(climate)
+	terrain = strings.TrimSpace(terrain)
+
+	var scanErr error
+	// visit decodes one stored planet and passes it to fn when it matches
+	visit := func(data []byte) bool {
+		var planet planetsdb.Planet
+		if err := json.Unmarshal(data, &planet); err != nil {
+			scanErr = err
+			return false
+		}
+		if (name != "" && planet.Name != name) ||
+			(climate != "" && planet.Climate != climate) ||
+			(terrain != "" && planet.Terrain != terrain) {
+			return true
+		}
+		return fn(planet)
+	}
+
+	planetsBkt := tx.Bucket(planetsBucket)
+	switch {
+	case name != "":
+		scanIndex(tx, nameIndexBucket, name, after, func(id []byte) bool { return visit(planetsBkt.Get(id)) })
+	case climate != "":
+		scanIndex(tx, climateIndexBucket, climate, after, func(id []byte) bool { return visit(planetsBkt.Get(id)) })
+	case terrain != "":
+		scanIndex(tx, terrainIndexBucket, terrain, after, func(id []byte) bool { return visit(planetsBkt.Get(id)) })
+	default:
+		c := planetsBkt.Cursor()
+		k, v := c.First()
+		if after != nil {
+			k, v = c.Seek(after)
+			if bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			if !visit(v) {
+				break
+			}
+		}
+	}
+	return scanErr
+}
@@ -0,0 +1,64 @@
+package boltstore
+
+import (
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/swapi"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	planetsBucket = []byte("planets")
+
+	// secondary index buckets, one per filterable field
+	nameIndexBucket    = []byte("planets_by_name")
+	climateIndexBucket = []byte("planets_by_climate")
+	terrainIndexBucket = []byte("planets_by_terrain")
+
+	apiKeysBucket     = []byte("api_keys")
+	apiKeysHashBucket = []byte("api_keys_by_hash")
+)
+
+// BoltStore is a planetsdb.Store kept in an embedded bbolt file. Every write is a
+// bbolt transaction that is fsynced on commit, so a crash never leaves a planet
+// without its index entries.
+type BoltStore struct {
+	db     *bolt.DB
+	movies planetsdb.MoviesFinder
+}
+
+// Open opens or creates the store file at path. When movies is nil the public SWAPI is used.
+func Open(path string, movies planetsdb.MoviesFinder) (*BoltStore, error) {
+	if movies == nil {
+		movies = swapi.New()
+	}
+
+	// the file is locked while open, so fail instead of hanging when another process holds it
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{planetsBucket, nameIndexBucket, climateIndexBucket, terrainIndexBucket, apiKeysBucket, apiKeysHashBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{
+		db:     db,
+		movies: movies,
+	}, nil
+}
+
+// Close releases the store file
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
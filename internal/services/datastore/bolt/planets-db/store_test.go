@@ -0,0 +1,85 @@
+package boltstore
+
+import (
+	"context"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/storetest"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+)
+
+func openTestStore(t *testing.T, path string, movies planetsdb.MoviesFinder) *BoltStore {
+	store, err := Open(path, movies)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store
+}
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store {
+		return openTestStore(t, filepath.Join(t.TempDir(), "planets.bolt"), movies)
+	})
+}
+
+func TestKeyStoreConformance(t *testing.T) {
+	storetest.RunKeys(t, func(t *testing.T) apikeys.Store {
+		return openTestStore(t, filepath.Join(t.TempDir(), "planets.bolt"), storetest.Movies).KeyStore()
+	})
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "planets.bolt")
+	store, err := Open(path, storetest.Movies)
+	require.NoError(t, err)
+
+	arg := planetsdb.CreatePlanetParams{Name: "Kamino", Terrain: "ocean", Climate: "temperate"}
+	planet, err := store.CreatePlanet(context.Background(), arg)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store = openTestStore(t, path, storetest.Movies)
+	gotPlanet, err := store.GetPlanet(context.Background(), planet.ID.Hex())
+	require.NoError(t, err)
+	require.Equal(t, planet, gotPlanet)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Terrain: "ocean"})
+	require.NoError(t, err)
+	require.Equal(t, []planetsdb.Planet{planet}, planets)
+}
+
+func TestIndexes(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "planets.bolt"), storetest.Movies)
+
+	// "ab" must not match the entries of "abc" even though it is a prefix of it
+	short, err := store.CreatePlanet(context.Background(), planetsdb.CreatePlanetParams{Name: "Utapau", Terrain: "ab", Climate: "arid"})
+	require.NoError(t, err)
+	long, err := store.CreatePlanet(context.Background(), planetsdb.CreatePlanetParams{Name: "Alderaan", Terrain: "abc", Climate: "arid"})
+	require.NoError(t, err)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Terrain: "ab"})
+	require.NoError(t, err)
+	require.Equal(t, []planetsdb.Planet{short}, planets)
+
+	requireIndexSizes(t, store, 2)
+
+	require.NoError(t, store.DeletePlanet(context.Background(), short.ID.Hex()))
+	require.NoError(t, store.DeletePlanet(context.Background(), long.ID.Hex()))
+
+	requireIndexSizes(t, store, 0)
+}
+
+// requireIndexSizes checks every index bucket holds n entries
+func requireIndexSizes(t *testing.T, store *BoltStore, n int) {
+	err := store.db.View(func(tx *bolt.Tx) error {
+		for _, idx := range indexes {
+			require.Equal(t, n, tx.Bucket(idx.bucket).Stats().KeyN, string(idx.bucket))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,111 @@
+package loggingstore
+
+import (
+	"context"
+	"github.com/gmaschi/b2w-sw-planets/internal/logging"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"time"
+)
+
+// LoggingStore decorates a planets store, logging every call at debug level
+type LoggingStore struct {
+	store  planetsdb.Store
+	logger *zap.Logger
+}
+
+// NewStore wraps store, logging with logger and the ID of the request of each call
+func NewStore(store planetsdb.Store, logger *zap.Logger) *LoggingStore {
+	return &LoggingStore{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// CreatePlanet calls the decorated store
+func (ls *LoggingStore) CreatePlanet(ctx context.Context, arg planetsdb.CreatePlanetParams) (planetsdb.Planet, error) {
+	start := time.Now()
+	planet, err := ls.store.CreatePlanet(ctx, arg)
+	ls.log(ctx, "CreatePlanet", start, err, zap.String("planet_name", arg.Name), zap.String("planet_id", planet.ID.Hex()))
+	return planet, err
+}
+
+// CreatePlanets calls the decorated store
+func (ls *LoggingStore) CreatePlanets(ctx context.Context, arg planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+	start := time.Now()
+	results, err := ls.store.CreatePlanets(ctx, arg)
+	ls.log(ctx, "CreatePlanets", start, err,
+		zap.Int("planets_count", len(arg.Planets)),
+		zap.Bool("atomic", arg.Atomic),
+		zap.Bool("failed", planetsdb.Failed(results)),
+	)
+	return results, err
+}
+
+// DeletePlanet calls the decorated store
+func (ls *LoggingStore) DeletePlanet(ctx context.Context, id string) error {
+	start := time.Now()
+	err := ls.store.DeletePlanet(ctx, id)
+	ls.log(ctx, "DeletePlanet", start, err, zap.String("planet_id", id))
+	return err
+}
+
+// DeletePlanets calls the decorated store
+func (ls *LoggingStore) DeletePlanets(ctx context.Context, arg planetsdb.DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	start := time.Now()
+	ids, err := ls.store.DeletePlanets(ctx, arg)
+	ls.log(ctx, "DeletePlanets", start, err,
+		zap.String("planet_name", arg.Name),
+		zap.String("planet_climate", arg.Climate),
+		zap.String("planet_terrain", arg.Terrain),
+		zap.Bool("dry_run", arg.DryRun),
+		zap.Int("planets_count", len(ids)),
+	)
+	return ids, err
+}
+
+// GetPlanet calls the decorated store
+func (ls *LoggingStore) GetPlanet(ctx context.Context, id string, fields ...string) (planetsdb.Planet, error) {
+	start := time.Now()
+	planet, err := ls.store.GetPlanet(ctx, id, fields...)
+	ls.log(ctx, "GetPlanet", start, err, zap.String("planet_id", id))
+	return planet, err
+}
+
+// ListPlanets calls the decorated store
+func (ls *LoggingStore) ListPlanets(ctx context.Context, arg planetsdb.ListPlanetParams) ([]planetsdb.Planet, error) {
+	start := time.Now()
+	planets, err := ls.store.ListPlanets(ctx, arg)
+	ls.log(ctx, "ListPlanets", start, err, zap.Int64("offset", arg.Offset), zap.Int64("limit", arg.Limit), zap.Int("count", len(planets)))
+	return planets, err
+}
+
+// WalkPlanets calls the decorated store, counting the planets passed to fn
+func (ls *LoggingStore) WalkPlanets(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+	start := time.Now()
+	count := 0
+	err := ls.store.WalkPlanets(ctx, arg, func(planet planetsdb.Planet) error {
+		count++
+		return fn(planet)
+	})
+	ls.log(ctx, "WalkPlanets", start, err, zap.Int64("offset", arg.Offset), zap.Int64("limit", arg.Limit), zap.Int("count", count))
+	return err
+}
+
+// CountPlanets calls the decorated store
+func (ls *LoggingStore) CountPlanets(ctx context.Context) (int64, error) {
+	start := time.Now()
+	count, err := ls.store.CountPlanets(ctx)
+	ls.log(ctx, "CountPlanets", start, err, zap.Int64("count", count))
+	return count, err
+}
+
+func (ls *LoggingStore) log(ctx context.Context, method string, start time.Time, err error, fields ...zap.Field) {
+	logger := logging.ForRequest(ctx, ls.logger)
+	fields = append(fields, zap.String("method", method), zap.Duration("latency", time.Since(start)))
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	logger.Debug("store call", fields...)
+}
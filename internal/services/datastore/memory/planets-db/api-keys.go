@@ -0,0 +1,90 @@
+package memorystore
+
+import (
+	"context"
+	"fmt"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyStore is an apikeys.Store that keeps API keys in memory. It is safe for concurrent use.
+type KeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]apikeys.Key
+	byHash map[string]string
+}
+
+// NewKeyStore creates a pointer to an empty KeyStore
+func NewKeyStore() *KeyStore {
+	return &KeyStore{
+		keys:   make(map[string]apikeys.Key),
+		byHash: make(map[string]string),
+	}
+}
+
+// CreateKey stores key
+func (ks *KeyStore) CreateKey(ctx context.Context, key apikeys.Key) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.keys[key.ID] = copyKey(key)
+	ks.byHash[key.Hash] = key.ID
+	return nil
+}
+
+// KeyByHash gets the key with hash
+func (ks *KeyStore) KeyByHash(ctx context.Context, hash string) (apikeys.Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	id, ok := ks.byHash[hash]
+	if !ok {
+		return apikeys.Key{}, fmt.Errorf("get API key: %s", errorsmodel.APIKeyDoesNotExist)
+	}
+	return copyKey(ks.keys[id]), nil
+}
+
+// ListKeys lists every key, revoked ones included, oldest first
+func (ks *KeyStore) ListKeys(ctx context.Context) ([]apikeys.Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]apikeys.Key, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, copyKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// RevokeKey revokes the key with id. Revoking a revoked key keeps its first revocation time.
+func (ks *KeyStore) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[id]
+	if !ok {
+		return fmt.Errorf("revoke API key: %s", errorsmodel.APIKeyDoesNotExist)
+	}
+	if !key.Revoked() {
+		revokedAt := at.UTC()
+		key.RevokedAt = &revokedAt
+		ks.keys[id] = key
+	}
+	return nil
+}
+
+// copyKey keeps callers from sharing the scopes and revocation time of a stored key
+func copyKey(key apikeys.Key) apikeys.Key {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	if key.RevokedAt != nil {
+		revokedAt := *key.RevokedAt
+		key.RevokedAt = &revokedAt
+	}
+	return key
+}
@@ -0,0 +1,229 @@
+package memorystore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strings"
+)
+
+// CreatePlanet creates a new planet resource with the specified arguments
+func (ms *MemoryStore) CreatePlanet(ctx context.Context, arg planetsdb.CreatePlanetParams) (planetsdb.Planet, error) {
+	movies, err := ms.movies.MovieAppearances(ctx, arg.Name)
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("create planet: %s", err.Error())
+	}
+
+	planet := planetsdb.Planet{
+		ID:        primitive.NewObjectID(),
+		Name:      arg.Name,
+		Terrain:   arg.Terrain,
+		Climate:   arg.Climate,
+		Movies:    movies,
+		CreatedBy: arg.CreatedBy,
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.names[planet.Name]; ok {
+		return planetsdb.Planet{}, fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)
+	}
+	ms.put(planet)
+
+	return planet, nil
+}
+
+// CreatePlanets creates the planets of arg whose movie appearances could be counted
+func (ms *MemoryStore) CreatePlanets(ctx context.Context, arg planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+	results := planetsdb.LookupMovies(ctx, ms.movies, arg)
+	if arg.Atomic && planetsdb.Failed(results) {
+		planetsdb.Abort(results)
+		return results, nil
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// names taken by the planets before them in the batch
+	taken := make(map[string]bool, len(results))
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		if _, ok := ms.names[results[i].Planet.Name]; ok || taken[results[i].Planet.Name] {
+			results[i].Err = fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)
+			continue
+		}
+		taken[results[i].Planet.Name] = true
+	}
+	if arg.Atomic && planetsdb.Failed(results) {
+		planetsdb.Abort(results)
+		return results, nil
+	}
+
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		results[i].Planet.ID = primitive.NewObjectID()
+		ms.put(results[i].Planet)
+	}
+	return results, nil
+}
+
+// CountPlanets counts the planets of the store
+func (ms *MemoryStore) CountPlanets(ctx context.Context) (int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return int64(len(ms.planets)), nil
+}
+
+// DeletePlanet deletes an existing planet from the store based on the id
+func (ms *MemoryStore) DeletePlanet(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("delete planet: %s", errorsmodel.InvalidID)
+	}
+
+	ms.mu.Lock()
+	planet, ok := ms.planets[objectID]
+	if ok {
+		ms.delete(planet)
+	}
+	ms.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("delete planet: %s", errorsmodel.PlanetDoesNotExist)
+	}
+	return nil
+}
+
+// GetPlanet finds a planet based on the ID, holding only its ID and fields unless fields is empty
+func (ms *MemoryStore) GetPlanet(ctx context.Context, id string, fields ...string) (planetsdb.Planet, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.InvalidID)
+	}
+
+	ms.mu.RLock()
+	planet, ok := ms.planets[objectID]
+	ms.mu.RUnlock()
+
+	if !ok {
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.PlanetDoesNotExist)
+	}
+	return planetsdb.Project(planet, fields), nil
+}
+
+// ListPlanets list planets filtered by name, climate and terrain, ordered by ID
+func (ms *MemoryStore) ListPlanets(ctx context.Context, arg planetsdb.ListPlanetParams) ([]planetsdb.Planet, error) {
+	ms.mu.RLock()
+	planets := ms.matching(arg.Name, arg.Climate, arg.Terrain)
+	ms.mu.RUnlock()
+
+	planets = paginate(planets, arg.Offset, arg.Limit)
+	if len(planets) == 0 {
+		return nil, fmt.Errorf("list planets: %s", errorsmodel.PlanetDoesNotExist)
+	}
+	for i := range planets {
+		planets[i] = planetsdb.Project(planets[i], arg.Fields)
+	}
+
+	return planets, nil
+}
+
+// WalkPlanets calls fn with each planet filtered by name, climate and terrain, ordered by ID.
+// An error of fn or the cancellation of ctx stops the walk and is returned.
+func (ms *MemoryStore) WalkPlanets(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+	ms.mu.RLock()
+	planets := ms.matching(arg.Name, arg.Climate, arg.Terrain)
+	ms.mu.RUnlock()
+
+	for _, planet := range paginate(planets, arg.Offset, arg.Limit) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(planetsdb.Project(planet, arg.Fields)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePlanets deletes the planets filtered by name, climate and terrain, returning their IDs in
+// ascending order. At least one filter is required.
+func (ms *MemoryStore) DeletePlanets(ctx context.Context, arg planetsdb.DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	if !planetsdb.HasFilter(arg) {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.MissingFilter)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	planets := ms.matching(arg.Name, arg.Climate, arg.Terrain)
+	ids := make([]primitive.ObjectID, 0, len(planets))
+	for _, planet := range planets {
+		ids = append(ids, planet.ID)
+		if !arg.DryRun {
+			ms.delete(planet)
+		}
+	}
+	return ids, nil
+}
+
+// put stores planet and indexes its name. The caller must hold the lock.
+func (ms *MemoryStore) put(planet planetsdb.Planet) {
+	ms.planets[planet.ID] = planet
+	ms.names[planet.Name] = planet.ID
+}
+
+// delete removes planet and its name. The caller must hold the lock.
+func (ms *MemoryStore) delete(planet planetsdb.Planet) {
+	delete(ms.planets, planet.ID)
+	delete(ms.names, planet.Name)
+}
+
+// matching returns the planets filtered by the non blank of name, climate and terrain, ordered
+// by ID. The caller must hold the lock.
+func (ms *MemoryStore) matching(name, climate, terrain string) []planetsdb.Planet {
+	name = strings.TrimSpace(name)
+	climate = strings.TrimSpace(climate)
+	terrain = strings.TrimSpace(terrain)
+
+	var planets []planetsdb.Planet
+	for _, planet := range ms.planets {
+		if name != "" && planet.Name != name {
+			continue
+		}
+		if climate != "" && planet.Climate != climate {
+			continue
+		}
+		if terrain != "" && planet.Terrain != terrain {
+			continue
+		}
+		planets = append(planets, planet)
+	}
+
+	sort.Slice(planets, func(i, j int) bool {
+		return bytes.Compare(planets[i].ID[:], planets[j].ID[:]) < 0
+	})
+	return planets
+}
+
+// paginate returns the window of planets selected by offset and limit
+func paginate(planets []planetsdb.Planet, offset, limit int64) []planetsdb.Planet {
+	if offset > 0 {
+		if offset >= int64(len(planets)) {
+			return nil
+		}
+		planets = planets[offset:]
+	}
+	if limit > 0 && limit < int64(len(planets)) {
+		planets = planets[:limit]
+	}
+	return planets
+}
@@ -0,0 +1,29 @@
+package memorystore
+
+import (
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/swapi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+)
+
+// MemoryStore is a planetsdb.Store that keeps planets in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	planets map[primitive.ObjectID]planetsdb.Planet
+	// names maps the unique name of each planet to its ID
+	names  map[string]primitive.ObjectID
+	movies planetsdb.MoviesFinder
+}
+
+// NewStore creates a pointer to an empty MemoryStore. When movies is nil the public SWAPI is used.
+func NewStore(movies planetsdb.MoviesFinder) *MemoryStore {
+	if movies == nil {
+		movies = swapi.New()
+	}
+	return &MemoryStore{
+		planets: make(map[primitive.ObjectID]planetsdb.Planet),
+		names:   make(map[string]primitive.ObjectID),
+		movies:  movies,
+	}
+}
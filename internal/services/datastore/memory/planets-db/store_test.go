@@ -0,0 +1,20 @@
+package memorystore
+
+import (
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/storetest"
+	"testing"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store {
+		return NewStore(movies)
+	})
+}
+
+func TestKeyStoreConformance(t *testing.T) {
+	storetest.RunKeys(t, func(t *testing.T) apikeys.Store {
+		return NewKeyStore()
+	})
+}
@@ -0,0 +1,148 @@
+package metricsstore
+
+import (
+	"context"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// countTimeout bounds the query behind the planet count gauge on each scrape
+const countTimeout = 5 * time.Second
+
+type (
+	// MetricsStore decorates a planets store, observing the latency and errors of every method
+	MetricsStore struct {
+		store    planetsdb.Store
+		duration *prometheus.HistogramVec
+		errors   *prometheus.CounterVec
+	}
+
+	// planetsCollector reports the number of stored planets when scraped
+	planetsCollector struct {
+		store planetsdb.Store
+		desc  *prometheus.Desc
+	}
+)
+
+// NewStore wraps store and registers its metrics, including a gauge with the planet count.
+// The count is queried on each scrape and left out when the store cannot count without a
+// request scope, such as a tenant.
+func NewStore(store planetsdb.Store, registerer prometheus.Registerer) *MetricsStore {
+	ms := &MetricsStore{
+		store: store,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "planets_store_duration_seconds",
+			Help:    "Latency of the planets store methods.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "planets_store_errors_total",
+			Help: "Planets store calls that failed, not counting planets that do not exist.",
+		}, []string{"method"}),
+	}
+	collector := &planetsCollector{
+		store: store,
+		desc:  prometheus.NewDesc("planets_stored", "Number of stored planets.", nil, nil),
+	}
+	registerer.MustRegister(ms.duration, ms.errors, collector)
+	return ms
+}
+
+// CreatePlanet calls the decorated store
+func (ms *MetricsStore) CreatePlanet(ctx context.Context, arg planetsdb.CreatePlanetParams) (planetsdb.Planet, error) {
+	defer ms.observe("CreatePlanet", time.Now())
+	planet, err := ms.store.CreatePlanet(ctx, arg)
+	ms.count("CreatePlanet", err)
+	return planet, err
+}
+
+// CreatePlanets calls the decorated store
+func (ms *MetricsStore) CreatePlanets(ctx context.Context, arg planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+	defer ms.observe("CreatePlanets", time.Now())
+	results, err := ms.store.CreatePlanets(ctx, arg)
+	ms.count("CreatePlanets", err)
+	return results, err
+}
+
+// DeletePlanet calls the decorated store
+func (ms *MetricsStore) DeletePlanet(ctx context.Context, id string) error {
+	defer ms.observe("DeletePlanet", time.Now())
+	err := ms.store.DeletePlanet(ctx, id)
+	ms.count("DeletePlanet", err)
+	return err
+}
+
+// DeletePlanets calls the decorated store
+func (ms *MetricsStore) DeletePlanets(ctx context.Context, arg planetsdb.DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	defer ms.observe("DeletePlanets", time.Now())
+	ids, err := ms.store.DeletePlanets(ctx, arg)
+	ms.count("DeletePlanets", err)
+	return ids, err
+}
+
+// GetPlanet calls the decorated store
+func (ms *MetricsStore) GetPlanet(ctx context.Context, id string, fields ...string) (planetsdb.Planet, error) {
+	defer ms.observe("GetPlanet", time.Now())
+	planet, err := ms.store.GetPlanet(ctx, id, fields...)
+	ms.count("GetPlanet", err)
+	return planet, err
+}
+
+// ListPlanets calls the decorated store
+func (ms *MetricsStore) ListPlanets(ctx context.Context, arg planetsdb.ListPlanetParams) ([]planetsdb.Planet, error) {
+	defer ms.observe("ListPlanets", time.Now())
+	planets, err := ms.store.ListPlanets(ctx, arg)
+	ms.count("ListPlanets", err)
+	return planets, err
+}
+
+// WalkPlanets calls the decorated store, the observed latency includes the calls to fn
+func (ms *MetricsStore) WalkPlanets(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+	defer ms.observe("WalkPlanets", time.Now())
+	err := ms.store.WalkPlanets(ctx, arg, fn)
+	ms.count("WalkPlanets", err)
+	return err
+}
+
+// CountPlanets calls the decorated store
+func (ms *MetricsStore) CountPlanets(ctx context.Context) (int64, error) {
+	defer ms.observe("CountPlanets", time.Now())
+	count, err := ms.store.CountPlanets(ctx)
+	ms.count("CountPlanets", err)
+	return count, err
+}
+
+func (ms *MetricsStore) observe(method string, start time.Time) {
+	ms.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func (ms *MetricsStore) count(method string, err error) {
+	if err != nil && !notFound(err) {
+		ms.errors.WithLabelValues(method).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector
+func (pc *planetsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pc.desc
+}
+
+// Collect implements prometheus.Collector
+func (pc *planetsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+
+	count, err := pc.store.CountPlanets(ctx)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(pc.desc, prometheus.GaugeValue, float64(count))
+}
+
+func notFound(err error) bool {
+	return strings.HasSuffix(err.Error(), errorsmodel.PlanetDoesNotExist)
+}
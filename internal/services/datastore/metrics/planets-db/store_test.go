@@ -0,0 +1,70 @@
+package metricsstore
+
+import (
+	"context"
+	"errors"
+	memorystore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/memory/planets-db"
+	mockedstore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mocks/mongodb/planets-db"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/storetest"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store {
+		return NewStore(memorystore.NewStore(movies), prometheus.NewRegistry())
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	store := NewStore(memorystore.NewStore(storetest.Movies), registry)
+	ctx := context.Background()
+
+	_, err := store.CreatePlanet(ctx, planetsdb.CreatePlanetParams{Name: "Tatooine", Climate: "arid", Terrain: "desert"})
+	require.NoError(t, err)
+	_, err = store.CreatePlanet(ctx, planetsdb.CreatePlanetParams{Name: "Kamino", Climate: "temperate", Terrain: "ocean"})
+	require.NoError(t, err)
+	_, err = store.CreatePlanet(ctx, planetsdb.CreatePlanetParams{Name: "Nowhere", Climate: "arid", Terrain: "desert"})
+	require.Error(t, err)
+	_, err = store.GetPlanet(ctx, "61f1a1b2c3d4e5f6a7b8c9d0")
+	require.Error(t, err)
+
+	expected := `
+# HELP planets_store_errors_total Planets store calls that failed, not counting planets that do not exist.
+# TYPE planets_store_errors_total counter
+planets_store_errors_total{method="CreatePlanet"} 1
+# HELP planets_stored Number of stored planets.
+# TYPE planets_stored gauge
+planets_stored 2
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "planets_store_errors_total", "planets_stored"))
+	require.Equal(t, 2, testutil.CollectAndCount(store.duration))
+}
+
+func TestPlanetsGaugeCounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := mockedstore.NewMockStore(ctrl)
+	registry := prometheus.NewRegistry()
+	NewStore(store, registry)
+
+	// the gauge counts the planets instead of listing them
+	store.EXPECT().CountPlanets(gomock.Any()).Times(1).Return(int64(1200), nil)
+	expected := `
+# HELP planets_stored Number of stored planets.
+# TYPE planets_stored gauge
+planets_stored 1200
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "planets_stored"))
+
+	// the gauge is left out when the store cannot count
+	store.EXPECT().CountPlanets(gomock.Any()).Times(1).Return(int64(0), errors.New("count planets: missing tenant ID"))
+	count, err := testutil.GatherAndCount(registry, "planets_stored")
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
@@ -10,6 +10,7 @@ import (
 
 	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
 	gomock "github.com/golang/mock/gomock"
+	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // MockStore is a mock of Store interface.
@@ -35,6 +36,21 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// CountPlanets mocks base method.
+func (m *MockStore) CountPlanets(arg0 context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPlanets", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountPlanets indicates an expected call of CountPlanets.
+func (mr *MockStoreMockRecorder) CountPlanets(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPlanets", reflect.TypeOf((*MockStore)(nil).CountPlanets), arg0)
+}
+
 // CreatePlanet mocks base method.
 func (m *MockStore) CreatePlanet(arg0 context.Context, arg1 planetsdb.CreatePlanetParams) (planetsdb.Planet, error) {
 	m.ctrl.T.Helper()
@@ -50,6 +66,21 @@ func (mr *MockStoreMockRecorder) CreatePlanet(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePlanet", reflect.TypeOf((*MockStore)(nil).CreatePlanet), arg0, arg1)
 }
 
+// CreatePlanets mocks base method.
+func (m *MockStore) CreatePlanets(arg0 context.Context, arg1 planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePlanets", arg0, arg1)
+	ret0, _ := ret[0].([]planetsdb.CreatePlanetResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePlanets indicates an expected call of CreatePlanets.
+func (mr *MockStoreMockRecorder) CreatePlanets(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePlanets", reflect.TypeOf((*MockStore)(nil).CreatePlanets), arg0, arg1)
+}
+
 // DeletePlanet mocks base method.
 func (m *MockStore) DeletePlanet(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -64,19 +95,39 @@ func (mr *MockStoreMockRecorder) DeletePlanet(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePlanet", reflect.TypeOf((*MockStore)(nil).DeletePlanet), arg0, arg1)
 }
 
+// DeletePlanets mocks base method.
+func (m *MockStore) DeletePlanets(arg0 context.Context, arg1 planetsdb.DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePlanets", arg0, arg1)
+	ret0, _ := ret[0].([]primitive.ObjectID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePlanets indicates an expected call of DeletePlanets.
+func (mr *MockStoreMockRecorder) DeletePlanets(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePlanets", reflect.TypeOf((*MockStore)(nil).DeletePlanets), arg0, arg1)
+}
+
 // GetPlanet mocks base method.
-func (m *MockStore) GetPlanet(arg0 context.Context, arg1 string) (planetsdb.Planet, error) {
+func (m *MockStore) GetPlanet(arg0 context.Context, arg1 string, arg2 ...string) (planetsdb.Planet, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPlanet", arg0, arg1)
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetPlanet", varargs...)
 	ret0, _ := ret[0].(planetsdb.Planet)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPlanet indicates an expected call of GetPlanet.
-func (mr *MockStoreMockRecorder) GetPlanet(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetPlanet(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPlanet", reflect.TypeOf((*MockStore)(nil).GetPlanet), arg0, arg1)
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPlanet", reflect.TypeOf((*MockStore)(nil).GetPlanet), varargs...)
 }
 
 // ListPlanets mocks base method.
@@ -93,3 +144,17 @@ func (mr *MockStoreMockRecorder) ListPlanets(arg0, arg1 interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPlanets", reflect.TypeOf((*MockStore)(nil).ListPlanets), arg0, arg1)
 }
+
+// WalkPlanets mocks base method.
+func (m *MockStore) WalkPlanets(arg0 context.Context, arg1 planetsdb.ListPlanetParams, arg2 func(planetsdb.Planet) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WalkPlanets", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WalkPlanets indicates an expected call of WalkPlanets.
+func (mr *MockStoreMockRecorder) WalkPlanets(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WalkPlanets", reflect.TypeOf((*MockStore)(nil).WalkPlanets), arg0, arg1, arg2)
+}
@@ -0,0 +1,197 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+)
+
+// namespaceNotFound is the server error code for a command on a missing collection
+const namespaceNotFound = 26
+
+type (
+	// Migration is one versioned change to the planets schema. Up must be idempotent,
+	// a crash between applying it and recording it makes the next run apply it again.
+	Migration struct {
+		Version     int
+		Description string
+		Up          func(ctx context.Context, db *mongo.Database, cfg Config) error
+	}
+
+	// Config describes the planets collection being migrated
+	Config struct {
+		Collection string
+		// TenantScoped is set when tenants share the collection, scoping unique indexes by tenant
+		TenantScoped bool
+	}
+)
+
+// Planets is the ordered schema history of the planets collection. Applied migrations
+// must never be edited, add a new one instead.
+var Planets = []Migration{
+	{
+		Version:     1,
+		Description: "create planets indexes",
+		Up:          createPlanetsIndexes,
+	},
+	{
+		Version:     2,
+		Description: "validate planets documents",
+		Up:          validatePlanets,
+	},
+	{
+		Version:     3,
+		Description: "create api keys indexes",
+		Up:          createAPIKeysIndexes,
+	},
+	{
+		Version:     4,
+		Description: "expire rate limit buckets",
+		Up:          expireRateLimits,
+	},
+	{
+		Version:     5,
+		Description: "expire idempotency keys",
+		Up:          expireIdempotencyKeys,
+	},
+}
+
+// createPlanetsIndexes indexes unique names, text search on names and the list filters. It
+// refuses to run while planets share a name, since the unique index could not be built.
+func createPlanetsIndexes(ctx context.Context, db *mongo.Database, cfg Config) error {
+	uniqueName := bson.D{{Key: "name", Value: 1}}
+	if cfg.TenantScoped {
+		uniqueName = bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}}
+	}
+
+	duplicates, err := duplicateNames(ctx, db.Collection(cfg.Collection), uniqueName)
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("planets share the names %s, rename or delete the duplicates and start again", strings.Join(duplicates, ", "))
+	}
+
+	_, err = db.Collection(cfg.Collection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    uniqueName,
+			Options: options.Index().SetName("name_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "name", Value: "text"}},
+			Options: options.Index().SetName("name_text"),
+		},
+		{
+			Keys:    bson.D{{Key: "climate", Value: 1}},
+			Options: options.Index().SetName("climate"),
+		},
+		{
+			Keys:    bson.D{{Key: "terrain", Value: 1}},
+			Options: options.Index().SetName("terrain"),
+		},
+	})
+	return err
+}
+
+// duplicateNames lists the names shared by planets, grouped by the fields of the unique name
+// index, so that the tenant of each name is also reported when the collection is shared
+func duplicateNames(ctx context.Context, collection *mongo.Collection, keys bson.D) ([]string, error) {
+	group := bson.D{}
+	for _, key := range keys {
+		group = append(group, bson.E{Key: key.Key, Value: "$" + key.Key})
+	}
+	cur, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: group},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var duplicates []string
+	for cur.Next(ctx) {
+		var result struct {
+			ID struct {
+				TenantID string `bson:"tenant_id"`
+				Name     string `bson:"name"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cur.Decode(&result); err != nil {
+			return nil, err
+		}
+		duplicate := fmt.Sprintf("%q (%d planets)", result.ID.Name, result.Count)
+		if result.ID.TenantID != "" {
+			duplicate = fmt.Sprintf("%q of tenant %q (%d planets)", result.ID.Name, result.ID.TenantID, result.Count)
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+	return duplicates, cur.Err()
+}
+
+// createAPIKeysIndexes indexes the hash every request looks its API key up by
+func createAPIKeysIndexes(ctx context.Context, db *mongo.Database, cfg Config) error {
+	_, err := db.Collection(planetsdb.APIKeysCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetName("hash_unique").SetUnique(true),
+	})
+	return err
+}
+
+// expireRateLimits removes the rate limit buckets once they are full again
+func expireRateLimits(ctx context.Context, db *mongo.Database, cfg Config) error {
+	_, err := db.Collection(planetsdb.RateLimitsCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// expireIdempotencyKeys removes the idempotency keys once their responses are no longer replayed
+func expireIdempotencyKeys(ctx context.Context, db *mongo.Database, cfg Config) error {
+	_, err := db.Collection(planetsdb.IdempotencyKeysCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// planetsSchema is the $jsonSchema every planet document must match
+var planetsSchema = bson.M{
+	"bsonType": "object",
+	"required": bson.A{"name", "terrain", "climate", "movies"},
+	"properties": bson.M{
+		"name":      bson.M{"bsonType": "string", "minLength": 1},
+		"terrain":   bson.M{"bsonType": "string", "minLength": 1},
+		"climate":   bson.M{"bsonType": "string", "minLength": 1},
+		"movies":    bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+		"tenant_id": bson.M{"bsonType": "string"},
+	},
+}
+
+// validatePlanets applies planetsSchema to the planets collection, creating it when missing
+func validatePlanets(ctx context.Context, db *mongo.Database, cfg Config) error {
+	validator := bson.M{"$jsonSchema": planetsSchema}
+
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: cfg.Collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "strict"},
+	}).Err()
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.HasErrorCode(namespaceNotFound) {
+		return db.CreateCollection(ctx, cfg.Collection, options.CreateCollection().SetValidator(validator))
+	}
+	return err
+}
@@ -0,0 +1,198 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"time"
+)
+
+const (
+	// MigrationsCollectionName records the applied migrations of a database
+	MigrationsCollectionName = "schema_migrations"
+	lockCollectionName       = "schema_migrations_lock"
+	lockID                   = "planets"
+
+	defaultLease     = time.Minute
+	defaultRetryWait = 500 * time.Millisecond
+)
+
+type (
+	// Migrator applies pending migrations to one database. Replicas starting together
+	// take turns through a lease in the schema_migrations_lock collection.
+	Migrator struct {
+		db         *mongo.Database
+		cfg        Config
+		migrations []Migration
+		owner      string
+		lease      time.Duration
+		retryWait  time.Duration
+	}
+
+	appliedMigration struct {
+		Version     int       `bson:"_id"`
+		Description string    `bson:"description"`
+		AppliedAt   time.Time `bson:"applied_at"`
+	}
+)
+
+// New creates a pointer to a Migrator that applies the Planets migrations to db
+func New(db *mongo.Database, cfg Config) *Migrator {
+	return &Migrator{
+		db:         db,
+		cfg:        cfg,
+		migrations: Planets,
+		owner:      primitive.NewObjectID().Hex(),
+		lease:      defaultLease,
+		retryWait:  defaultRetryWait,
+	}
+}
+
+// errLeaseLost stops a run whose lease expired, since another replica may be migrating
+var errLeaseLost = errors.New("the migration lease expired while migrating")
+
+// Run applies the pending migrations in version order and returns the versions it applied.
+// It waits for a migration run of another replica to finish, or for ctx to be done. The lease
+// is renewed while the migrations run, so a slow one does not let another replica in.
+func (m *Migrator) Run(ctx context.Context) ([]int, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, fmt.Errorf("migrate %s: %s", m.db.Name(), err.Error())
+	}
+	defer m.unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := make(chan struct{})
+	go m.renew(ctx, cancel, lost)
+	versions, err := m.run(ctx)
+	select {
+	case <-lost:
+		return versions, fmt.Errorf("migrate %s: %s", m.db.Name(), errLeaseLost.Error())
+	default:
+		return versions, err
+	}
+}
+
+// run applies the pending migrations while the lease is held
+func (m *Migrator) run(ctx context.Context) ([]int, error) {
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate %s: %s", m.db.Name(), err.Error())
+	}
+
+	var versions []int
+	for _, migration := range m.migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		if err := migration.Up(ctx, m.db, m.cfg); err != nil {
+			return versions, fmt.Errorf("migrate %s: version %d: %s", m.db.Name(), migration.Version, err.Error())
+		}
+		record := appliedMigration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+		}
+		if _, err := m.db.Collection(MigrationsCollectionName).InsertOne(ctx, record); err != nil {
+			return versions, fmt.Errorf("migrate %s: version %d: %s", m.db.Name(), migration.Version, err.Error())
+		}
+		versions = append(versions, migration.Version)
+	}
+	return versions, nil
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context) (map[int]bool, error) {
+	cur, err := m.db.Collection(MigrationsCollectionName).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	applied := make(map[int]bool)
+	for cur.Next(ctx) {
+		var record appliedMigration
+		if err := cur.Decode(&record); err != nil {
+			return nil, err
+		}
+		applied[record.Version] = true
+	}
+	return applied, cur.Err()
+}
+
+// lock takes the migration lease, waiting while another owner holds an unexpired one
+func (m *Migrator) lock(ctx context.Context) error {
+	locks := m.db.Collection(lockCollectionName)
+	for {
+		now := time.Now().UTC()
+		// the filter only matches an expired lease, so while another owner holds the lease
+		// the upsert tries to insert a second lock document and fails with a duplicate key
+		filter := bson.D{
+			{Key: "_id", Value: lockID},
+			{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}},
+		}
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "owner", Value: m.owner},
+			{Key: "expires_at", Value: now.Add(m.lease)},
+		}}}
+		_, err := locks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.retryWait):
+		}
+	}
+}
+
+// renew extends the lease every third of it until ctx is done. When the lease is no longer
+// owned it closes lost and cancels the run.
+func (m *Migrator) renew(ctx context.Context, cancel context.CancelFunc, lost chan<- struct{}) {
+	ticker := time.NewTicker(m.lease / 3)
+	defer ticker.Stop()
+	filter := bson.D{{Key: "_id", Value: lockID}, {Key: "owner", Value: m.owner}}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "expires_at", Value: time.Now().UTC().Add(m.lease)}}}}
+		result, err := m.db.Collection(lockCollectionName).UpdateOne(ctx, filter, update)
+		if err != nil {
+			// the next tick tries again while the lease has not expired
+			continue
+		}
+		if result.MatchedCount == 0 {
+			close(lost)
+			cancel()
+			return
+		}
+	}
+}
+
+// unlock releases the lease if this migrator still owns it
+func (m *Migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.D{{Key: "_id", Value: lockID}, {Key: "owner", Value: m.owner}}
+	m.db.Collection(lockCollectionName).DeleteOne(ctx, filter)
+}
+
+// TenantDatabases lists the existing per-tenant databases named after the base database
+func TenantDatabases(ctx context.Context, client *mongo.Client, base string) ([]string, error) {
+	pattern := "^" + regexp.QuoteMeta(base) + "-[A-Za-z0-9_-]+$"
+	filter := bson.D{{Key: "name", Value: primitive.Regex{Pattern: pattern}}}
+	return client.ListDatabaseNames(ctx, filter)
+}
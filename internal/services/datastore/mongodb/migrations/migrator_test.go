@@ -0,0 +1,190 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/storetest"
+	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"testing"
+	"time"
+)
+
+const mongoURI = "mongodb://localhost:27017"
+
+// newTestDatabase returns a fresh database that is dropped when the test ends
+func newTestDatabase(t *testing.T) (*mongo.Client, *mongo.Database) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(mongoURI))
+	require.NoError(t, err)
+	db := client.Database("star-wars-migrations-" + random.String(6))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return client, db
+}
+
+func allVersions() []int {
+	versions := make([]int, 0, len(Planets))
+	for _, migration := range Planets {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func TestRunIsIdempotent(t *testing.T) {
+	_, db := newTestDatabase(t)
+	cfg := Config{Collection: planetsdb.DefaultPlanetsCollectionName}
+
+	applied, err := New(db, cfg).Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, allVersions(), applied)
+
+	applied, err = New(db, cfg).Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	count, err := db.Collection(MigrationsCollectionName).CountDocuments(context.Background(), bson.D{})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(Planets)), count)
+}
+
+func TestConcurrentRuns(t *testing.T) {
+	_, db := newTestDatabase(t)
+	cfg := Config{Collection: planetsdb.DefaultPlanetsCollectionName}
+	n := 5
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		applied []int
+		errs    []error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrator := New(db, cfg)
+			migrator.retryWait = 10 * time.Millisecond
+			versions, err := migrator.Run(context.Background())
+			mu.Lock()
+			defer mu.Unlock()
+			applied = append(applied, versions...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Empty(t, errs)
+	// every migration ran exactly once across all the replicas
+	require.ElementsMatch(t, allVersions(), applied)
+}
+
+func TestLockWaitsForContext(t *testing.T) {
+	_, db := newTestDatabase(t)
+	cfg := Config{Collection: planetsdb.DefaultPlanetsCollectionName}
+
+	holder := New(db, cfg)
+	require.NoError(t, holder.lock(context.Background()))
+	defer holder.unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	waiter := New(db, cfg)
+	waiter.retryWait = 10 * time.Millisecond
+	_, err := waiter.Run(ctx)
+	require.Error(t, err)
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	_, db := newTestDatabase(t)
+	cfg := Config{Collection: planetsdb.DefaultPlanetsCollectionName}
+
+	// a migration running for several leases
+	started := make(chan struct{})
+	slow := New(db, cfg)
+	slow.lease = 150 * time.Millisecond
+	slow.migrations = []Migration{{Version: 1, Description: "slow", Up: func(ctx context.Context, db *mongo.Database, cfg Config) error {
+		close(started)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(600 * time.Millisecond):
+			return nil
+		}
+	}}}
+	done := make(chan error, 1)
+	go func() {
+		_, err := slow.Run(context.Background())
+		done <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	waiter := New(db, cfg)
+	waiter.retryWait = 10 * time.Millisecond
+	require.ErrorIs(t, waiter.lock(ctx), context.DeadlineExceeded)
+
+	require.NoError(t, <-done)
+}
+
+func TestLeaseLost(t *testing.T) {
+	_, db := newTestDatabase(t)
+	cfg := Config{Collection: planetsdb.DefaultPlanetsCollectionName}
+
+	migrator := New(db, cfg)
+	migrator.lease = 150 * time.Millisecond
+	migrator.migrations = []Migration{{Version: 1, Description: "slow", Up: func(ctx context.Context, db *mongo.Database, cfg Config) error {
+		// another replica takes over the lease
+		_, err := db.Collection(lockCollectionName).UpdateOne(ctx, bson.D{{Key: "_id", Value: lockID}}, bson.D{{Key: "$set", Value: bson.D{{Key: "owner", Value: "other"}}}})
+		if err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}}}
+
+	applied, err := migrator.Run(context.Background())
+	require.Empty(t, applied)
+	require.EqualError(t, err, fmt.Sprintf("migrate %s: %s", db.Name(), errLeaseLost.Error()))
+}
+
+func TestUniqueNames(t *testing.T) {
+	client, db := newTestDatabase(t)
+	_, err := New(db, Config{Collection: planetsdb.DefaultPlanetsCollectionName}).Run(context.Background())
+	require.NoError(t, err)
+
+	store := planetsdb.NewStore(client, planetsdb.WithDatabase(db.Name()), planetsdb.WithMoviesFinder(storetest.Movies))
+	arg := planetsdb.CreatePlanetParams{Name: "Tatooine", Terrain: "desert", Climate: "arid"}
+
+	_, err = store.CreatePlanet(context.Background(), arg)
+	require.NoError(t, err)
+
+	_, err = store.CreatePlanet(context.Background(), arg)
+	require.EqualError(t, err, fmt.Sprintf("create planet: %s", errorsmodel.PlanetAlreadyExists))
+}
+
+func TestDuplicateNames(t *testing.T) {
+	_, db := newTestDatabase(t)
+	planets := db.Collection(planetsdb.DefaultPlanetsCollectionName)
+	_, err := planets.InsertMany(context.Background(), []interface{}{
+		bson.D{{Key: "name", Value: "Tatooine"}},
+		bson.D{{Key: "name", Value: "Kamino"}},
+		bson.D{{Key: "name", Value: "Tatooine"}},
+	})
+	require.NoError(t, err)
+
+	applied, err := New(db, Config{Collection: planetsdb.DefaultPlanetsCollectionName}).Run(context.Background())
+	require.Empty(t, applied)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `version 1: planets share the names "Tatooine" (2 planets)`)
+}
@@ -0,0 +1,88 @@
+package planetsdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const APIKeysCollectionName = "api_keys"
+
+// MongoDBKeyStore is an apikeys.Store kept in the api_keys collection
+type MongoDBKeyStore struct {
+	collection *mongo.Collection
+}
+
+// KeyStore returns the API keys stored in the planets database. The keys are shared by every
+// tenant, so with DatabasePerTenant they live in the database named by WithDatabase.
+func (ms *MongoDBStore) KeyStore() *MongoDBKeyStore {
+	return &MongoDBKeyStore{
+		collection: ms.mongodbClient.Database(ms.databaseName).Collection(APIKeysCollectionName),
+	}
+}
+
+// CreateKey stores key
+func (ks *MongoDBKeyStore) CreateKey(ctx context.Context, key apikeys.Key) error {
+	if _, err := ks.collection.InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("create API key: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return nil
+}
+
+// KeyByHash gets the key with hash
+func (ks *MongoDBKeyStore) KeyByHash(ctx context.Context, hash string) (apikeys.Key, error) {
+	var key apikeys.Key
+	err := ks.collection.FindOne(ctx, bson.D{{Key: "hash", Value: hash}}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return apikeys.Key{}, fmt.Errorf("get API key: %s", errorsmodel.APIKeyDoesNotExist)
+		}
+		return apikeys.Key{}, fmt.Errorf("get API key: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return key, nil
+}
+
+// ListKeys lists every key, revoked ones included, oldest first
+func (ks *MongoDBKeyStore) ListKeys(ctx context.Context) ([]apikeys.Key, error) {
+	cursor, err := ks.collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %s", errorsmodel.FailedToFetchRecord)
+	}
+
+	keys := []apikeys.Key{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("list API keys: %s", errorsmodel.FailedToUnmarshalRecord)
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes the key with id. Revoking a revoked key keeps its first revocation time.
+func (ks *MongoDBKeyStore) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "revoked_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: at.UTC()}}}}
+
+	res, err := ks.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("revoke API key: %s", errorsmodel.FailedToInsertRecord)
+	}
+	if res.MatchedCount == 1 {
+		return nil
+	}
+
+	n, err := ks.collection.CountDocuments(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("revoke API key: %s", errorsmodel.FailedToFetchRecord)
+	}
+	if n == 0 {
+		return fmt.Errorf("revoke API key: %s", errorsmodel.APIKeyDoesNotExist)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package planetsdb
+
+import (
+	"context"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+)
+
+// MaxConcurrentLookups bounds the SWAPI lookups of a batch running at once
+const MaxConcurrentLookups = 8
+
+type (
+	CreatePlanetsParams struct {
+		Planets []CreatePlanetParams `json:"planets"`
+		// Atomic creates either every planet of the batch or none of them
+		Atomic bool `json:"atomic"`
+		// SkipLookup keeps the movies of each planet instead of asking SWAPI
+		SkipLookup bool `json:"skip_lookup"`
+	}
+
+	// CreatePlanetResult is the outcome of creating one planet of a batch, Err is nil when the
+	// planet was created
+	CreatePlanetResult struct {
+		Planet Planet
+		Err    error
+	}
+)
+
+// LookupMovies counts the movie appearances of the planets of arg with movies, running at most
+// MaxConcurrentLookups lookups at once, unless arg skips the lookup. The results hold the planets
+// to create, without an ID, or the error of their lookup.
+func LookupMovies(ctx context.Context, movies MoviesFinder, arg CreatePlanetsParams) []CreatePlanetResult {
+	results := make([]CreatePlanetResult, len(arg.Planets))
+	sem := make(chan struct{}, MaxConcurrentLookups)
+	var wg sync.WaitGroup
+	for i, planet := range arg.Planets {
+		results[i].Planet = Planet{
+			Name:      planet.Name,
+			Terrain:   planet.Terrain,
+			Climate:   planet.Climate,
+			Movies:    planet.Movies,
+			CreatedBy: planet.CreatedBy,
+		}
+		if arg.SkipLookup {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result *CreatePlanetResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			movies, err := movies.MovieAppearances(ctx, result.Planet.Name)
+			if err != nil {
+				result.Err = fmt.Errorf("create planet: %s", err.Error())
+				return
+			}
+			result.Planet.Movies = movies
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// Failed reports whether a planet of results was not created
+func Failed(results []CreatePlanetResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Abort undoes an atomic batch that failed: the planets of results that did not fail are marked
+// as not created because of the others
+func Abort(results []CreatePlanetResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Planet.ID = primitive.NilObjectID
+			results[i].Err = fmt.Errorf("create planet: %s", errorsmodel.BatchAborted)
+		}
+	}
+}
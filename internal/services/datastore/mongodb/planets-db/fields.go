@@ -0,0 +1,64 @@
+package planetsdb
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Fields are the fields of a planet that can be selected, by their bson and json name
+var Fields = []string{"_id", "name", "terrain", "climate", "movies", "created_by"}
+
+// IsField reports whether name is one of Fields
+func IsField(name string) bool {
+	for _, field := range Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Project returns planet holding only its ID and fields, the whole planet when fields is empty.
+// It is the projection of the stores that cannot push it down.
+func Project(planet Planet, fields []string) Planet {
+	if len(fields) == 0 {
+		return planet
+	}
+
+	projected := Planet{ID: planet.ID}
+	for _, field := range fields {
+		switch field {
+		case "name":
+			projected.Name = planet.Name
+		case "terrain":
+			projected.Terrain = planet.Terrain
+		case "climate":
+			projected.Climate = planet.Climate
+		case "movies":
+			projected.Movies = planet.Movies
+		case "created_by":
+			projected.CreatedBy = planet.CreatedBy
+		}
+	}
+	return projected
+}
+
+// projection is the Mongo projection of fields, nil when fields is empty. _id is returned by
+// Mongo unless it is excluded.
+func projection(fields []string) bson.D {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	projection := bson.D{}
+	for _, field := range fields {
+		if field == "_id" || !IsField(field) {
+			continue
+		}
+		projection = append(projection, bson.E{Key: field, Value: 1})
+	}
+	if len(projection) == 0 {
+		// an empty projection returns every field
+		projection = append(projection, bson.E{Key: "_id", Value: 1})
+	}
+	return projection
+}
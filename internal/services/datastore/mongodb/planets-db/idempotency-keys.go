@@ -0,0 +1,90 @@
+package planetsdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+const IdempotencyKeysCollectionName = "idempotency_keys"
+
+// MongoDBIdempotencyStore is an idempotency.Store kept in the idempotency_keys collection,
+// shared by every replica
+type MongoDBIdempotencyStore struct {
+	collection *mongo.Collection
+}
+
+// IdempotencyStore returns the idempotency records stored in the planets database. With
+// DatabasePerTenant they live in the database named by WithDatabase.
+func (ms *MongoDBStore) IdempotencyStore() *MongoDBIdempotencyStore {
+	return &MongoDBIdempotencyStore{
+		collection: ms.mongodbClient.Database(ms.databaseName).Collection(IdempotencyKeysCollectionName),
+	}
+}
+
+// Reserve inserts record unless an unexpired record with its ID exists
+func (is *MongoDBIdempotencyStore) Reserve(ctx context.Context, record idempotency.Record, now time.Time) (idempotency.Record, bool, error) {
+	// the TTL monitor removes expired records about once a minute, an expired record still
+	// there is replaced, the expiry guarding against replacing a record reserved meanwhile
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := is.collection.InsertOne(ctx, record)
+		if err == nil {
+			return record, true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return idempotency.Record{}, false, fmt.Errorf("reserve idempotency key: %s", errorsmodel.FailedToInsertRecord)
+		}
+
+		var existing idempotency.Record
+		err = is.collection.FindOne(ctx, bson.D{{Key: "_id", Value: record.ID}}).Decode(&existing)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return idempotency.Record{}, false, fmt.Errorf("reserve idempotency key: %s", errorsmodel.FailedToFetchRecord)
+		}
+		if now.Before(existing.ExpiresAt) {
+			return existing, false, nil
+		}
+		_, err = is.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: record.ID}, {Key: "expires_at", Value: existing.ExpiresAt}})
+		if err != nil {
+			return idempotency.Record{}, false, fmt.Errorf("reserve idempotency key: %s", errorsmodel.CouldNotDeleteItem)
+		}
+	}
+	return idempotency.Record{}, false, fmt.Errorf("reserve idempotency key: %s", errorsmodel.FailedToInsertRecord)
+}
+
+// Complete stores the response of the record with id reserved by owner
+func (is *MongoDBIdempotencyStore) Complete(ctx context.Context, id, owner string, status int, contentType string, body []byte, expiresAt time.Time) error {
+	res, err := is.collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "owner", Value: owner}}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "completed", Value: true},
+		{Key: "status", Value: status},
+		{Key: "content_type", Value: contentType},
+		{Key: "body", Value: body},
+		{Key: "expires_at", Value: expiresAt},
+	}}})
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %s", errorsmodel.FailedToInsertRecord)
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("complete idempotency key: %s", errorsmodel.IdempotencyKeyExpired)
+	}
+	return nil
+}
+
+// Release deletes the record with id reserved by owner
+func (is *MongoDBIdempotencyStore) Release(ctx context.Context, id, owner string) error {
+	res, err := is.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "owner", Value: owner}})
+	if err != nil {
+		return fmt.Errorf("release idempotency key: %s", errorsmodel.CouldNotDeleteItem)
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("release idempotency key: %s", errorsmodel.IdempotencyKeyExpired)
+	}
+	return nil
+}
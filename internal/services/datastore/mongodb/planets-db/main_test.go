@@ -11,6 +11,8 @@ import (
 
 const (
 	mongoURI = "mongodb://localhost:27017"
+	// testDatabaseName keeps test data away from the database the server uses
+	testDatabaseName = "star-wars-test"
 )
 
 var testStore MongoDBStore
@@ -21,6 +23,6 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalln("could not connect to database:", err)
 	}
-	testStore = NewStore(client)
+	testStore = NewStore(client, WithDatabase(testDatabaseName))
 	os.Exit(m.Run())
 }
@@ -7,25 +7,35 @@ import (
 
 type (
 	Planet struct {
-		ID      primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-		Name    string             `bson:"name" json:"name"`
-		Terrain string             `bson:"terrain" json:"terrain"`
-		Climate string             `bson:"climate" json:"climate"`
-		Movies  int                `bson:"movies" json:"movies"`
+		ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+		Name      string             `bson:"name" json:"name"`
+		Terrain   string             `bson:"terrain" json:"terrain"`
+		Climate   string             `bson:"climate" json:"climate"`
+		Movies    int                `bson:"movies" json:"movies"`
+		CreatedBy string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
 	}
 
 	Querier interface {
+		CountPlanets(ctx context.Context) (int64, error)
 		CreatePlanet(ctx context.Context, arg CreatePlanetParams) (Planet, error)
+		CreatePlanets(ctx context.Context, arg CreatePlanetsParams) ([]CreatePlanetResult, error)
 		DeletePlanet(ctx context.Context, id string) error
-		GetPlanet(ctx context.Context, id string) (Planet, error)
+		DeletePlanets(ctx context.Context, arg DeletePlanetsParams) ([]primitive.ObjectID, error)
+		GetPlanet(ctx context.Context, id string, fields ...string) (Planet, error)
 		ListPlanets(ctx context.Context, arg ListPlanetParams) ([]Planet, error)
+		WalkPlanets(ctx context.Context, arg ListPlanetParams, fn func(planet Planet) error) error
 	}
 
-	swApiPlanetInfo struct {
-		Count   int `json:"count"`
-		Results []struct {
-			Name  string   `json:"name"`
-			Films []string `json:"films"`
-		} `json:"results"`
+	// MoviesFinder looks up the number of movies a planet has appeared in
+	MoviesFinder interface {
+		MovieAppearances(ctx context.Context, name string) (int, error)
 	}
+
+	// MoviesFinderFunc adapts an ordinary function to the MoviesFinder interface
+	MoviesFinderFunc func(ctx context.Context, name string) (int, error)
 )
+
+// MovieAppearances calls f(ctx, name)
+func (f MoviesFinderFunc) MovieAppearances(ctx context.Context, name string) (int, error) {
+	return f(ctx, name)
+}
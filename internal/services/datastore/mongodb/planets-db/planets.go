@@ -2,49 +2,56 @@ package planetsdb
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"net/http"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"strings"
+	"time"
 )
 
-const (
-	databaseName          = "star-wars"
-	planetsCollectionName = "planets"
-)
+// rollbackTimeout bounds the deletion of the planets of a failed atomic batch
+const rollbackTimeout = 10 * time.Second
 
 type CreatePlanetParams struct {
-	Name    string `json:"name"`
-	Terrain string `json:"terrain"`
-	Climate string `json:"climate"`
+	Name      string `json:"name"`
+	Terrain   string `json:"terrain"`
+	Climate   string `json:"climate"`
+	CreatedBy string `json:"created_by"`
+	// Movies is only read by CreatePlanets with SkipLookup
+	Movies int `json:"movies"`
 }
 
-// TODO: handle multiple requests to insert the same planet name
-
 // CreatePlanet creates a new planet resource with the specified arguments
 func (ms *MongoDBStore) CreatePlanet(ctx context.Context, arg CreatePlanetParams) (Planet, error) {
 	var retPlanet Planet
-	movies, err := getMovieAppearances(arg.Name)
+	movies, err := ms.movies.MovieAppearances(ctx, arg.Name)
 	if err != nil {
 		return retPlanet, fmt.Errorf("create planet: %s", err.Error())
 	}
 
-	collection := ms.mongodbClient.Database(databaseName).Collection(planetsCollectionName)
-
-	planetToAdd := Planet{
-		Name:    arg.Name,
-		Terrain: arg.Terrain,
-		Climate: arg.Climate,
-		Movies:  movies,
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return retPlanet, fmt.Errorf("create planet: %s", err.Error())
 	}
 
-	res, err := collection.InsertOne(ctx, planetToAdd)
+	planetToAdd := planetDocument(Planet{
+		Name:      arg.Name,
+		Terrain:   arg.Terrain,
+		Climate:   arg.Climate,
+		Movies:    movies,
+		CreatedBy: arg.CreatedBy,
+	})
+
+	res, err := collection.InsertOne(ctx, append(planetToAdd, scope...))
 	if err != nil {
+		// names are only unique once the migrations created the unique name index
+		if mongo.IsDuplicateKeyError(err) {
+			return retPlanet, fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)
+		}
 		return retPlanet, fmt.Errorf("create planet: %s", errorsmodel.FailedToInsertRecord)
 	}
 	objectID, ok := res.InsertedID.(primitive.ObjectID)
@@ -53,42 +60,165 @@ func (ms *MongoDBStore) CreatePlanet(ctx context.Context, arg CreatePlanetParams
 	}
 
 	retPlanet = Planet{
-		ID:      objectID,
-		Name:    arg.Name,
-		Terrain: arg.Terrain,
-		Climate: arg.Climate,
-		Movies:  movies,
+		ID:        objectID,
+		Name:      arg.Name,
+		Terrain:   arg.Terrain,
+		Climate:   arg.Climate,
+		Movies:    movies,
+		CreatedBy: arg.CreatedBy,
 	}
 	return retPlanet, nil
 }
 
+// CreatePlanets creates the planets of arg with a single InsertMany. Atomic batches are inserted
+// in order and, since transactions need a replica set, rolled back by deleting the planets
+// inserted before the failure.
+func (ms *MongoDBStore) CreatePlanets(ctx context.Context, arg CreatePlanetsParams) ([]CreatePlanetResult, error) {
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create planets: %s", err.Error())
+	}
+
+	results := LookupMovies(ctx, ms.movies, arg)
+	if arg.Atomic && Failed(results) {
+		Abort(results)
+		return results, nil
+	}
+
+	var (
+		documents []interface{}
+		ids       []primitive.ObjectID
+		// indexes maps the position of each document to its result
+		indexes []int
+	)
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		results[i].Planet.ID = primitive.NewObjectID()
+		document := append(bson.D{{Key: "_id", Value: results[i].Planet.ID}}, planetDocument(results[i].Planet)...)
+		documents = append(documents, append(document, scope...))
+		ids = append(ids, results[i].Planet.ID)
+		indexes = append(indexes, i)
+	}
+	if len(documents) == 0 {
+		return results, nil
+	}
+
+	_, err = collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(arg.Atomic))
+	if err == nil {
+		return results, nil
+	}
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		if arg.Atomic {
+			if err := ms.rollback(collection, ids); err != nil {
+				return nil, fmt.Errorf("create planets: %s", errorsmodel.CouldNotDeleteItem)
+			}
+		}
+		return nil, fmt.Errorf("create planets: %s", errorsmodel.FailedToInsertRecord)
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		result := &results[indexes[writeErr.Index]]
+		result.Planet.ID = primitive.NilObjectID
+		result.Err = fmt.Errorf("create planet: %s", errorsmodel.FailedToInsertRecord)
+		if isDuplicateKeyCode(writeErr.Code) {
+			result.Err = fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)
+		}
+	}
+	if arg.Atomic {
+		if err := ms.rollback(collection, ids); err != nil {
+			return nil, fmt.Errorf("create planets: %s", errorsmodel.CouldNotDeleteItem)
+		}
+		Abort(results)
+	}
+	return results, nil
+}
+
+// rollback deletes the planets of a failed atomic batch. It outlives the request, so a client
+// that gives up does not leave half of its batch behind.
+func (ms *MongoDBStore) rollback(collection *mongo.Collection, ids []primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	_, err := collection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	return err
+}
+
+// planetDocument is the document of planet, without its ID
+func planetDocument(planet Planet) bson.D {
+	document := bson.D{
+		{Key: "name", Value: planet.Name},
+		{Key: "terrain", Value: planet.Terrain},
+		{Key: "climate", Value: planet.Climate},
+		{Key: "movies", Value: planet.Movies},
+	}
+	if planet.CreatedBy != "" {
+		document = append(document, bson.E{Key: "created_by", Value: planet.CreatedBy})
+	}
+	return document
+}
+
+// isDuplicateKeyCode reports whether code is one of the duplicate key error codes handled by
+// mongo.IsDuplicateKeyError, which does not accept the errors of a single write
+func isDuplicateKeyCode(code int) bool {
+	return code == 11000 || code == 11001 || code == 12582
+}
+
+// CountPlanets counts the planets of the collection
+func (ms *MongoDBStore) CountPlanets(ctx context.Context) (int64, error) {
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("count planets: %s", err.Error())
+	}
+
+	count, err := collection.CountDocuments(ctx, scope)
+	if err != nil {
+		return 0, fmt.Errorf("count planets: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return count, nil
+}
+
 // DeletePlanet deletes an existing planet from the collection based on the id
 func (ms *MongoDBStore) DeletePlanet(ctx context.Context, id string) error {
-	collection := ms.mongodbClient.Database(databaseName).Collection(planetsCollectionName)
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return fmt.Errorf("delete planet: %s", err.Error())
+	}
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return fmt.Errorf("delete planet: %s", errorsmodel.InvalidID)
 	}
 
-	filter := bson.D{{"_id", objectId}}
-	_, err = collection.DeleteOne(ctx, filter)
+	filter := append(bson.D{{Key: "_id", Value: objectId}}, scope...)
+	result, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
 		return fmt.Errorf("delete planet: %s", errorsmodel.CouldNotDeleteItem)
 	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("delete planet: %s", errorsmodel.PlanetDoesNotExist)
+	}
 	return nil
 }
 
-// GetPlanet finds a planet based on the ID
-func (ms *MongoDBStore) GetPlanet(ctx context.Context, id string) (Planet, error) {
-	collection := ms.mongodbClient.Database(databaseName).Collection(planetsCollectionName)
+// GetPlanet finds a planet based on the ID, holding only its ID and fields unless fields is empty
+func (ms *MongoDBStore) GetPlanet(ctx context.Context, id string, fields ...string) (Planet, error) {
 	var planet Planet
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return planet, fmt.Errorf("get planet: %s", err.Error())
+	}
 
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return planet, fmt.Errorf("get planet: %s", errorsmodel.InvalidID)
 	}
-	filter := bson.D{{"_id", objectId}}
-	err = collection.FindOne(ctx, filter).Decode(&planet)
+	filter := append(bson.D{{Key: "_id", Value: objectId}}, scope...)
+	findOptions := options.FindOne()
+	if projection := projection(fields); projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	err = collection.FindOne(ctx, filter, findOptions).Decode(&planet)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return planet, fmt.Errorf("get planet: %s", errorsmodel.PlanetDoesNotExist)
@@ -99,22 +229,26 @@ func (ms *MongoDBStore) GetPlanet(ctx context.Context, id string) (Planet, error
 }
 
 type ListPlanetParams struct {
-	Name string `json:"name"`
+	Name    string `json:"name"`
+	Climate string `json:"climate"`
+	Terrain string `json:"terrain"`
+	// Offset is the number of matching planets to skip
+	Offset int64 `json:"offset"`
+	// Limit caps the number of returned planets, zero means no limit
+	Limit int64 `json:"limit"`
+	// Fields selects the fields of the planets besides their ID, empty means every field
+	Fields []string `json:"fields"`
 }
 
-// ListPlanets list filtered planets based on "name" query or list all of them
+// ListPlanets list planets filtered by name, climate and terrain, ordered by ID
 func (ms *MongoDBStore) ListPlanets(ctx context.Context, arg ListPlanetParams) ([]Planet, error) {
-	// TODO: implement pagination
-	collection := ms.mongodbClient.Database(databaseName).Collection(planetsCollectionName)
-
-	var filter bson.D
-	trimmedName := strings.TrimSpace(arg.Name)
-	if trimmedName == "" {
-		filter = bson.D{}
-	} else {
-		filter = bson.D{{"name", trimmedName}}
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list planets: %s", err.Error())
 	}
-	cur, err := collection.Find(ctx, filter)
+	filter := planetsFilter(scope, arg.Name, arg.Climate, arg.Terrain)
+
+	cur, err := collection.Find(ctx, filter, listOptions(arg))
 	if err != nil {
 		return nil, err
 	}
@@ -140,35 +274,122 @@ func (ms *MongoDBStore) ListPlanets(ctx context.Context, arg ListPlanetParams) (
 	return planets, nil
 }
 
-// getMovieAppearances gets the total number of movies that a planet has appeared in
-func getMovieAppearances(name string) (int, error) {
-	baseUrlSearch := "https://swapi.dev/api/planets/"
+// WalkPlanets calls fn with each planet filtered by name, climate and terrain, ordered by ID,
+// reading them from the cursor as fn consumes them. An error of fn or the cancellation of ctx
+// stops the walk and is returned.
+func (ms *MongoDBStore) WalkPlanets(ctx context.Context, arg ListPlanetParams, fn func(planet Planet) error) error {
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return fmt.Errorf("walk planets: %s", err.Error())
+	}
+	filter := planetsFilter(scope, arg.Name, arg.Climate, arg.Terrain)
 
-	req, err := http.NewRequest(http.MethodGet, baseUrlSearch, nil)
+	cur, err := collection.Find(ctx, filter, listOptions(arg))
 	if err != nil {
-		return -1, errors.New(errorsmodel.FailedToFetchRecord)
+		return fmt.Errorf("walk planets: %s", errorsmodel.FailedToFetchRecord)
 	}
+	defer cur.Close(ctx)
 
-	q := req.URL.Query()
-	q.Set("search", name)
-	req.URL.RawQuery = q.Encode()
+	for cur.Next(ctx) {
+		// Next only sees the cancellation of ctx when it fetches a new batch
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var planet Planet
+		if err := cur.Decode(&planet); err != nil {
+			return fmt.Errorf("walk planets: %s", errorsmodel.FailedToUnmarshalRecord)
+		}
+		if err := fn(planet); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("walk planets: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return nil
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return -1, errors.New(errorsmodel.FailedToFetchRecord)
+// listOptions sorts the planets by ID, paginates them by the offset and limit of arg and projects
+// them to its fields
+func listOptions(arg ListPlanetParams) *options.FindOptions {
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if projection := projection(arg.Fields); projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	if arg.Offset > 0 {
+		findOptions.SetSkip(arg.Offset)
+	}
+	if arg.Limit > 0 {
+		findOptions.SetLimit(arg.Limit)
 	}
-	defer res.Body.Close()
+	return findOptions
+}
 
-	var planetInfo swApiPlanetInfo
+type DeletePlanetsParams struct {
+	Name    string `json:"name"`
+	Climate string `json:"climate"`
+	Terrain string `json:"terrain"`
+	// DryRun finds the matching planets without deleting them
+	DryRun bool `json:"dry_run"`
+}
+
+// DeletePlanets deletes the planets filtered by name, climate and terrain, returning their IDs in
+// ascending order. At least one filter is required.
+func (ms *MongoDBStore) DeletePlanets(ctx context.Context, arg DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	if !HasFilter(arg) {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.MissingFilter)
+	}
+	collection, scope, err := ms.collection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("delete planets: %s", err.Error())
+	}
 
-	err = json.NewDecoder(res.Body).Decode(&planetInfo)
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetProjection(bson.D{{Key: "_id", Value: 1}})
+	cur, err := collection.Find(ctx, planetsFilter(scope, arg.Name, arg.Climate, arg.Terrain), findOptions)
 	if err != nil {
-		return -1, errors.New(errorsmodel.FailedToUnmarshalRecord)
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.FailedToFetchRecord)
+	}
+	var matches []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cur.All(ctx, &matches); err != nil {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.FailedToUnmarshalRecord)
+	}
+	ids := make([]primitive.ObjectID, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+	}
+	if arg.DryRun || len(ids) == 0 {
+		return ids, nil
 	}
 
-	if planetInfo.Count != 1 || planetInfo.Results[0].Name != name {
-		return -1, fmt.Errorf("%s: %s", errorsmodel.InvalidPlanetName, name)
+	// deleting by ID leaves out the planets created since the lookup, so the IDs are exactly
+	// the deleted planets
+	filter := append(bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, scope...)
+	if _, err := collection.DeleteMany(ctx, filter); err != nil {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.CouldNotDeleteItem)
 	}
+	return ids, nil
+}
 
-	return len(planetInfo.Results[0].Films), nil
+// HasFilter reports whether arg filters the planets to delete by at least one field
+func HasFilter(arg DeletePlanetsParams) bool {
+	return strings.TrimSpace(arg.Name) != "" || strings.TrimSpace(arg.Climate) != "" || strings.TrimSpace(arg.Terrain) != ""
+}
+
+// planetsFilter scopes the planets filtered by the non blank of name, climate and terrain
+func planetsFilter(scope bson.D, name, climate, terrain string) bson.D {
+	filter := append(bson.D{}, scope...)
+	if name := strings.TrimSpace(name); name != "" {
+		filter = append(filter, bson.E{Key: "name", Value: name})
+	}
+	if climate := strings.TrimSpace(climate); climate != "" {
+		filter = append(filter, bson.E{Key: "climate", Value: climate})
+	}
+	if terrain := strings.TrimSpace(terrain); terrain != "" {
+		filter = append(filter, bson.E{Key: "terrain", Value: terrain})
+	}
+	return filter
 }
@@ -0,0 +1,84 @@
+package planetsdb
+
+import (
+	"context"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const RateLimitsCollectionName = "rate_limits"
+
+type (
+	// MongoDBRateLimitStore is a ratelimit.Store kept in the rate_limits collection, shared by
+	// every replica.
+	//
+	// Each bucket is stored as its theoretical arrival time (GCRA): the time the bucket would be
+	// full again, in unix nanoseconds. Taking n tokens moves it n intervals forward as long as a
+	// token is left, which mongodb does atomically in a single pipeline update.
+	MongoDBRateLimitStore struct {
+		collection *mongo.Collection
+	}
+
+	rateLimitDocument struct {
+		Key       string    `bson:"_id"`
+		TAT       int64     `bson:"tat"`
+		ExpiresAt time.Time `bson:"expires_at"`
+		// Allowed records whether the last take was allowed
+		Allowed bool `bson:"allowed"`
+	}
+)
+
+// RateLimitStore returns the rate limit buckets stored in the planets database. With
+// DatabasePerTenant they live in the database named by WithDatabase.
+func (ms *MongoDBStore) RateLimitStore() *MongoDBRateLimitStore {
+	return &MongoDBRateLimitStore{
+		collection: ms.mongodbClient.Database(ms.databaseName).Collection(RateLimitsCollectionName),
+	}
+}
+
+// Take takes n tokens from the bucket of key
+func (rs *MongoDBRateLimitStore) Take(ctx context.Context, key string, limit ratelimit.Limit, n int, now time.Time) (ratelimit.Result, error) {
+	interval := int64(limit.Interval())
+	burst := int64(limit.Requests) * interval
+	nowNanos := now.UnixNano()
+
+	update := mongo.Pipeline{
+		// a bucket that was full before now is full at now, missing buckets are created full
+		{{Key: "$set", Value: bson.D{
+			{Key: "tat", Value: bson.D{{Key: "$max", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$tat", nowNanos}}}, nowNanos}}}},
+		}}},
+		// a token is left
+		{{Key: "$set", Value: bson.D{
+			{Key: "allowed", Value: bson.D{{Key: "$lte", Value: bson.A{"$tat", nowNanos + burst - interval}}}},
+		}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "tat", Value: bson.D{{Key: "$cond", Value: bson.A{"$allowed", bson.D{{Key: "$add", Value: bson.A{"$tat", int64(n) * interval}}}, "$tat"}}}},
+		}}},
+		// the bucket is forgotten once it is full again
+		{{Key: "$set", Value: bson.D{
+			{Key: "expires_at", Value: bson.D{{Key: "$add", Value: bson.A{now, bson.D{{Key: "$divide", Value: bson.A{bson.D{{Key: "$subtract", Value: bson.A{"$tat", nowNanos}}}, int64(time.Millisecond)}}}}}}},
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var doc rateLimitDocument
+	err := rs.collection.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: key}}, update, opts).Decode(&doc)
+	if mongo.IsDuplicateKeyError(err) {
+		// another replica created the bucket first, the update now finds it
+		err = rs.collection.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: key}}, update, opts).Decode(&doc)
+	}
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("take rate limit token: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return limit.Result(tokens(doc.TAT, nowNanos, burst, interval), doc.Allowed), nil
+}
+
+// tokens is the number of tokens left in a bucket with the theoretical arrival time tat
+func tokens(tat, now, burst, interval int64) float64 {
+	return float64(now+burst-tat) / float64(interval)
+}
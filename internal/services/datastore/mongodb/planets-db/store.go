@@ -1,19 +1,183 @@
 package planetsdb
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/swapi"
+	"github.com/gmaschi/b2w-sw-planets/internal/tenancy"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
+	"sync"
 )
 
+const (
+	DefaultDatabaseName          = "star-wars"
+	DefaultPlanetsCollectionName = "planets"
+
+	// tenantField holds the owner of a planet when tenants share a collection
+	tenantField = "tenant_id"
+)
+
+// Tenancy selects how the planets of different tenants are kept apart
+type Tenancy string
+
+const (
+	// NoTenancy keeps every planet in a single collection
+	NoTenancy Tenancy = "none"
+	// DatabasePerTenant keeps the planets of each tenant in their own database
+	DatabasePerTenant Tenancy = "database"
+	// TenantFilter keeps every planet in a single collection, scoped by a tenant field
+	TenantFilter Tenancy = "filter"
+)
+
+// ParseTenancy validates the name of a tenancy mode
+func ParseTenancy(name string) (Tenancy, error) {
+	switch tenancy := Tenancy(name); tenancy {
+	case NoTenancy, DatabasePerTenant, TenantFilter:
+		return tenancy, nil
+	default:
+		return "", fmt.Errorf("unsupported tenancy %q", name)
+	}
+}
+
 type Store interface {
 	Querier
 }
 
-type MongoDBStore struct {
-	mongodbClient *mongo.Client
+type (
+	MongoDBStore struct {
+		mongodbClient  *mongo.Client
+		movies         MoviesFinder
+		databaseName   string
+		collectionName string
+		tenancy        Tenancy
+		tenantSetup    *tenantSetup
+	}
+
+	// tenantSetup prepares each tenant database once, the first time a store uses it
+	tenantSetup struct {
+		setup func(ctx context.Context, db *mongo.Database) error
+		group singleflight.Group
+		mu    sync.Mutex
+		ready map[string]bool
+	}
+
+	// Option configures a MongoDBStore
+	Option func(*MongoDBStore)
+)
+
+// WithMoviesFinder replaces the SWAPI client used to count movie appearances
+func WithMoviesFinder(movies MoviesFinder) Option {
+	return func(ms *MongoDBStore) {
+		ms.movies = movies
+	}
+}
+
+// WithDatabase sets the database holding the planets collection. With DatabasePerTenant
+// it is the prefix of every tenant's database.
+func WithDatabase(name string) Option {
+	return func(ms *MongoDBStore) {
+		ms.databaseName = name
+	}
+}
+
+// WithCollection sets the name of the planets collection
+func WithCollection(name string) Option {
+	return func(ms *MongoDBStore) {
+		ms.collectionName = name
+	}
 }
 
-func NewStore(mongodbClient *mongo.Client) MongoDBStore {
-	return MongoDBStore{
-		mongodbClient: mongodbClient,
+// WithTenancy isolates the planets of each tenant. The tenant is read from the
+// request context, see tenancy.NewContext.
+func WithTenancy(tenancy Tenancy) Option {
+	return func(ms *MongoDBStore) {
+		ms.tenancy = tenancy
 	}
 }
+
+// WithTenantSetup runs setup on the database of each tenant before the store first uses it, as
+// in applying its migrations, when every tenant has a database of their own. A setup that fails
+// is tried again by the next request of the tenant.
+func WithTenantSetup(setup func(ctx context.Context, db *mongo.Database) error) Option {
+	return func(ms *MongoDBStore) {
+		ms.tenantSetup = &tenantSetup{
+			setup: setup,
+			ready: make(map[string]bool),
+		}
+	}
+}
+
+func NewStore(mongodbClient *mongo.Client, opts ...Option) MongoDBStore {
+	store := MongoDBStore{
+		mongodbClient:  mongodbClient,
+		movies:         swapi.New(),
+		databaseName:   DefaultDatabaseName,
+		collectionName: DefaultPlanetsCollectionName,
+		tenancy:        NoTenancy,
+	}
+	for _, opt := range opts {
+		opt(&store)
+	}
+	return store
+}
+
+// collection returns the planets collection of the tenant in ctx and the filter
+// that scopes queries to that tenant
+func (ms *MongoDBStore) collection(ctx context.Context) (*mongo.Collection, bson.D, error) {
+	if ms.tenancy == NoTenancy || ms.tenancy == "" {
+		return ms.mongodbClient.Database(ms.databaseName).Collection(ms.collectionName), bson.D{}, nil
+	}
+
+	tenantID, ok := tenancy.FromContext(ctx)
+	if !ok {
+		return nil, nil, errors.New(errorsmodel.MissingTenantID)
+	}
+	if !tenancy.ValidID(tenantID) {
+		return nil, nil, errors.New(errorsmodel.InvalidTenantID)
+	}
+
+	if ms.tenancy == DatabasePerTenant {
+		db := ms.mongodbClient.Database(fmt.Sprintf("%s-%s", ms.databaseName, tenantID))
+		if ms.tenantSetup != nil {
+			if err := ms.tenantSetup.prepare(ctx, db); err != nil {
+				return nil, nil, errors.New(errorsmodel.TenantNotReady)
+			}
+		}
+		return db.Collection(ms.collectionName), bson.D{}, nil
+	}
+	collection := ms.mongodbClient.Database(ms.databaseName).Collection(ms.collectionName)
+	return collection, bson.D{{Key: tenantField, Value: tenantID}}, nil
+}
+
+// prepare runs the setup of db unless it already succeeded, once for the concurrent requests
+// of the same tenant
+func (ts *tenantSetup) prepare(ctx context.Context, db *mongo.Database) error {
+	if ts.isReady(db.Name()) {
+		return nil
+	}
+
+	_, err, _ := ts.group.Do(db.Name(), func() (interface{}, error) {
+		// a flight that ended since the check above may have prepared db
+		if ts.isReady(db.Name()) {
+			return nil, nil
+		}
+		if err := ts.setup(ctx, db); err != nil {
+			return nil, err
+		}
+		ts.mu.Lock()
+		ts.ready[db.Name()] = true
+		ts.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+func (ts *tenantSetup) isReady(database string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.ready[database]
+}
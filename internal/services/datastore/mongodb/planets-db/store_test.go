@@ -0,0 +1,189 @@
+package planetsdb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency"
+	"github.com/gmaschi/b2w-sw-planets/internal/idempotency/idempotencytest"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit"
+	"github.com/gmaschi/b2w-sw-planets/internal/ratelimit/ratelimittest"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/migrations"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/storetest"
+	"github.com/gmaschi/b2w-sw-planets/internal/tenancy"
+	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"testing"
+)
+
+const testDatabaseName = "star-wars-test"
+
+func connect(t *testing.T) *mongo.Client {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Disconnect(context.Background())
+	})
+	return client
+}
+
+func TestStoreConformance(t *testing.T) {
+	client := connect(t)
+
+	storetest.Run(t, func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store {
+		// planet names are only unique on a migrated database
+		db := client.Database(fmt.Sprintf("%s-%s", testDatabaseName, random.String(6)))
+		t.Cleanup(func() {
+			db.Drop(context.Background())
+		})
+		_, err := migrations.New(db, migrations.Config{Collection: planetsdb.DefaultPlanetsCollectionName}).Run(context.Background())
+		require.NoError(t, err)
+
+		store := planetsdb.NewStore(client, planetsdb.WithMoviesFinder(movies), planetsdb.WithDatabase(db.Name()))
+		return &store
+	})
+}
+
+func TestKeyStoreConformance(t *testing.T) {
+	client := connect(t)
+
+	storetest.RunKeys(t, func(t *testing.T) apikeys.Store {
+		store := planetsdb.NewStore(client, planetsdb.WithDatabase(testDatabaseName))
+		return store.KeyStore()
+	})
+}
+
+func TestRateLimitStoreConformance(t *testing.T) {
+	client := connect(t)
+
+	ratelimittest.Run(t, func(t *testing.T) ratelimit.Store {
+		store := planetsdb.NewStore(client, planetsdb.WithDatabase(testDatabaseName))
+		return store.RateLimitStore()
+	})
+}
+
+func TestIdempotencyStoreConformance(t *testing.T) {
+	client := connect(t)
+
+	idempotencytest.Run(t, func(t *testing.T) idempotency.Store {
+		store := planetsdb.NewStore(client, planetsdb.WithDatabase(testDatabaseName))
+		return store.IdempotencyStore()
+	})
+}
+
+func TestTenancy(t *testing.T) {
+	client := connect(t)
+
+	for _, mode := range []planetsdb.Tenancy{planetsdb.DatabasePerTenant, planetsdb.TenantFilter} {
+		t.Run(string(mode), func(t *testing.T) {
+			database := fmt.Sprintf("%s-%s", testDatabaseName, random.String(6))
+			store := planetsdb.NewStore(client,
+				planetsdb.WithMoviesFinder(storetest.Movies),
+				planetsdb.WithDatabase(database),
+				planetsdb.WithCollection("tenant-planets"),
+				planetsdb.WithTenancy(mode),
+			)
+			t.Cleanup(func() {
+				for _, suffix := range []string{"", "-rebels", "-empire"} {
+					client.Database(database + suffix).Drop(context.Background())
+				}
+			})
+
+			rebels := tenancy.NewContext(context.Background(), "rebels")
+			empire := tenancy.NewContext(context.Background(), "empire")
+			arg := planetsdb.CreatePlanetParams{Name: "Alderaan", Terrain: "grasslands", Climate: "temperate"}
+
+			planet, err := store.CreatePlanet(rebels, arg)
+			require.NoError(t, err)
+
+			gotPlanet, err := store.GetPlanet(rebels, planet.ID.Hex())
+			require.NoError(t, err)
+			require.Equal(t, planet, gotPlanet)
+
+			_, err = store.GetPlanet(empire, planet.ID.Hex())
+			require.EqualError(t, err, fmt.Sprintf("get planet: %s", errorsmodel.PlanetDoesNotExist))
+
+			_, err = store.ListPlanets(empire, planetsdb.ListPlanetParams{})
+			require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+
+			err = store.DeletePlanet(empire, planet.ID.Hex())
+			require.EqualError(t, err, fmt.Sprintf("delete planet: %s", errorsmodel.PlanetDoesNotExist))
+			planets, err := store.ListPlanets(rebels, planetsdb.ListPlanetParams{})
+			require.NoError(t, err)
+			require.Equal(t, []planetsdb.Planet{planet}, planets)
+
+			_, err = store.CreatePlanet(context.Background(), arg)
+			require.EqualError(t, err, fmt.Sprintf("create planet: %s", errorsmodel.MissingTenantID))
+
+			_, err = store.ListPlanets(tenancy.NewContext(context.Background(), "../admin"), planetsdb.ListPlanetParams{})
+			require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.InvalidTenantID))
+		})
+	}
+}
+
+func TestTenantSetup(t *testing.T) {
+	client := connect(t)
+	database := fmt.Sprintf("%s-%s", testDatabaseName, random.String(6))
+	t.Cleanup(func() {
+		for _, suffix := range []string{"-rebels", "-empire"} {
+			client.Database(database + suffix).Drop(context.Background())
+		}
+	})
+
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+		fail  = true
+	)
+	store := planetsdb.NewStore(client,
+		planetsdb.WithMoviesFinder(storetest.Movies),
+		planetsdb.WithDatabase(database),
+		planetsdb.WithTenancy(planetsdb.DatabasePerTenant),
+		planetsdb.WithTenantSetup(func(ctx context.Context, db *mongo.Database) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[db.Name()]++
+			if fail && db.Name() == database+"-empire" {
+				return errors.New("setup failed")
+			}
+			return nil
+		}),
+	)
+
+	rebels := tenancy.NewContext(context.Background(), "rebels")
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.ListPlanets(rebels, planetsdb.ListPlanetParams{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+	}
+	_, err := store.CreatePlanet(rebels, planetsdb.CreatePlanetParams{Name: "Alderaan", Terrain: "grasslands", Climate: "temperate"})
+	require.NoError(t, err)
+
+	// a failed setup is tried again by the next request of the tenant
+	empire := tenancy.NewContext(context.Background(), "empire")
+	_, err = store.ListPlanets(empire, planetsdb.ListPlanetParams{})
+	require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.TenantNotReady))
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	_, err = store.ListPlanets(empire, planetsdb.ListPlanetParams{})
+	require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+
+	require.Equal(t, map[string]int{database + "-rebels": 1, database + "-empire": 2}, calls)
+}
@@ -0,0 +1,112 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"strings"
+	"time"
+)
+
+const keyColumns = "id, name, prefix, hash, scopes, tenant, created_at, revoked_at"
+
+// KeyStore is an apikeys.Store kept in the api_keys table of a SQLStore database
+type KeyStore struct {
+	store *SQLStore
+}
+
+// KeyStore returns the API keys stored next to the planets. Migrate creates their table.
+func (s *SQLStore) KeyStore() *KeyStore {
+	return &KeyStore{store: s}
+}
+
+// CreateKey stores key
+func (ks *KeyStore) CreateKey(ctx context.Context, key apikeys.Key) error {
+	query := ks.store.rebind(`INSERT INTO api_keys (` + keyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err := ks.store.db.ExecContext(ctx, query,
+		key.ID, key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, " "), key.Tenant, key.CreatedAt.UTC(), nullTime(key.RevokedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("create API key: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return nil
+}
+
+// KeyByHash gets the key with hash
+func (ks *KeyStore) KeyByHash(ctx context.Context, hash string) (apikeys.Key, error) {
+	row := ks.store.db.QueryRowContext(ctx, ks.store.rebind(`SELECT `+keyColumns+` FROM api_keys WHERE hash = ?`), hash)
+	key, err := scanKey(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apikeys.Key{}, fmt.Errorf("get API key: %s", errorsmodel.APIKeyDoesNotExist)
+		}
+		return apikeys.Key{}, fmt.Errorf("get API key: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return key, nil
+}
+
+// ListKeys lists every key, revoked ones included, oldest first
+func (ks *KeyStore) ListKeys(ctx context.Context) ([]apikeys.Key, error) {
+	rows, err := ks.store.db.QueryContext(ctx, `SELECT `+keyColumns+` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %s", errorsmodel.FailedToFetchRecord)
+	}
+	defer rows.Close()
+
+	keys := []apikeys.Key{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list API keys: %s", errorsmodel.FailedToUnmarshalRecord)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list API keys: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes the key with id. Revoking a revoked key keeps its first revocation time.
+func (ks *KeyStore) RevokeKey(ctx context.Context, id string, at time.Time) error {
+	var exists int
+	row := ks.store.db.QueryRowContext(ctx, ks.store.rebind(`SELECT 1 FROM api_keys WHERE id = ?`), id)
+	if err := row.Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("revoke API key: %s", errorsmodel.APIKeyDoesNotExist)
+		}
+		return fmt.Errorf("revoke API key: %s", errorsmodel.FailedToFetchRecord)
+	}
+
+	query := ks.store.rebind(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`)
+	if _, err := ks.store.db.ExecContext(ctx, query, at.UTC(), id); err != nil {
+		return fmt.Errorf("revoke API key: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return nil
+}
+
+func scanKey(row rowScanner) (apikeys.Key, error) {
+	var (
+		key       apikeys.Key
+		scopes    string
+		revokedAt sql.NullTime
+	)
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.Tenant, &key.CreatedAt, &revokedAt); err != nil {
+		return apikeys.Key{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
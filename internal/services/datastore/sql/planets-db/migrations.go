@@ -0,0 +1,164 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type migration struct {
+	version     int
+	description string
+	// check, when set, runs before the statements and refuses the migration with the rows it
+	// cannot apply to
+	check      func(ctx context.Context, tx *sql.Tx) error
+	statements []string
+}
+
+// migrations is the ordered schema history. Applied migrations must never be edited, add a new one instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create planets table",
+		statements: []string{
+			`CREATE TABLE planets (
+				id CHAR(24) PRIMARY KEY,
+				name TEXT NOT NULL,
+				terrain TEXT NOT NULL,
+				climate TEXT NOT NULL,
+				movies INTEGER NOT NULL
+			)`,
+		},
+	},
+	{
+		version:     2,
+		description: "index planets filters",
+		statements: []string{
+			`CREATE INDEX planets_name_idx ON planets (name)`,
+			`CREATE INDEX planets_climate_idx ON planets (climate)`,
+			`CREATE INDEX planets_terrain_idx ON planets (terrain)`,
+		},
+	},
+	{
+		version:     3,
+		description: "create api keys table",
+		statements: []string{
+			`CREATE TABLE api_keys (
+				id CHAR(24) PRIMARY KEY,
+				name TEXT NOT NULL,
+				prefix TEXT NOT NULL,
+				hash CHAR(64) NOT NULL UNIQUE,
+				scopes TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				revoked_at TIMESTAMP
+			)`,
+		},
+	},
+	{
+		version:     4,
+		description: "record planets creator",
+		statements: []string{
+			`ALTER TABLE planets ADD COLUMN created_by TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version:     5,
+		description: "bind api keys to a tenant",
+		statements: []string{
+			`ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version:     6,
+		description: "unique planets names",
+		check:       checkDuplicateNames,
+		statements: []string{
+			`DROP INDEX planets_name_idx`,
+			`CREATE UNIQUE INDEX planets_name_unique ON planets (name)`,
+		},
+	},
+}
+
+// checkDuplicateNames refuses to make the names unique while planets share one, listing the
+// names to rename or delete first
+func checkDuplicateNames(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT name, COUNT(*) FROM planets GROUP BY name HAVING COUNT(*) > 1 ORDER BY name`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var (
+			name  string
+			count int
+		)
+		if err := rows.Scan(&name, &count); err != nil {
+			return err
+		}
+		names = append(names, fmt.Sprintf("%q (%d planets)", name, count))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("planets share the names %s, rename or delete the duplicates and start again", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Migrate applies the pending schema migrations. It is safe to call on every startup.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("migrate: %s", err.Error())
+	}
+
+	for _, m := range migrations {
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migrate: version %d: %s", m.version, err.Error())
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m and records it in a single transaction unless it was already applied
+func (s *SQLStore) applyMigration(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	if m.check != nil {
+		if err := m.check(ctx, tx); err != nil {
+			return err
+		}
+	}
+	for _, statement := range m.statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, description) VALUES (?, ?)`), m.version, m.description)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,353 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+const planetColumns = "id, name, terrain, climate, movies, created_by"
+
+// deleteChunkSize bounds the IDs bound to a single DELETE, below the variable limit of SQLite
+const deleteChunkSize = 500
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// CreatePlanet creates a new planet resource with the specified arguments
+func (s *SQLStore) CreatePlanet(ctx context.Context, arg planetsdb.CreatePlanetParams) (planetsdb.Planet, error) {
+	movies, err := s.movies.MovieAppearances(ctx, arg.Name)
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("create planet: %s", err.Error())
+	}
+
+	planet := planetsdb.Planet{
+		ID:        primitive.NewObjectID(),
+		Name:      arg.Name,
+		Terrain:   arg.Terrain,
+		Climate:   arg.Climate,
+		Movies:    movies,
+		CreatedBy: arg.CreatedBy,
+	}
+
+	query := s.rebind(`INSERT INTO planets (` + planetColumns + `) VALUES (?, ?, ?, ?, ?, ?)`)
+	_, err = s.db.ExecContext(ctx, query, planet.ID.Hex(), planet.Name, planet.Terrain, planet.Climate, planet.Movies, planet.CreatedBy)
+	if err != nil {
+		return planetsdb.Planet{}, insertError(err)
+	}
+	return planet, nil
+}
+
+// CreatePlanets creates the planets of arg. Atomic batches are inserted in a transaction, rolled
+// back when an insert fails.
+func (s *SQLStore) CreatePlanets(ctx context.Context, arg planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+	results := planetsdb.LookupMovies(ctx, s.movies, arg)
+	if arg.Atomic && planetsdb.Failed(results) {
+		planetsdb.Abort(results)
+		return results, nil
+	}
+
+	query := s.rebind(`INSERT INTO planets (` + planetColumns + `) VALUES (?, ?, ?, ?, ?, ?)`)
+	if !arg.Atomic {
+		for i := range results {
+			if results[i].Err != nil {
+				continue
+			}
+			planet := results[i].Planet
+			planet.ID = primitive.NewObjectID()
+			_, err := s.db.ExecContext(ctx, query, planet.ID.Hex(), planet.Name, planet.Terrain, planet.Climate, planet.Movies, planet.CreatedBy)
+			if err != nil {
+				results[i].Err = insertError(err)
+				continue
+			}
+			results[i].Planet = planet
+		}
+		return results, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create planets: %s", errorsmodel.FailedToInsertRecord)
+	}
+	defer tx.Rollback()
+	for i := range results {
+		planet := &results[i].Planet
+		planet.ID = primitive.NewObjectID()
+		_, err := tx.ExecContext(ctx, query, planet.ID.Hex(), planet.Name, planet.Terrain, planet.Climate, planet.Movies, planet.CreatedBy)
+		if err != nil {
+			results[i].Err = insertError(err)
+			planetsdb.Abort(results)
+			return results, nil
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("create planets: %s", errorsmodel.FailedToInsertRecord)
+	}
+	return results, nil
+}
+
+// insertError is the error of creating a planet whose insert failed with err
+func insertError(err error) error {
+	if isUniqueViolation(err) {
+		return fmt.Errorf("create planet: %s", errorsmodel.PlanetAlreadyExists)
+	}
+	return fmt.Errorf("create planet: %s", errorsmodel.FailedToInsertRecord)
+}
+
+// CountPlanets counts the planets of the table
+func (s *SQLStore) CountPlanets(ctx context.Context) (int64, error) {
+	var count int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM planets`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count planets: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return count, nil
+}
+
+// DeletePlanet deletes an existing planet from the table based on the id
+func (s *SQLStore) DeletePlanet(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("delete planet: %s", errorsmodel.InvalidID)
+	}
+
+	result, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM planets WHERE id = ?`), objectID.Hex())
+	if err != nil {
+		return fmt.Errorf("delete planet: %s", errorsmodel.CouldNotDeleteItem)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete planet: %s", errorsmodel.CouldNotDeleteItem)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("delete planet: %s", errorsmodel.PlanetDoesNotExist)
+	}
+	return nil
+}
+
+// GetPlanet finds a planet based on the ID, holding only its ID and fields unless fields is empty
+func (s *SQLStore) GetPlanet(ctx context.Context, id string, fields ...string) (planetsdb.Planet, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.InvalidID)
+	}
+
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+planetColumns+` FROM planets WHERE id = ?`), objectID.Hex())
+	planet, err := scanPlanet(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.PlanetDoesNotExist)
+		}
+		return planetsdb.Planet{}, fmt.Errorf("get planet: %s", errorsmodel.FailedToFetchRecord)
+	}
+	return planetsdb.Project(planet, fields), nil
+}
+
+// ListPlanets list planets filtered by name, climate and terrain, ordered by ID
+func (s *SQLStore) ListPlanets(ctx context.Context, arg planetsdb.ListPlanetParams) ([]planetsdb.Planet, error) {
+	planets, err := s.list(ctx, arg, "")
+	if err != nil {
+		return nil, fmt.Errorf("list planets: %s", err.Error())
+	}
+
+	if len(planets) == 0 {
+		return nil, fmt.Errorf("list planets: %s", errorsmodel.PlanetDoesNotExist)
+	}
+
+	return planets, nil
+}
+
+// walkPageSize is the number of planets WalkPlanets reads at a time
+const walkPageSize int64 = 500
+
+// WalkPlanets calls fn with each planet filtered by name, climate and terrain, ordered by ID.
+// The planets are read a page at a time, after the last ID of the previous page, so only a page
+// is held in memory and a slow fn never holds a connection, the only one of SQLite, open. An
+// error of fn or the cancellation of ctx stops the walk and is returned.
+func (s *SQLStore) WalkPlanets(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+	page, after, walked := arg, "", int64(0)
+	for {
+		page.Limit = walkPageSize
+		if arg.Limit > 0 && arg.Limit-walked < walkPageSize {
+			page.Limit = arg.Limit - walked
+		}
+		planets, err := s.list(ctx, page, after)
+		if err != nil {
+			return fmt.Errorf("walk planets: %s", err.Error())
+		}
+
+		for _, planet := range planets {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(planet); err != nil {
+				return err
+			}
+		}
+		walked += int64(len(planets))
+		if int64(len(planets)) < page.Limit || walked == arg.Limit {
+			return nil
+		}
+		// the offset only skips planets of the first page
+		page.Offset, after = 0, planets[len(planets)-1].ID.Hex()
+	}
+}
+
+// list reads the page of arg of the planets filtered by name, climate and terrain, ordered by ID,
+// starting after the ID after when it is not empty
+func (s *SQLStore) list(ctx context.Context, arg planetsdb.ListPlanetParams, after string) ([]planetsdb.Planet, error) {
+	where, args := planetsFilter(arg.Name, arg.Climate, arg.Terrain)
+	if after != "" {
+		if where == "" {
+			where = ` WHERE id > ?`
+		} else {
+			where += ` AND id > ?`
+		}
+		args = append(args, after)
+	}
+	query := `SELECT ` + planetColumns + ` FROM planets` + where + ` ORDER BY id`
+	switch {
+	case arg.Limit > 0:
+		query += ` LIMIT ?`
+		args = append(args, arg.Limit)
+	case arg.Offset > 0 && s.dialect == SQLite:
+		// SQLite only accepts OFFSET after a LIMIT, and a negative LIMIT means no limit
+		query += ` LIMIT -1`
+	}
+	if arg.Offset > 0 {
+		query += ` OFFSET ?`
+		args = append(args, arg.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, errors.New(errorsmodel.FailedToFetchRecord)
+	}
+	defer rows.Close()
+	var planets []planetsdb.Planet
+
+	for rows.Next() {
+		planet, err := scanPlanet(rows)
+		if err != nil {
+			return nil, errors.New(errorsmodel.FailedToUnmarshalRecord)
+		}
+		planets = append(planets, planetsdb.Project(planet, arg.Fields))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New(errorsmodel.FailedToFetchRecord)
+	}
+	return planets, nil
+}
+
+// DeletePlanets deletes the planets filtered by name, climate and terrain in a transaction,
+// returning their IDs in ascending order. At least one filter is required.
+func (s *SQLStore) DeletePlanets(ctx context.Context, arg planetsdb.DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	if !planetsdb.HasFilter(arg) {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.MissingFilter)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.CouldNotDeleteItem)
+	}
+	defer tx.Rollback()
+
+	where, args := planetsFilter(arg.Name, arg.Climate, arg.Terrain)
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT id FROM planets`+where+` ORDER BY id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.FailedToFetchRecord)
+	}
+	ids := []primitive.ObjectID{}
+	for rows.Next() {
+		var hex string
+		if err := rows.Scan(&hex); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("delete planets: %s", errorsmodel.FailedToUnmarshalRecord)
+		}
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("delete planets: %s", errorsmodel.FailedToUnmarshalRecord)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.FailedToFetchRecord)
+	}
+	if arg.DryRun {
+		return ids, nil
+	}
+
+	// deleting by ID leaves out the planets created since the lookup, so the IDs are exactly the
+	// deleted planets
+	for start := 0; start < len(ids); start += deleteChunkSize {
+		chunk := ids[start:]
+		if len(chunk) > deleteChunkSize {
+			chunk = chunk[:deleteChunkSize]
+		}
+		placeholders := make([]string, len(chunk))
+		chunkArgs := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			placeholders[i] = "?"
+			chunkArgs[i] = id.Hex()
+		}
+		query := s.rebind(`DELETE FROM planets WHERE id IN (` + strings.Join(placeholders, ", ") + `)`)
+		if _, err := tx.ExecContext(ctx, query, chunkArgs...); err != nil {
+			return nil, fmt.Errorf("delete planets: %s", errorsmodel.CouldNotDeleteItem)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("delete planets: %s", errorsmodel.CouldNotDeleteItem)
+	}
+	return ids, nil
+}
+
+// planetsFilter returns the WHERE clause, if any, and the arguments selecting the planets by the
+// non blank of name, climate and terrain
+func planetsFilter(name, climate, terrain string) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	for _, filter := range []struct {
+		column string
+		value  string
+	}{
+		{column: "name", value: name},
+		{column: "climate", value: climate},
+		{column: "terrain", value: terrain},
+	} {
+		if value := strings.TrimSpace(filter.value); value != "" {
+			conditions = append(conditions, filter.column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return ` WHERE ` + strings.Join(conditions, " AND "), args
+}
+
+// scanPlanet reads a planet from a row selected with planetColumns
+func scanPlanet(row rowScanner) (planetsdb.Planet, error) {
+	var (
+		planet planetsdb.Planet
+		id     string
+	)
+	err := row.Scan(&id, &planet.Name, &planet.Terrain, &planet.Climate, &planet.Movies, &planet.CreatedBy)
+	if err != nil {
+		return planetsdb.Planet{}, err
+	}
+	planet.ID, err = primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return planetsdb.Planet{}, err
+	}
+	return planet, nil
+}
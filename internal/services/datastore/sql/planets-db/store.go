@@ -0,0 +1,88 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/swapi"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+// Dialect is the SQL flavour spoken by the database behind a SQLStore
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// uniqueViolation is the Postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// SQLStore is a planetsdb.Store backed by a SQL database
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	movies  planetsdb.MoviesFinder
+}
+
+// ParseDialect validates the name of a supported SQL dialect
+func ParseDialect(name string) (Dialect, error) {
+	switch dialect := Dialect(name); dialect {
+	case SQLite, Postgres:
+		return dialect, nil
+	default:
+		return "", fmt.Errorf("unsupported sql dialect %q", name)
+	}
+}
+
+// NewStore creates a pointer to a SQLStore. When movies is nil the public SWAPI is used.
+// Call Migrate before using the store on a new database.
+func NewStore(db *sql.DB, dialect Dialect, movies planetsdb.MoviesFinder) *SQLStore {
+	if movies == nil {
+		movies = swapi.New()
+	}
+	if dialect == SQLite {
+		// SQLite allows a single writer at a time, so concurrent writes on more
+		// connections fail with "database is locked" instead of waiting
+		db.SetMaxOpenConns(1)
+	}
+	return &SQLStore{
+		db:      db,
+		dialect: dialect,
+		movies:  movies,
+	}
+}
+
+// isUniqueViolation reports whether err is the violation of a unique constraint by either
+// supported driver
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// rebind rewrites the "?" placeholders of query into the dialect's bind variables
+func (s *SQLStore) rebind(query string) string {
+	if s.dialect != Postgres {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
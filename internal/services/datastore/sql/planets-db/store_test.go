@@ -0,0 +1,99 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/storetest"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"path/filepath"
+	"testing"
+)
+
+// newSQLiteStore creates a migrated store on a fresh SQLite file
+func newSQLiteStore(t *testing.T, movies planetsdb.MoviesFinder) *SQLStore {
+	db, err := sql.Open(string(SQLite), filepath.Join(t.TempDir(), "planets.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	store := NewStore(db, SQLite, movies)
+	require.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store {
+		return newSQLiteStore(t, movies)
+	})
+}
+
+func TestKeyStoreConformance(t *testing.T) {
+	storetest.RunKeys(t, func(t *testing.T) apikeys.Store {
+		return newSQLiteStore(t, storetest.Movies).KeyStore()
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	store := newSQLiteStore(t, storetest.Movies)
+
+	// a second run finds every migration applied and changes nothing
+	require.NoError(t, store.Migrate(context.Background()))
+
+	var applied []int
+	rows, err := store.db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		require.NoError(t, rows.Scan(&version))
+		applied = append(applied, version)
+	}
+	require.NoError(t, rows.Err())
+
+	require.Len(t, applied, len(migrations))
+	for i, m := range migrations {
+		require.Equal(t, m.version, applied[i])
+	}
+}
+
+func TestMigrateDuplicateNames(t *testing.T) {
+	db, err := sql.Open(string(SQLite), filepath.Join(t.TempDir(), "planets.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	store := NewStore(db, SQLite, storetest.Movies)
+
+	// a database holding duplicates from before the names were unique
+	unique := migrations[len(migrations)-1]
+	migrations = migrations[:len(migrations)-1]
+	err = store.Migrate(context.Background())
+	migrations = append(migrations, unique)
+	require.NoError(t, err)
+	for _, name := range []string{"Tatooine", "Kamino", "Tatooine"} {
+		_, err := db.Exec(`INSERT INTO planets (id, name, terrain, climate, movies) VALUES (?, ?, 'desert', 'arid', 1)`, primitive.NewObjectID().Hex(), name)
+		require.NoError(t, err)
+	}
+
+	err = store.Migrate(context.Background())
+	require.EqualError(t, err, `migrate: version 6: planets share the names "Tatooine" (2 planets), rename or delete the duplicates and start again`)
+
+	_, err = db.Exec(`DELETE FROM planets WHERE name = 'Tatooine'`)
+	require.NoError(t, err)
+	require.NoError(t, store.Migrate(context.Background()))
+}
+
+func TestRebind(t *testing.T) {
+	query := `SELECT id FROM planets WHERE name = ? AND climate = ? LIMIT ?`
+
+	sqlite := &SQLStore{dialect: SQLite}
+	require.Equal(t, query, sqlite.rebind(query))
+
+	postgres := &SQLStore{dialect: Postgres}
+	require.Equal(t, `SELECT id FROM planets WHERE name = $1 AND climate = $2 LIMIT $3`, postgres.rebind(query))
+}
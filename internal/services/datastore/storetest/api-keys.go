@@ -0,0 +1,111 @@
+package storetest
+
+import (
+	"context"
+	"github.com/gmaschi/b2w-sw-planets/internal/auth/apikeys"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+// KeyFactory creates the API key store under test
+type KeyFactory func(t *testing.T) apikeys.Store
+
+// RunKeys runs the conformance suite of apikeys.Store against the stores built by newStore.
+// Like Run, it only asserts on the keys it created.
+func RunKeys(t *testing.T, newStore KeyFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, newStore KeyFactory)
+	}{
+		{name: "CreateKey", test: testCreateKey},
+		{name: "KeyByHashNotFound", test: testKeyByHashNotFound},
+		{name: "ListKeys", test: testListKeys},
+		{name: "RevokeKey", test: testRevokeKey},
+		{name: "RevokeKeyMissing", test: testRevokeKeyMissing},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore)
+		})
+	}
+}
+
+// createKey creates a key with a random name and returns it in clear and stored
+func createKey(t *testing.T, store apikeys.Store, scopes ...string) (string, apikeys.Key) {
+	plaintext, key, err := apikeys.New(random.String(8), scopes, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, store.CreateKey(context.Background(), key))
+	return plaintext, key
+}
+
+func testCreateKey(t *testing.T, newStore KeyFactory) {
+	store := newStore(t)
+	plaintext, key, err := apikeys.New(random.String(8), []string{apikeys.ScopeRead, apikeys.ScopeWrite}, time.Now())
+	require.NoError(t, err)
+	key.Tenant = "rebels"
+	require.NoError(t, store.CreateKey(context.Background(), key))
+
+	got, err := store.KeyByHash(context.Background(), apikeys.Hash(plaintext))
+	require.NoError(t, err)
+	require.Equal(t, key.ID, got.ID)
+	require.Equal(t, key.Name, got.Name)
+	require.Equal(t, key.Prefix, got.Prefix)
+	require.Equal(t, key.Hash, got.Hash)
+	require.Equal(t, key.Scopes, got.Scopes)
+	require.Equal(t, key.Tenant, got.Tenant)
+	require.WithinDuration(t, key.CreatedAt, got.CreatedAt, time.Millisecond)
+	require.False(t, got.Revoked())
+}
+
+func testKeyByHashNotFound(t *testing.T, newStore KeyFactory) {
+	store := newStore(t)
+	_, err := store.KeyByHash(context.Background(), apikeys.Hash("swp_unknown"))
+	require.EqualError(t, err, "get API key: "+errorsmodel.APIKeyDoesNotExist)
+}
+
+func testListKeys(t *testing.T, newStore KeyFactory) {
+	store := newStore(t)
+	_, first := createKey(t, store, apikeys.ScopeRead)
+	_, second := createKey(t, store, apikeys.ScopeAdmin)
+	require.NoError(t, store.RevokeKey(context.Background(), second.ID, time.Now()))
+
+	keys, err := store.ListKeys(context.Background())
+	require.NoError(t, err)
+
+	positions := make(map[string]int)
+	for i, key := range keys {
+		positions[key.ID] = i
+		if key.ID == second.ID {
+			require.True(t, key.Revoked())
+		}
+	}
+	require.Contains(t, positions, first.ID)
+	require.Contains(t, positions, second.ID)
+	require.Less(t, positions[first.ID], positions[second.ID], "keys are not ordered by ID")
+}
+
+func testRevokeKey(t *testing.T, newStore KeyFactory) {
+	store := newStore(t)
+	plaintext, key := createKey(t, store, apikeys.ScopeRead)
+
+	revokedAt := time.Now().Add(-time.Minute)
+	require.NoError(t, store.RevokeKey(context.Background(), key.ID, revokedAt))
+	require.NoError(t, store.RevokeKey(context.Background(), key.ID, time.Now()))
+
+	got, err := store.KeyByHash(context.Background(), apikeys.Hash(plaintext))
+	require.NoError(t, err)
+	require.True(t, got.Revoked())
+	require.WithinDuration(t, revokedAt, *got.RevokedAt, time.Millisecond)
+}
+
+func testRevokeKeyMissing(t *testing.T, newStore KeyFactory) {
+	store := newStore(t)
+	err := store.RevokeKey(context.Background(), primitive.NewObjectID().Hex(), time.Now())
+	require.EqualError(t, err, "revoke API key: "+errorsmodel.APIKeyDoesNotExist)
+}
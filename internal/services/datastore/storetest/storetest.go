@@ -0,0 +1,773 @@
+// Package storetest provides a conformance test suite for planetsdb.Store implementations.
+//
+// Every backend runs the same suite from its own tests:
+//
+//	func TestStoreConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store {
+//			return NewStore(movies)
+//		})
+//	}
+//
+// The suite scopes every assertion to planets it created itself, using random
+// climates and terrains, so it can also run against a store that already holds data.
+// Planet names are unique, so the suite suffixes them with a random word, as in
+// "Kamino xkcdqwer", and Movies counts the appearances of the planet before the suffix.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/pkg/tools/random"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Factory creates the store under test. The store must look up movie appearances with movies.
+type Factory func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store
+
+// MovieAppearances mirrors the SWAPI answers for the planets used by the suite
+var MovieAppearances = map[string]int{
+	"Tatooine": 5,
+	"Kamino":   1,
+	"Stewjon":  0,
+	"Utapau":   1,
+	"Alderaan": 2,
+}
+
+// Movies is a planetsdb.MoviesFinder that answers from MovieAppearances without calling SWAPI,
+// ignoring the suffix of the names after their first space
+var Movies = planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+	movies, ok := MovieAppearances[planetName(name)]
+	if !ok {
+		return -1, fmt.Errorf("%s: %s", errorsmodel.InvalidPlanetName, name)
+	}
+	return movies, nil
+})
+
+// Run runs the whole conformance suite against the stores built by newStore
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, newStore Factory)
+	}{
+		{name: "CountPlanets", test: testCountPlanets},
+		{name: "CreatePlanet", test: testCreatePlanet},
+		{name: "CreatePlanetCreatedBy", test: testCreatePlanetCreatedBy},
+		{name: "CreatePlanetInvalidName", test: testCreatePlanetInvalidName},
+		{name: "CreatePlanetLookupFailure", test: testCreatePlanetLookupFailure},
+		{name: "CreatePlanetDuplicateName", test: testCreatePlanetDuplicateName},
+		{name: "CreatePlanets", test: testCreatePlanets},
+		{name: "CreatePlanetsDuplicateNames", test: testCreatePlanetsDuplicateNames},
+		{name: "CreatePlanetsAtomic", test: testCreatePlanetsAtomic},
+		{name: "CreatePlanetsSkipLookup", test: testCreatePlanetsSkipLookup},
+		{name: "GetPlanet", test: testGetPlanet},
+		{name: "GetPlanetNotFound", test: testGetPlanetNotFound},
+		{name: "GetPlanetInvalidID", test: testGetPlanetInvalidID},
+		{name: "GetPlanetFields", test: testGetPlanetFields},
+		{name: "DeletePlanet", test: testDeletePlanet},
+		{name: "DeletePlanetMissing", test: testDeletePlanetMissing},
+		{name: "DeletePlanetInvalidID", test: testDeletePlanetInvalidID},
+		{name: "DeletePlanets", test: testDeletePlanets},
+		{name: "DeletePlanetsDryRun", test: testDeletePlanetsDryRun},
+		{name: "DeletePlanetsMissingFilter", test: testDeletePlanetsMissingFilter},
+		{name: "ListPlanetsFilters", test: testListPlanetsFilters},
+		{name: "ListPlanetsOrdering", test: testListPlanetsOrdering},
+		{name: "ListPlanetsPagination", test: testListPlanetsPagination},
+		{name: "ListPlanetsNotFound", test: testListPlanetsNotFound},
+		{name: "ListPlanetsFields", test: testListPlanetsFields},
+		{name: "WalkPlanets", test: testWalkPlanets},
+		{name: "WalkPlanetsPages", test: testWalkPlanetsPages},
+		{name: "WalkPlanetsStop", test: testWalkPlanetsStop},
+		{name: "WalkPlanetsCanceled", test: testWalkPlanetsCanceled},
+		{name: "Concurrency", test: testConcurrency},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newStore)
+		})
+	}
+}
+
+// createPlanet creates a planet and checks the returned resource
+func createPlanet(t *testing.T, store planetsdb.Store, arg planetsdb.CreatePlanetParams) planetsdb.Planet {
+	planet, err := store.CreatePlanet(context.Background(), arg)
+	require.NoError(t, err)
+	require.False(t, planet.ID.IsZero())
+	require.Len(t, planet.ID.Hex(), 24)
+	require.Equal(t, arg.Name, planet.Name)
+	require.Equal(t, arg.Terrain, planet.Terrain)
+	require.Equal(t, arg.Climate, planet.Climate)
+	require.Equal(t, MovieAppearances[planetName(arg.Name)], planet.Movies)
+	require.Equal(t, arg.CreatedBy, planet.CreatedBy)
+	return planet
+}
+
+// uniqueName suffixes the name of planet with a random word
+func uniqueName(planet string) string {
+	return planet + " " + random.String(12)
+}
+
+// planetName is the name of the planet of a name made by uniqueName
+func planetName(name string) string {
+	return strings.SplitN(name, " ", 2)[0]
+}
+
+// randomParams returns create arguments with a unique name of planet and random climate and terrain
+func randomParams(planet string) planetsdb.CreatePlanetParams {
+	return planetsdb.CreatePlanetParams{
+		Name:    uniqueName(planet),
+		Terrain: random.String(12),
+		Climate: random.String(12),
+	}
+}
+
+// renamed returns arg with another unique name of the same planet
+func renamed(arg planetsdb.CreatePlanetParams) planetsdb.CreatePlanetParams {
+	arg.Name = uniqueName(planetName(arg.Name))
+	return arg
+}
+
+func requireAscendingIDs(t *testing.T, planets []planetsdb.Planet) {
+	for i := 1; i < len(planets); i++ {
+		require.Negative(t, bytes.Compare(planets[i-1].ID[:], planets[i].ID[:]), "planets are not ordered by ID")
+	}
+}
+
+func testCountPlanets(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	before, err := store.CountPlanets(context.Background())
+	require.NoError(t, err)
+
+	planet := createPlanet(t, store, randomParams("Tatooine"))
+	createPlanet(t, store, randomParams("Kamino"))
+	count, err := store.CountPlanets(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, before+2, count)
+
+	require.NoError(t, store.DeletePlanet(context.Background(), planet.ID.Hex()))
+	count, err = store.CountPlanets(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, before+1, count)
+}
+
+func testCreatePlanet(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	for name := range MovieAppearances {
+		createPlanet(t, store, randomParams(name))
+	}
+}
+
+func testCreatePlanetCreatedBy(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Utapau")
+	arg.CreatedBy = random.String(12)
+	planet := createPlanet(t, store, arg)
+
+	gotPlanet, err := store.GetPlanet(context.Background(), planet.ID.Hex())
+	require.NoError(t, err)
+	require.Equal(t, planet, gotPlanet)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: arg.Climate})
+	require.NoError(t, err)
+	require.Equal(t, []planetsdb.Planet{planet}, planets)
+}
+
+func testCreatePlanetInvalidName(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Endor")
+
+	planet, err := store.CreatePlanet(context.Background(), arg)
+	require.EqualError(t, err, fmt.Sprintf("create planet: %s: %s", errorsmodel.InvalidPlanetName, arg.Name))
+	require.Empty(t, planet)
+
+	_, err = store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: arg.Climate})
+	require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+}
+
+func testCreatePlanetLookupFailure(t *testing.T, newStore Factory) {
+	store := newStore(t, planetsdb.MoviesFinderFunc(func(ctx context.Context, name string) (int, error) {
+		return -1, errors.New(errorsmodel.FailedToFetchRecord)
+	}))
+
+	planet, err := store.CreatePlanet(context.Background(), randomParams("Tatooine"))
+	require.EqualError(t, err, fmt.Sprintf("create planet: %s", errorsmodel.FailedToFetchRecord))
+	require.Empty(t, planet)
+}
+
+func testCreatePlanetDuplicateName(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Tatooine")
+	planet := createPlanet(t, store, arg)
+
+	duplicate := randomParams("Tatooine")
+	duplicate.Name = arg.Name
+	gotPlanet, err := store.CreatePlanet(context.Background(), duplicate)
+	require.EqualError(t, err, fmt.Sprintf("create planet: %s", errorsmodel.PlanetAlreadyExists))
+	require.Empty(t, gotPlanet)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Name: arg.Name})
+	require.NoError(t, err)
+	require.Equal(t, []planetsdb.Planet{planet}, planets)
+
+	// the name is free again once its planet is deleted
+	require.NoError(t, store.DeletePlanet(context.Background(), planet.ID.Hex()))
+	createPlanet(t, store, duplicate)
+}
+
+func testCreatePlanets(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	climate, createdBy := random.String(12), random.String(12)
+	args := planetsdb.CreatePlanetsParams{Planets: []planetsdb.CreatePlanetParams{
+		{Name: uniqueName("Tatooine"), Terrain: random.String(12), Climate: climate, CreatedBy: createdBy},
+		{Name: uniqueName("Endor"), Terrain: random.String(12), Climate: climate},
+		{Name: uniqueName("Kamino"), Terrain: random.String(12), Climate: climate},
+	}}
+
+	results, err := store.CreatePlanets(context.Background(), args)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.EqualError(t, results[1].Err, fmt.Sprintf("create planet: %s: %s", errorsmodel.InvalidPlanetName, args.Planets[1].Name))
+
+	var created []planetsdb.Planet
+	for _, i := range []int{0, 2} {
+		require.NoError(t, results[i].Err)
+		planet := results[i].Planet
+		require.False(t, planet.ID.IsZero())
+		require.Equal(t, args.Planets[i].Name, planet.Name)
+		require.Equal(t, args.Planets[i].Terrain, planet.Terrain)
+		require.Equal(t, args.Planets[i].CreatedBy, planet.CreatedBy)
+		require.Equal(t, MovieAppearances[planetName(planet.Name)], planet.Movies)
+		created = append(created, planet)
+	}
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.NoError(t, err)
+	require.ElementsMatch(t, created, planets)
+}
+
+func testCreatePlanetsDuplicateNames(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	existing := createPlanet(t, store, randomParams("Kamino"))
+	climate, name := random.String(12), uniqueName("Tatooine")
+	args := planetsdb.CreatePlanetsParams{Planets: []planetsdb.CreatePlanetParams{
+		{Name: name, Terrain: random.String(12), Climate: climate},
+		{Name: existing.Name, Terrain: random.String(12), Climate: climate},
+		{Name: name, Terrain: random.String(12), Climate: climate},
+	}}
+
+	results, err := store.CreatePlanets(context.Background(), args)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Err)
+	for _, i := range []int{1, 2} {
+		require.EqualError(t, results[i].Err, fmt.Sprintf("create planet: %s", errorsmodel.PlanetAlreadyExists))
+		require.True(t, results[i].Planet.ID.IsZero())
+	}
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.NoError(t, err)
+	require.Equal(t, []planetsdb.Planet{results[0].Planet}, planets)
+
+	// an atomic batch with a taken name creates none of its planets
+	args = planetsdb.CreatePlanetsParams{
+		Planets: []planetsdb.CreatePlanetParams{
+			{Name: uniqueName("Alderaan"), Terrain: random.String(12), Climate: climate},
+			{Name: existing.Name, Terrain: random.String(12), Climate: climate},
+		},
+		Atomic: true,
+	}
+	results, err = store.CreatePlanets(context.Background(), args)
+	require.NoError(t, err)
+	require.EqualError(t, results[0].Err, fmt.Sprintf("create planet: %s", errorsmodel.BatchAborted))
+	require.EqualError(t, results[1].Err, fmt.Sprintf("create planet: %s", errorsmodel.PlanetAlreadyExists))
+
+	planets, err = store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.NoError(t, err)
+	require.Len(t, planets, 1)
+}
+
+func testCreatePlanetsAtomic(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	climate := random.String(12)
+	args := planetsdb.CreatePlanetsParams{
+		Planets: []planetsdb.CreatePlanetParams{
+			{Name: uniqueName("Tatooine"), Terrain: random.String(12), Climate: climate},
+			{Name: uniqueName("Endor"), Terrain: random.String(12), Climate: climate},
+		},
+		Atomic: true,
+	}
+
+	results, err := store.CreatePlanets(context.Background(), args)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.EqualError(t, results[0].Err, fmt.Sprintf("create planet: %s", errorsmodel.BatchAborted))
+	require.True(t, results[0].Planet.ID.IsZero())
+	require.EqualError(t, results[1].Err, fmt.Sprintf("create planet: %s: %s", errorsmodel.InvalidPlanetName, args.Planets[1].Name))
+
+	_, err = store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+
+	args.Planets[1].Name = uniqueName("Alderaan")
+	results, err = store.CreatePlanets(context.Background(), args)
+	require.NoError(t, err)
+	require.False(t, planetsdb.Failed(results))
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []planetsdb.Planet{results[0].Planet, results[1].Planet}, planets)
+}
+
+func testCreatePlanetsSkipLookup(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	climate := random.String(12)
+	args := planetsdb.CreatePlanetsParams{
+		Planets: []planetsdb.CreatePlanetParams{
+			{Name: uniqueName("Tatooine"), Terrain: random.String(12), Climate: climate, Movies: 3},
+			{Name: uniqueName("Endor"), Terrain: random.String(12), Climate: climate, Movies: 1},
+		},
+		SkipLookup: true,
+	}
+
+	results, err := store.CreatePlanets(context.Background(), args)
+	require.NoError(t, err)
+	require.False(t, planetsdb.Failed(results))
+	require.Equal(t, 3, results[0].Planet.Movies)
+	require.Equal(t, 1, results[1].Planet.Movies)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []planetsdb.Planet{results[0].Planet, results[1].Planet}, planets)
+}
+
+func testGetPlanet(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	planet := createPlanet(t, store, randomParams("Kamino"))
+
+	gotPlanet, err := store.GetPlanet(context.Background(), planet.ID.Hex())
+	require.NoError(t, err)
+	require.Equal(t, planet, gotPlanet)
+}
+
+func testGetPlanetFields(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	planet := createPlanet(t, store, randomParams("Tatooine"))
+
+	testCases := []struct {
+		name     string
+		fields   []string
+		expected planetsdb.Planet
+	}{
+		{name: "some", fields: []string{"_id", "name", "movies"}, expected: planetsdb.Planet{ID: planet.ID, Name: planet.Name, Movies: planet.Movies}},
+		{name: "id", fields: []string{"_id"}, expected: planetsdb.Planet{ID: planet.ID}},
+		{name: "all", expected: planet},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotPlanet, err := store.GetPlanet(context.Background(), planet.ID.Hex(), tc.fields...)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, gotPlanet)
+		})
+	}
+}
+
+func testGetPlanetNotFound(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+
+	planet, err := store.GetPlanet(context.Background(), primitive.NewObjectID().Hex())
+	require.EqualError(t, err, fmt.Sprintf("get planet: %s", errorsmodel.PlanetDoesNotExist))
+	require.Empty(t, planet)
+}
+
+func testGetPlanetInvalidID(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+
+	for _, id := range []string{"", "inval!d-$ID#", "123", primitive.NewObjectID().Hex() + "00"} {
+		planet, err := store.GetPlanet(context.Background(), id)
+		require.EqualError(t, err, fmt.Sprintf("get planet: %s", errorsmodel.InvalidID), "id %q", id)
+		require.Empty(t, planet)
+	}
+}
+
+func testDeletePlanet(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	planet := createPlanet(t, store, randomParams("Utapau"))
+	kept := createPlanet(t, store, randomParams("Utapau"))
+
+	err := store.DeletePlanet(context.Background(), planet.ID.Hex())
+	require.NoError(t, err)
+
+	deletedPlanet, err := store.GetPlanet(context.Background(), planet.ID.Hex())
+	require.EqualError(t, err, fmt.Sprintf("get planet: %s", errorsmodel.PlanetDoesNotExist))
+	require.Empty(t, deletedPlanet)
+
+	gotPlanet, err := store.GetPlanet(context.Background(), kept.ID.Hex())
+	require.NoError(t, err)
+	require.Equal(t, kept, gotPlanet)
+}
+
+func testDeletePlanetMissing(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+
+	err := store.DeletePlanet(context.Background(), primitive.NewObjectID().Hex())
+	require.EqualError(t, err, fmt.Sprintf("delete planet: %s", errorsmodel.PlanetDoesNotExist))
+}
+
+func testDeletePlanetInvalidID(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+
+	err := store.DeletePlanet(context.Background(), "inval!d-$ID#")
+	require.EqualError(t, err, fmt.Sprintf("delete planet: %s", errorsmodel.InvalidID))
+}
+
+func testDeletePlanets(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	climate, terrain := random.String(12), random.String(12)
+	tatooine := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Tatooine"), Climate: climate, Terrain: terrain})
+	kamino := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Kamino"), Climate: climate, Terrain: terrain})
+	alderaan := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Alderaan"), Climate: climate, Terrain: random.String(12)})
+
+	ids, err := store.DeletePlanets(context.Background(), planetsdb.DeletePlanetsParams{Climate: climate, Terrain: terrain})
+	require.NoError(t, err)
+	require.Equal(t, []primitive.ObjectID{tatooine.ID, kamino.ID}, ids)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.NoError(t, err)
+	require.Equal(t, []planetsdb.Planet{alderaan}, planets)
+
+	// nothing left to delete
+	ids, err = store.DeletePlanets(context.Background(), planetsdb.DeletePlanetsParams{Climate: climate, Terrain: terrain})
+	require.NoError(t, err)
+	require.Empty(t, ids)
+}
+
+func testDeletePlanetsDryRun(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	climate := random.String(12)
+	tatooine := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Tatooine"), Climate: climate, Terrain: random.String(12)})
+	kamino := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Kamino"), Climate: climate, Terrain: random.String(12)})
+
+	ids, err := store.DeletePlanets(context.Background(), planetsdb.DeletePlanetsParams{Climate: climate, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, []primitive.ObjectID{tatooine.ID, kamino.ID}, ids)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: climate})
+	require.NoError(t, err)
+	require.Equal(t, []planetsdb.Planet{tatooine, kamino}, planets)
+}
+
+func testDeletePlanetsMissingFilter(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	planet := createPlanet(t, store, randomParams("Stewjon"))
+
+	ids, err := store.DeletePlanets(context.Background(), planetsdb.DeletePlanetsParams{Name: " "})
+	require.EqualError(t, err, fmt.Sprintf("delete planets: %s", errorsmodel.MissingFilter))
+	require.Empty(t, ids)
+
+	_, err = store.GetPlanet(context.Background(), planet.ID.Hex())
+	require.NoError(t, err)
+}
+
+func testListPlanetsFilters(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	climate := random.String(12)
+	terrain := random.String(12)
+
+	tatooine := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Tatooine"), Climate: climate, Terrain: terrain})
+	kamino := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Kamino"), Climate: climate, Terrain: random.String(12)})
+	alderaan := createPlanet(t, store, planetsdb.CreatePlanetParams{Name: uniqueName("Alderaan"), Climate: random.String(12), Terrain: terrain})
+
+	testCases := []struct {
+		name     string
+		listArgs planetsdb.ListPlanetParams
+		expected []planetsdb.Planet
+	}{
+		{
+			name:     "climate",
+			listArgs: planetsdb.ListPlanetParams{Climate: climate},
+			expected: []planetsdb.Planet{tatooine, kamino},
+		},
+		{
+			name:     "terrain",
+			listArgs: planetsdb.ListPlanetParams{Terrain: terrain},
+			expected: []planetsdb.Planet{tatooine, alderaan},
+		},
+		{
+			name:     "climateAndTerrain",
+			listArgs: planetsdb.ListPlanetParams{Climate: climate, Terrain: terrain},
+			expected: []planetsdb.Planet{tatooine},
+		},
+		{
+			name:     "nameAndClimate",
+			listArgs: planetsdb.ListPlanetParams{Name: kamino.Name, Climate: climate},
+			expected: []planetsdb.Planet{kamino},
+		},
+		{
+			name:     "trimmedValues",
+			listArgs: planetsdb.ListPlanetParams{Name: " " + alderaan.Name + " ", Terrain: "\t" + terrain + " "},
+			expected: []planetsdb.Planet{alderaan},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			planets, err := store.ListPlanets(context.Background(), tc.listArgs)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, planets)
+		})
+	}
+}
+
+func testListPlanetsOrdering(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Stewjon")
+	n := 5
+
+	created := make([]planetsdb.Planet, 0, n)
+	for i := 0; i < n; i++ {
+		created = append(created, createPlanet(t, store, renamed(arg)))
+	}
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: arg.Climate})
+	require.NoError(t, err)
+	require.Equal(t, created, planets)
+	requireAscendingIDs(t, planets)
+}
+
+func testListPlanetsPagination(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Tatooine")
+	n := 5
+
+	created := make([]planetsdb.Planet, 0, n)
+	for i := 0; i < n; i++ {
+		created = append(created, createPlanet(t, store, renamed(arg)))
+	}
+
+	testCases := []struct {
+		name     string
+		offset   int64
+		limit    int64
+		expected []planetsdb.Planet
+	}{
+		{name: "limit", limit: 2, expected: created[:2]},
+		{name: "offset", offset: 3, expected: created[3:]},
+		{name: "offsetAndLimit", offset: 1, limit: 3, expected: created[1:4]},
+		{name: "limitPastEnd", offset: 4, limit: 10, expected: created[4:]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{
+				Climate: arg.Climate,
+				Offset:  tc.offset,
+				Limit:   tc.limit,
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, planets)
+		})
+	}
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: arg.Climate, Offset: int64(n)})
+	require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+	require.Empty(t, planets)
+}
+
+func testListPlanetsNotFound(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: random.String(12)})
+	require.EqualError(t, err, fmt.Sprintf("list planets: %s", errorsmodel.PlanetDoesNotExist))
+	require.Empty(t, planets)
+}
+
+func testListPlanetsFields(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Kamino")
+	first := createPlanet(t, store, arg)
+	second := createPlanet(t, store, renamed(arg))
+
+	listArgs := planetsdb.ListPlanetParams{Climate: arg.Climate, Fields: []string{"_id", "terrain"}}
+	expected := []planetsdb.Planet{
+		{ID: first.ID, Terrain: first.Terrain},
+		{ID: second.ID, Terrain: second.Terrain},
+	}
+
+	planets, err := store.ListPlanets(context.Background(), listArgs)
+	require.NoError(t, err)
+	require.Equal(t, expected, planets)
+
+	planets = nil
+	err = store.WalkPlanets(context.Background(), listArgs, func(planet planetsdb.Planet) error {
+		planets = append(planets, planet)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, planets)
+}
+
+func testWalkPlanets(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Kamino")
+	n := 4
+
+	created := make([]planetsdb.Planet, 0, n)
+	for i := 0; i < n; i++ {
+		created = append(created, createPlanet(t, store, renamed(arg)))
+	}
+
+	testCases := []struct {
+		name     string
+		listArgs planetsdb.ListPlanetParams
+		expected []planetsdb.Planet
+	}{
+		{name: "all", listArgs: planetsdb.ListPlanetParams{Climate: arg.Climate}, expected: created},
+		{name: "page", listArgs: planetsdb.ListPlanetParams{Climate: arg.Climate, Offset: 1, Limit: 2}, expected: created[1:3]},
+		{name: "none", listArgs: planetsdb.ListPlanetParams{Climate: random.String(12)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var planets []planetsdb.Planet
+			err := store.WalkPlanets(context.Background(), tc.listArgs, func(planet planetsdb.Planet) error {
+				planets = append(planets, planet)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, planets)
+		})
+	}
+}
+
+func testWalkPlanetsPages(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	climate := random.String(12)
+
+	// more planets than the stores read at a time
+	var created []planetsdb.Planet
+	for chunk := 0; chunk < 12; chunk++ {
+		args := planetsdb.CreatePlanetsParams{SkipLookup: true}
+		for i := 0; i < 100; i++ {
+			args.Planets = append(args.Planets, planetsdb.CreatePlanetParams{
+				Name:    fmt.Sprintf("Kamino %d", chunk*100+i),
+				Terrain: random.String(12),
+				Climate: climate,
+				Movies:  1,
+			})
+		}
+		results, err := store.CreatePlanets(context.Background(), args)
+		require.NoError(t, err)
+		for _, result := range results {
+			require.NoError(t, result.Err)
+			created = append(created, result.Planet)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		listArgs planetsdb.ListPlanetParams
+		expected []planetsdb.Planet
+	}{
+		{name: "all", listArgs: planetsdb.ListPlanetParams{Climate: climate}, expected: created},
+		{name: "page", listArgs: planetsdb.ListPlanetParams{Climate: climate, Offset: 450, Limit: 600}, expected: created[450:1050]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var planets []planetsdb.Planet
+			err := store.WalkPlanets(context.Background(), tc.listArgs, func(planet planetsdb.Planet) error {
+				planets = append(planets, planet)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, planets)
+		})
+	}
+}
+
+func testWalkPlanetsStop(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Kamino")
+	createPlanet(t, store, arg)
+	createPlanet(t, store, renamed(arg))
+
+	stop := errors.New("stop")
+	calls := 0
+	err := store.WalkPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: arg.Climate}, func(planet planetsdb.Planet) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, calls)
+}
+
+func testWalkPlanetsCanceled(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Kamino")
+	createPlanet(t, store, arg)
+	createPlanet(t, store, renamed(arg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	err := store.WalkPlanets(ctx, planetsdb.ListPlanetParams{Climate: arg.Climate}, func(planet planetsdb.Planet) error {
+		calls++
+		// the client went away while the first planet was written
+		cancel()
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+}
+
+func testConcurrency(t *testing.T, newStore Factory) {
+	store := newStore(t, Movies)
+	arg := randomParams("Alderaan")
+	n := 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			planet, err := store.CreatePlanet(context.Background(), renamed(arg))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if _, err := store.GetPlanet(context.Background(), planet.ID.Hex()); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: arg.Climate}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	planets, err := store.ListPlanets(context.Background(), planetsdb.ListPlanetParams{Climate: arg.Climate})
+	require.NoError(t, err)
+	require.Len(t, planets, n)
+	requireAscendingIDs(t, planets)
+
+	ids := make(map[primitive.ObjectID]struct{}, n)
+	for _, planet := range planets {
+		ids[planet.ID] = struct{}{}
+	}
+	require.Len(t, ids, n)
+}
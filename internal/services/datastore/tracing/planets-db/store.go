@@ -0,0 +1,155 @@
+package tracingstore
+
+import (
+	"context"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+const tracerName = "github.com/gmaschi/b2w-sw-planets/internal/services/datastore"
+
+// TracingStore decorates a planets store, starting a span for every method
+type TracingStore struct {
+	store   planetsdb.Store
+	tracer  trace.Tracer
+	backend attribute.KeyValue
+}
+
+// NewStore wraps store, naming backend (e.g. mongodb) on its spans. The spans are created by
+// the global tracer provider, as children of the span in the context of each call.
+func NewStore(store planetsdb.Store, backend string) *TracingStore {
+	return &TracingStore{
+		store:   store,
+		tracer:  otel.Tracer(tracerName),
+		backend: attribute.String("db.system", backend),
+	}
+}
+
+// CreatePlanet calls the decorated store
+func (ts *TracingStore) CreatePlanet(ctx context.Context, arg planetsdb.CreatePlanetParams) (planetsdb.Planet, error) {
+	ctx, span := ts.start(ctx, "CreatePlanet", attribute.String("planet.name", arg.Name))
+	defer span.End()
+
+	planet, err := ts.store.CreatePlanet(ctx, arg)
+	if err == nil {
+		span.SetAttributes(attribute.String("planet.id", planet.ID.Hex()))
+	}
+	recordError(span, err)
+	return planet, err
+}
+
+// CreatePlanets calls the decorated store
+func (ts *TracingStore) CreatePlanets(ctx context.Context, arg planetsdb.CreatePlanetsParams) ([]planetsdb.CreatePlanetResult, error) {
+	ctx, span := ts.start(ctx, "CreatePlanets",
+		attribute.Int("planets.count", len(arg.Planets)),
+		attribute.Bool("planets.atomic", arg.Atomic),
+	)
+	defer span.End()
+
+	results, err := ts.store.CreatePlanets(ctx, arg)
+	var failed int
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("planets.failed", failed))
+	recordError(span, err)
+	return results, err
+}
+
+// DeletePlanet calls the decorated store
+func (ts *TracingStore) DeletePlanet(ctx context.Context, id string) error {
+	ctx, span := ts.start(ctx, "DeletePlanet", attribute.String("planet.id", id))
+	defer span.End()
+
+	err := ts.store.DeletePlanet(ctx, id)
+	recordError(span, err)
+	return err
+}
+
+// DeletePlanets calls the decorated store
+func (ts *TracingStore) DeletePlanets(ctx context.Context, arg planetsdb.DeletePlanetsParams) ([]primitive.ObjectID, error) {
+	ctx, span := ts.start(ctx, "DeletePlanets", attribute.Bool("planets.dry_run", arg.DryRun))
+	defer span.End()
+
+	ids, err := ts.store.DeletePlanets(ctx, arg)
+	span.SetAttributes(attribute.Int("planets.count", len(ids)))
+	recordError(span, err)
+	return ids, err
+}
+
+// GetPlanet calls the decorated store
+func (ts *TracingStore) GetPlanet(ctx context.Context, id string, fields ...string) (planetsdb.Planet, error) {
+	ctx, span := ts.start(ctx, "GetPlanet", attribute.String("planet.id", id))
+	defer span.End()
+
+	planet, err := ts.store.GetPlanet(ctx, id, fields...)
+	recordError(span, err)
+	return planet, err
+}
+
+// ListPlanets calls the decorated store
+func (ts *TracingStore) ListPlanets(ctx context.Context, arg planetsdb.ListPlanetParams) ([]planetsdb.Planet, error) {
+	ctx, span := ts.start(ctx, "ListPlanets",
+		attribute.Int64("planets.offset", arg.Offset),
+		attribute.Int64("planets.limit", arg.Limit),
+	)
+	defer span.End()
+
+	planets, err := ts.store.ListPlanets(ctx, arg)
+	span.SetAttributes(attribute.Int("planets.count", len(planets)))
+	recordError(span, err)
+	return planets, err
+}
+
+// WalkPlanets calls the decorated store, the span lasts until the walk is over
+func (ts *TracingStore) WalkPlanets(ctx context.Context, arg planetsdb.ListPlanetParams, fn func(planet planetsdb.Planet) error) error {
+	ctx, span := ts.start(ctx, "WalkPlanets",
+		attribute.Int64("planets.offset", arg.Offset),
+		attribute.Int64("planets.limit", arg.Limit),
+	)
+	defer span.End()
+
+	count := 0
+	err := ts.store.WalkPlanets(ctx, arg, func(planet planetsdb.Planet) error {
+		count++
+		return fn(planet)
+	})
+	span.SetAttributes(attribute.Int("planets.count", count))
+	recordError(span, err)
+	return err
+}
+
+// CountPlanets calls the decorated store
+func (ts *TracingStore) CountPlanets(ctx context.Context) (int64, error) {
+	ctx, span := ts.start(ctx, "CountPlanets")
+	defer span.End()
+
+	count, err := ts.store.CountPlanets(ctx)
+	span.SetAttributes(attribute.Int64("planets.count", count))
+	recordError(span, err)
+	return count, err
+}
+
+func (ts *TracingStore) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return ts.tracer.Start(ctx, "planetsdb."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, ts.backend)...),
+	)
+}
+
+// recordError records err on span, leaving planets that do not exist out of the span errors
+func recordError(span trace.Span, err error) {
+	if err == nil || strings.HasSuffix(err.Error(), errorsmodel.PlanetDoesNotExist) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,52 @@
+package tracingstore
+
+import (
+	"context"
+	memorystore "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/memory/planets-db"
+	planetsdb "github.com/gmaschi/b2w-sw-planets/internal/services/datastore/mongodb/planets-db"
+	"github.com/gmaschi/b2w-sw-planets/internal/services/datastore/storetest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, movies planetsdb.MoviesFinder) planetsdb.Store {
+		return NewStore(memorystore.NewStore(movies), "memory")
+	})
+}
+
+func TestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+	store := NewStore(memorystore.NewStore(storetest.Movies), "memory")
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	planet, err := store.CreatePlanet(ctx, planetsdb.CreatePlanetParams{Name: "Tatooine", Climate: "arid", Terrain: "desert"})
+	require.NoError(t, err)
+	_, err = store.GetPlanet(ctx, "61f1a1b2c3d4e5f6a7b8c9d0")
+	require.Error(t, err)
+	_, err = store.GetPlanet(ctx, "not-an-id")
+	require.Error(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	for _, span := range spans[:3] {
+		require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+
+	require.Equal(t, "planetsdb.CreatePlanet", spans[0].Name())
+	require.Contains(t, spans[0].Attributes(), attribute.String("planet.id", planet.ID.Hex()))
+	require.Contains(t, spans[0].Attributes(), attribute.String("db.system", "memory"))
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+	require.Equal(t, codes.Error, spans[2].Status().Code)
+	require.Len(t, spans[2].Events(), 1)
+}
@@ -0,0 +1,156 @@
+package swapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	errorsmodel "github.com/gmaschi/b2w-sw-planets/internal/models/planet/errors-model"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBaseURL = "https://swapi.dev/api/planets/"
+	defaultPingTTL = 30 * time.Second
+)
+
+type (
+	Client struct {
+		baseURL    string
+		timeout    time.Duration
+		transport  http.RoundTripper
+		httpClient *http.Client
+
+		// the last Ping, reused for pingTTL
+		pingTTL  time.Duration
+		pingMu   sync.Mutex
+		pingedAt time.Time
+		pingErr  error
+	}
+
+	// Option configures a Client
+	Option func(*Client)
+
+	planetInfo struct {
+		Count   int `json:"count"`
+		Results []struct {
+			Name  string   `json:"name"`
+			Films []string `json:"films"`
+		} `json:"results"`
+	}
+)
+
+// WithBaseURL points the client to another SWAPI planets endpoint
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithTimeout bounds the duration of each SWAPI request
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithTransport sends the SWAPI requests through transport, e.g. to instrument them
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithPingTTL reuses the result of Ping for ttl instead of asking SWAPI on every readiness
+// probe, or never when ttl is zero
+func WithPingTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.pingTTL = ttl
+	}
+}
+
+// New creates a pointer to a Client that queries the public SWAPI
+func New(opts ...Option) *Client {
+	client := &Client{
+		baseURL: defaultBaseURL,
+		pingTTL: defaultPingTTL,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	client.httpClient = &http.Client{
+		Timeout:   client.timeout,
+		Transport: client.transport,
+	}
+	return client
+}
+
+// MovieAppearances gets the total number of movies that a planet has appeared in
+func (c *Client) MovieAppearances(ctx context.Context, name string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
+	if err != nil {
+		return -1, errors.New(errorsmodel.FailedToFetchRecord)
+	}
+
+	q := req.URL.Query()
+	q.Set("search", name)
+	req.URL.RawQuery = q.Encode()
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return -1, errors.New(errorsmodel.FailedToFetchRecord)
+	}
+	defer res.Body.Close()
+
+	var info planetInfo
+
+	err = json.NewDecoder(res.Body).Decode(&info)
+	if err != nil {
+		return -1, errors.New(errorsmodel.FailedToUnmarshalRecord)
+	}
+
+	if info.Count != 1 || info.Results[0].Name != name {
+		return -1, fmt.Errorf("%s: %s", errorsmodel.InvalidPlanetName, name)
+	}
+
+	return len(info.Results[0].Films), nil
+}
+
+// Ping reports whether the SWAPI planets endpoint is reachable and answering successfully. The
+// result, success or failure, is reused by the calls of the next ping TTL, and concurrent calls
+// wait for the one asking SWAPI.
+func (c *Client) Ping(ctx context.Context) error {
+	c.pingMu.Lock()
+	defer c.pingMu.Unlock()
+	if c.pingTTL > 0 && !c.pingedAt.IsZero() && time.Since(c.pingedAt) < c.pingTTL {
+		return c.pingErr
+	}
+
+	err := c.ping(ctx)
+	if ctx.Err() != nil {
+		// the caller gave up, which says nothing about SWAPI
+		return err
+	}
+	c.pingedAt, c.pingErr = time.Now(), err
+	return err
+}
+
+func (c *Client) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("swapi responded %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package swapi
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPingTTL(t *testing.T) {
+	var (
+		hits   int32
+		status int32 = http.StatusOK
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name     string
+		ttl      time.Duration
+		expected int32
+	}{
+		{name: "Cached", ttl: time.Minute, expected: 1},
+		{name: "Disabled", ttl: 0, expected: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&hits, 0)
+			client := New(WithBaseURL(server.URL), WithPingTTL(tc.ttl))
+			for i := 0; i < 3; i++ {
+				require.NoError(t, client.Ping(context.Background()))
+			}
+			require.Equal(t, tc.expected, atomic.LoadInt32(&hits))
+		})
+	}
+
+	t.Run("Expired", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		client := New(WithBaseURL(server.URL), WithPingTTL(50*time.Millisecond))
+
+		// a failure is reused as well
+		require.EqualError(t, client.Ping(context.Background()), "swapi responded 503 Service Unavailable")
+		require.Error(t, client.Ping(context.Background()))
+		require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+		atomic.StoreInt32(&status, http.StatusOK)
+		time.Sleep(60 * time.Millisecond)
+		require.NoError(t, client.Ping(context.Background()))
+		require.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		client := New(WithBaseURL(server.URL), WithPingTTL(time.Minute))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// a probe that gave up is not reused
+		require.Error(t, client.Ping(ctx))
+		require.NoError(t, client.Ping(context.Background()))
+		require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+}
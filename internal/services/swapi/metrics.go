@@ -0,0 +1,54 @@
+package swapi
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type (
+	metricsTransport struct {
+		next     http.RoundTripper
+		requests *prometheus.CounterVec
+		duration *prometheus.HistogramVec
+	}
+)
+
+// NewMetricsTransport wraps next, or http.DefaultTransport when nil, counting the SWAPI
+// requests and observing their latency by method and status code. Requests that get no
+// response are labeled with the code "error".
+func NewMetricsTransport(registerer prometheus.Registerer, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	transport := &metricsTransport{
+		next: next,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "swapi_requests_total",
+			Help: "SWAPI requests by method and status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "swapi_request_duration_seconds",
+			Help:    "Latency of the SWAPI requests by method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+	}
+	registerer.MustRegister(transport.requests, transport.duration)
+	return transport
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	t.requests.WithLabelValues(req.Method, code).Inc()
+	t.duration.WithLabelValues(req.Method, code).Observe(time.Since(start).Seconds())
+	return res, err
+}
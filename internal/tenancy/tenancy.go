@@ -0,0 +1,27 @@
+package tenancy
+
+import (
+	"context"
+	"regexp"
+)
+
+type contextKey struct{}
+
+// validID restricts tenant IDs to characters that are safe in database names
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
+// NewContext returns a copy of ctx that carries the tenant ID
+func NewContext(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantID)
+}
+
+// FromContext returns the tenant ID carried by ctx, if any
+func FromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(contextKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// ValidID reports whether tenantID can be used to route a tenant's data
+func ValidID(tenantID string) bool {
+	return validID.MatchString(tenantID)
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"io"
+	"os"
+)
+
+// Exporters
+const (
+	NoExporter     = "none"
+	StdoutExporter = "stdout"
+	FileExporter   = "file"
+	OTLPExporter   = "otlp"
+)
+
+type Options struct {
+	ServiceName string
+	Exporter    string
+	// OTLPEndpoint is the host:port of an OTLP/HTTP collector
+	OTLPEndpoint string
+	OTLPInsecure bool
+	// File receives the spans, one JSON document each, with the file exporter
+	File string
+}
+
+// ParseExporter validates the name of a span exporter
+func ParseExporter(name string) (string, error) {
+	switch name {
+	case NoExporter, StdoutExporter, FileExporter, OTLPExporter:
+		return name, nil
+	default:
+		return "", fmt.Errorf("unsupported trace exporter %q", name)
+	}
+}
+
+// Setup installs the global tracer provider and the W3C trace context and baggage propagators.
+// The returned function flushes the pending spans and releases the exporter.
+func Setup(ctx context.Context, opts Options) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if opts.Exporter == NoExporter || opts.Exporter == "" {
+		return func(ctx context.Context) error { return nil }, nil
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		file     io.Closer
+		err      error
+	)
+	switch opts.Exporter {
+	case StdoutExporter:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case FileExporter:
+		var f *os.File
+		f, err = os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case OTLPExporter:
+		clientOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.OTLPEndpoint)}
+		if opts.OTLPInsecure {
+			clientOptions = append(clientOptions, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOptions...)
+	default:
+		_, err = ParseExporter(opts.Exporter)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(opts.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
@@ -1,5 +1,19 @@
 package parseerrors
 
+import (
+	"context"
+	requestid "github.com/gmaschi/b2w-sw-planets/pkg/tools/request-id"
+)
+
 func ErrorResponse(err error) map[string]interface{} {
 	return map[string]interface{}{"error": err.Error()}
 }
+
+// RequestErrorResponse is an ErrorResponse naming the ID of the request in ctx, if any
+func RequestErrorResponse(ctx context.Context, err error) map[string]interface{} {
+	res := ErrorResponse(err)
+	if id := requestid.FromContext(ctx); id != "" {
+		res["request_id"] = id
+	}
+	return res
+}